@@ -1,12 +1,25 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"net"
+	"time"
 
 	"github.com/drgarcia1986/street-fair/pkg/api"
+	"github.com/drgarcia1986/street-fair/pkg/cache"
 	"github.com/drgarcia1986/street-fair/pkg/database"
 	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/feed"
+	"github.com/drgarcia1986/street-fair/pkg/gql"
+	"github.com/drgarcia1986/street-fair/pkg/idempotency"
 	"github.com/drgarcia1986/street-fair/pkg/logs"
+	"github.com/drgarcia1986/street-fair/pkg/migrations"
+	"github.com/drgarcia1986/street-fair/pkg/openapi"
+	"github.com/drgarcia1986/street-fair/pkg/outbox"
+	"github.com/drgarcia1986/street-fair/pkg/rpc"
+	"github.com/drgarcia1986/street-fair/pkg/webhook"
 )
 
 func main() {
@@ -16,22 +29,148 @@ func main() {
 	}
 	defer loggerFinalizer()
 
-	db, err := database.New()
+	port := flag.Int("port", 8000, "The port to bind")
+	migrate := flag.Bool("migrate", true, "Apply pending database migrations on startup")
+	shutdownDelay := flag.Duration("shutdown-delay", 0, "Time to keep serving with a failing readiness after a termination signal")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "Maximum time to wait for in-flight requests on shutdown")
+	validateRequests := flag.Bool("validate-requests", false, "Reject requests not matching the OpenAPI spec")
+	rootVersion := flag.String("root-version", "v1", "API version also served on the root, empty to serve only the versioned routes")
+	grpcPort := flag.Int("grpc-port", 9000, "The port to bind the gRPC service, 0 to disable it")
+	flag.Parse()
+
+	cluster, err := database.NewCluster(log)
 	if err != nil {
 		log.Fatalf("Connecting to database: %+v", err)
 	}
+	db := cluster.Primary()
+
+	migrator, err := migrations.New(db, log)
+	if err != nil {
+		log.Fatalf("Loading migrations: %+v", err)
+	}
+	if *migrate {
+		if err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("Applying migrations: %+v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cluster.Watch(ctx)
 
-	sf, err := fair.New(db, log)
+	sf, err := fair.NewWithReplicas(cluster, log)
 	if err != nil {
 		log.Fatalf("Creating new Street Fair instance: %+v", err)
 	}
 
-	port := flag.Int("port", 8000, "The port to bind")
-	flag.Parse()
+	feedConf, err := feed.NewConfig()
+	if err != nil {
+		log.Fatalf("Loading events config: %+v", err)
+	}
+	events := fair.NewOutbox(db)
+	bus := fair.NewBus()
+	if err := bus.UseLog(events, log); err != nil {
+		log.Fatalf("Reading street fair events: %+v", err)
+	}
+	go bus.Follow(ctx, feedConf.Interval)
+	go bus.Watch(ctx, time.Hour, feedConf.Retention)
+
+	webhookConf, err := webhook.NewConfig()
+	if err != nil {
+		log.Fatalf("Loading webhook config: %+v", err)
+	}
+	webhookStore := webhook.NewStore(db)
+	dispatcher := webhook.NewDispatcher(webhookStore, webhookConf, log)
+	go dispatcher.Run(ctx)
+
+	outboxConf, err := outbox.NewConfig()
+	if err != nil {
+		log.Fatalf("Loading outbox config: %+v", err)
+	}
+	// the bus isn't a sink, every instance follows the events for its feeds
+	sinks := []outbox.Sink{dispatcher}
+	if outboxConf.File != "" {
+		fileSink, err := outbox.NewFileSink(outboxConf.File)
+		if err != nil {
+			log.Fatalf("Opening outbox file: %+v", err)
+		}
+		defer fileSink.Close()
+		sinks = append(sinks, fileSink)
+	}
+	relay := outbox.NewRelay(events, outboxConf, log, sinks...)
+	go relay.Run(ctx)
+	sf = fair.NewNotifying(sf, func() {
+		relay.Notify()
+		bus.Notify()
+	})
+
+	cacheConf, err := cache.NewConfig()
+	if err != nil {
+		log.Fatalf("Loading cache config: %+v", err)
+	}
+	if cacheConf.Enabled {
+		sf = fair.NewCached(sf, cache.NewLRU(cacheConf.Size), cacheConf.TTL, log)
+	}
+
+	idempotencyConf, err := idempotency.NewConfig()
+	if err != nil {
+		log.Fatalf("Loading idempotency config: %+v", err)
+	}
+	idem := idempotency.New(idempotency.NewStore(db), idempotencyConf.TTL, idempotencyConf.Lease, log)
+	go idem.Watch(ctx, time.Hour)
 
 	httpSvc := fair.NewHTTPService(sf)
+	httpSvc.UseIdempotency(idem)
 	server := api.NewServer(*port, log)
-	httpSvc.RegisterHandlers(server.Router)
+	server.ShutdownDelay = *shutdownDelay
+	server.ShutdownTimeout = *shutdownTimeout
+	server.AddReadinessCheck("database", database.Ping(db))
+	server.AddReadinessCheck("migrations", migrator.Check)
+	server.AddOptionalCheck("replicas", cluster.CheckReplicas)
+	if *validateRequests {
+		validator, err := openapi.NewValidator()
+		if err != nil {
+			log.Fatalf("Loading OpenAPI spec: %+v", err)
+		}
+		server.Router.Use(validator.Middleware)
+	}
+	server.Register(openapi.RegisterHandlers)
+
+	gqlConf, err := gql.NewConfig()
+	if err != nil {
+		log.Fatalf("Loading GraphQL config: %+v", err)
+	}
+	gqlHandler, err := gql.New(sf, gqlConf)
+	if err != nil {
+		log.Fatalf("Building GraphQL schema: %+v", err)
+	}
+	server.Register(gqlHandler.RegisterHandlers)
+	feedHandler := feed.New(bus, feedConf, log)
+	server.Register(feedHandler.RegisterHandlers)
+	server.OnShutdown(feedHandler.Close)
+	server.Register(webhook.NewHTTPService(webhookStore, webhookConf, log).RegisterHandlers)
+
+	server.AddVersion(api.APIVersion{Name: "v1", Register: httpSvc.RegisterHandlers})
+	if *rootVersion != "" {
+		if err := server.AliasRoot(*rootVersion); err != nil {
+			log.Fatalf("Aliasing API version on the root: %+v", err)
+		}
+	}
+
+	if *grpcPort != 0 {
+		grpcServer := rpc.New(sf, bus, log)
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+		if err != nil {
+			log.Fatalf("Listening gRPC port: %+v", err)
+		}
+		go func() {
+			log.WithField("port", *grpcPort).Info("Starting gRPC Server")
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Errorf("Running gRPC Server: %v", err)
+			}
+		}()
+		defer grpcServer.GracefulStop()
+	}
 
 	if err := server.Run(); err != nil {
 		log.Errorf("Running Server: %v", err)
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
 
 	"github.com/drgarcia1986/street-fair/pkg/database"
 	"github.com/drgarcia1986/street-fair/pkg/fair"
 	"github.com/drgarcia1986/street-fair/pkg/importer"
 	"github.com/drgarcia1986/street-fair/pkg/logs"
+	"github.com/drgarcia1986/street-fair/pkg/migrations"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,20 +20,100 @@ func main() {
 	}
 	defer loggerFinalizer()
 
-	db, err := database.New()
+	filePath := flag.String("path", "./DEINFO_AB_FEIRASLIVRES_2014.csv", "The path of file with street fairs data")
+	format := flag.String("format", "", "The format of the file: auto (by its extension), csv, json, ndjson, geojson or xlsx (default FAIR_IMPORT_FORMAT or auto)")
+	sheet := flag.String("sheet", "", "The name or the number of the sheet of a XLSX file (default FAIR_IMPORT_SHEET or the first one)")
+	migrate := flag.Bool("migrate", true, "Apply pending database migrations before importing")
+	mode := flag.String("mode", "", "create (skips the existing street fairs), upsert (updates the changed ones) or sync (also deletes the missing ones) (default FAIR_IMPORT_MODE or create)")
+	atomic := flag.Bool("atomic", false, "Import the whole file in a single transaction, nothing is imported when some row fails (default FAIR_IMPORT_ATOMIC)")
+	dryRun := flag.Bool("dry-run", false, "Only compare the file to the stored street fairs, printing the diff (exit code 2 when the import would change something)")
+	diffPath := flag.String("diff", "", "The path of the JSON diff written by -dry-run")
+	mapping := flag.String("mapping", "", "The path of a JSON or YAML file mapping the columns (default FAIR_IMPORT_MAPPING)")
+	report := flag.String("report", "", "The path of the JSON report with the counts, the timings and the errors by row (default FAIR_IMPORT_REPORT)")
+	encoding := flag.String("encoding", "", "The encoding of the file: auto (by the BOM, Windows-1252 when it isn't UTF-8), utf-8, utf-16le, utf-16be, iso-8859-1, iso-8859-15 or windows-1252 (default FAIR_IMPORT_ENCODING or auto)")
+	delimiter := flag.String("delimiter", "", "The delimiter of the fields, a character, tab or auto (by the header) (default FAIR_IMPORT_DELIMITER or auto)")
+	lazyQuotes := flag.Bool("lazy-quotes", false, "Accept quotes inside the unquoted fields and unescaped quotes inside the quoted ones (default FAIR_IMPORT_LAZY_QUOTES)")
+	ragged := flag.Bool("ragged", false, "Accept rows with more or less fields than the header, instead of rejecting them (default FAIR_IMPORT_RAGGED)")
+	rejects := flag.String("rejects", "", "The path of a CSV file with the rejected rows and an added error column (default FAIR_IMPORT_REJECTS)")
+	flag.Parse()
+
+	conf, err := importer.NewConfig()
+	if err != nil {
+		log.Fatalf("Loading importer config: %+v", err)
+	}
+	if *mapping != "" {
+		conf.Mapping = *mapping
+	}
+	if *format != "" {
+		if !importer.ValidFormat(*format) {
+			log.Fatalf("Invalid format %q, want auto, csv, json, ndjson, geojson or xlsx", *format)
+		}
+		conf.Format = *format
+	}
+	if *sheet != "" {
+		conf.Sheet = *sheet
+	}
+	if *encoding != "" {
+		if !importer.ValidEncoding(*encoding) {
+			log.Fatalf("Invalid encoding %q", *encoding)
+		}
+		conf.Encoding = *encoding
+	}
+	if *delimiter != "" {
+		conf.Delimiter = *delimiter
+	}
+	if *lazyQuotes {
+		conf.LazyQuotes = true
+	}
+	if *ragged {
+		conf.Ragged = true
+	}
+	if *report != "" {
+		conf.Report = *report
+	}
+	if *rejects != "" {
+		conf.Rejects = *rejects
+	}
+	if *atomic {
+		conf.Atomic = true
+	}
+	if *dryRun {
+		conf.DryRun = true
+	}
+	if *mode != "" {
+		if !importer.ValidMode(*mode) {
+			log.Fatalf("Invalid mode %q, want create, upsert or sync", *mode)
+		}
+		conf.Mode = *mode
+	}
+
+	db, err := database.New(log)
 	if err != nil {
 		log.Fatalf("Connecting to database: %+v", err)
 	}
 
+	// a dry-run doesn't write, not even the migrations
+	if *migrate && !conf.DryRun {
+		migrator, err := migrations.New(db, log)
+		if err != nil {
+			log.Fatalf("Loading migrations: %+v", err)
+		}
+		if err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("Applying migrations: %+v", err)
+		}
+	}
+
 	sf, err := fair.New(db, log)
 	if err != nil {
 		log.Fatalf("Error loading the StreetFair module: %+v", err)
 	}
-	imp := importer.New(log, sf)
-
-	filePath := flag.String("path", "./DEINFO_AB_FEIRASLIVRES_2014.csv", "The path of file with street fairs data")
-	flag.Parse()
+	imp := importer.New(log, sf, conf)
 
+	if conf.DryRun {
+		code := diff(log, imp, *filePath, *diffPath)
+		_ = loggerFinalizer()
+		os.Exit(code)
+	}
 	if err := imp.Run(*filePath); err != nil {
 		log.WithFields(logrus.Fields{
 			"file": filePath,
@@ -38,3 +121,33 @@ func main() {
 	}
 	log.Info("Finished")
 }
+
+// diff prints the diff of the import of filePath, writing it as JSON to
+// jsonPath when set. It returns the exit code: 2 when there are changes
+func diff(log *logrus.Logger, imp *importer.Importer, filePath, jsonPath string) int {
+	d, err := imp.DryRun(filePath)
+	if err != nil {
+		log.WithField("file", filePath).Errorf("Error comparing file: %+v", err)
+		return 1
+	}
+	if jsonPath != "" {
+		f, err := os.Create(jsonPath)
+		if err != nil {
+			log.Errorf("Creating the diff file: %+v", err)
+			return 1
+		}
+		defer f.Close()
+		if err := d.WriteJSON(f); err != nil {
+			log.Errorf("Writing the diff file: %+v", err)
+			return 1
+		}
+	}
+	if err := d.WriteText(os.Stdout); err != nil {
+		log.Errorf("Writing the diff: %+v", err)
+		return 1
+	}
+	if d.HasChanges() {
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/database"
+	"github.com/drgarcia1986/street-fair/pkg/logs"
+	"github.com/drgarcia1986/street-fair/pkg/migrations"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up             Apply every pending migration
+  down           Revert the last applied migrations (see -steps)
+  status         List the migrations and when they were applied
+  create <name>  Create the up and down scripts of a new migration
+
+Flags:
+`
+
+func main() {
+	steps := flag.Int("steps", 1, "Number of migrations to revert with `down`")
+	dir := flag.String("dir", "./pkg/migrations/sql", "The migrations directory used by `create`")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if cmd := flag.Arg(0); cmd == "create" {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		files, err := migrations.Create(*dir, flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Creating migration: %+v\n", err)
+			os.Exit(1)
+		}
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		return
+	}
+
+	log, loggerFinalizer, err := logs.New()
+	if err != nil {
+		panic(err)
+	}
+	defer loggerFinalizer()
+
+	db, err := database.New(log)
+	if err != nil {
+		log.Fatalf("Connecting to database: %+v", err)
+	}
+
+	migrator, err := migrations.New(db, log)
+	if err != nil {
+		log.Fatalf("Loading migrations: %+v", err)
+	}
+
+	ctx := context.Background()
+	switch flag.Arg(0) {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx, *steps)
+	case "status":
+		err = printStatus(ctx, migrator)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Running %s: %+v", flag.Arg(0), err)
+	}
+}
+
+func printStatus(ctx context.Context, migrator *migrations.Migrator) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return w.Flush()
+}
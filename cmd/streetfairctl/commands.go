@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/drgarcia1986/street-fair/pkg/client"
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/importer"
+	"github.com/sirupsen/logrus"
+)
+
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{"get", "<registry>", "Show a street fair", runGet},
+	{"list", "", "List the street fairs", runList},
+	{"create", "", "Create a street fair from a JSON file and/or flags", runCreate},
+	{"update", "<registry>", "Update a street fair from a JSON file and/or flags", runUpdate},
+	{"delete", "<registry>", "Delete a street fair", runDelete},
+	{"import", "<file.csv>", "Create the street fairs of a CSV file", runImport},
+	{"export", "", "Write the street fairs as CSV (or JSON)", runExport},
+}
+
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: streetfairctl %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of args and checks the number of positional arguments
+func parse(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func filterFlags(fs *flag.FlagSet) *client.Filters {
+	f := new(client.Filters)
+	fs.StringVar(&f.District, "district", "", "Filter by district")
+	fs.StringVar(&f.Region5, "region5", "", "Filter by region 5")
+	fs.StringVar(&f.Name, "name", "", "Filter by name")
+	fs.StringVar(&f.Neighborhood, "neighborhood", "", "Filter by neighborhood")
+	return f
+}
+
+func stringField(field func(m *fair.Model) *string) func(m *fair.Model, v string) error {
+	return func(m *fair.Model, v string) error {
+		*field(m) = v
+		return nil
+	}
+}
+
+func floatField(field func(m *fair.Model) *float64) func(m *fair.Model, v string) error {
+	return func(m *fair.Model, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		*field(m) = f
+		return err
+	}
+}
+
+var modelFields = []struct {
+	name string
+	set  func(m *fair.Model, v string) error
+}{
+	{"longitude", floatField(func(m *fair.Model) *float64 { return &m.Longitude })},
+	{"latitude", floatField(func(m *fair.Model) *float64 { return &m.Latitude })},
+	{"setcens", stringField(func(m *fair.Model) *string { return &m.Setcens })},
+	{"areap", stringField(func(m *fair.Model) *string { return &m.Areap })},
+	{"cod-district", stringField(func(m *fair.Model) *string { return &m.CodDistrict })},
+	{"district", stringField(func(m *fair.Model) *string { return &m.District })},
+	{"cod-sub-city-hall", stringField(func(m *fair.Model) *string { return &m.CodSubCityHall })},
+	{"sub-city-hall", stringField(func(m *fair.Model) *string { return &m.SubCityHall })},
+	{"region5", stringField(func(m *fair.Model) *string { return &m.Region5 })},
+	{"region8", stringField(func(m *fair.Model) *string { return &m.Region8 })},
+	{"name", stringField(func(m *fair.Model) *string { return &m.Name })},
+	{"registry", stringField(func(m *fair.Model) *string { return &m.Registry })},
+	{"address", stringField(func(m *fair.Model) *string { return &m.Address })},
+	{"address-number", stringField(func(m *fair.Model) *string { return &m.AddressNumber })},
+	{"neighborhood", stringField(func(m *fair.Model) *string { return &m.Neighborhood })},
+	{"landmark", stringField(func(m *fair.Model) *string { return &m.Landmark })},
+}
+
+// modelFlags adds the `-file` flag and a flag by field of the street fair,
+// the returned function applies them to m (the flags over the file)
+func modelFlags(fs *flag.FlagSet) func(m *fair.Model) error {
+	file := fs.String("file", "", "JSON file of the street fair, - for stdin")
+	var sets []func(m *fair.Model) error
+	for _, field := range modelFields {
+		field := field
+		fs.Func(field.name, "The "+field.name+" of the street fair", func(v string) error {
+			sets = append(sets, func(m *fair.Model) error { return field.set(m, v) })
+			return nil
+		})
+	}
+
+	return func(m *fair.Model) error {
+		if *file != "" {
+			f := os.Stdin
+			if *file != "-" {
+				var err error
+				if f, err = os.Open(*file); err != nil {
+					return err
+				}
+				defer f.Close()
+			}
+			if err := json.NewDecoder(f).Decode(m); err != nil {
+				return fmt.Errorf("parsing %s: %w", *file, err)
+			}
+		}
+		for _, set := range sets {
+			if err := set(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func runGet(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("get", "<registry>", stderr)
+	output := fs.String("o", "json", "Output format: table, json or csv")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	m, err := c.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return writeJSON(stdout, m)
+	}
+	return writeModels(stdout, *output, []fair.Model{*m})
+}
+
+func runList(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("list", "", stderr)
+	filters := filterFlags(fs)
+	output := fs.String("o", "table", "Output format: table, json or csv")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	models, err := c.All(ctx, *filters)
+	if err != nil {
+		return err
+	}
+	return writeModels(stdout, *output, models)
+}
+
+func runCreate(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("create", "", stderr)
+	apply := modelFlags(fs)
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	m := new(fair.Model)
+	if err := apply(m); err != nil {
+		return err
+	}
+	created, err := c.Create(ctx, m)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, created)
+}
+
+func runUpdate(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("update", "<registry>", stderr)
+	apply := modelFlags(fs)
+	version := fs.Int64("version", 0, "Required current version (default the version fetched before the update)")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	m, err := c.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := apply(m); err != nil {
+		return err
+	}
+	if m.Registry != fs.Arg(0) {
+		return errors.New("cannot update field `registry`")
+	}
+	if *version != 0 {
+		m.Version = *version
+	}
+	if err := c.Update(ctx, m); err != nil {
+		return err
+	}
+	return writeJSON(stdout, m)
+}
+
+func runDelete(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("delete", "<registry>", stderr)
+	version := fs.Int64("version", 0, "Required current version (default any version)")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	return c.Delete(ctx, fs.Arg(0), *version)
+}
+
+// apiCreator adapts the client to the importer
+type apiCreator struct {
+	ctx context.Context
+	c   *client.Client
+}
+
+func (a *apiCreator) Create(m *fair.Model) (*fair.Model, error) {
+	return a.c.Create(a.ctx, m)
+}
+
+func runImport(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("import", "<file.csv>", stderr)
+	mapping := fs.String("mapping", "", "JSON or YAML file mapping the columns (default FAIR_IMPORT_MAPPING)")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	conf, err := importer.NewConfig()
+	if err != nil {
+		return err
+	}
+	if *mapping != "" {
+		conf.Mapping = *mapping
+	}
+	log := logrus.New()
+	log.SetOutput(stderr)
+	return importer.New(log, &apiCreator{ctx: ctx, c: c}, conf).Run(fs.Arg(0))
+}
+
+func runExport(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("export", "", stderr)
+	filters := filterFlags(fs)
+	output := fs.String("o", "csv", "Output format: csv or json")
+	path := fs.String("out", "-", "Output file, - for stdout")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	models, err := c.All(ctx, *filters)
+	if err != nil {
+		return err
+	}
+
+	if *path == "-" {
+		return writeModels(stdout, *output, models)
+	}
+	f, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeModels(f, *output, models)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/drgarcia1986/street-fair/pkg/client"
+)
+
+const usage = `Usage: streetfairctl [flags] <command> [command flags]
+
+Commands:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command of args and returns the exit code: 2 on invalid
+// usage and 1 on failures
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("streetfairctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", defaultConfigPath(), "The profiles config file")
+	profile := fs.String("profile", os.Getenv("STREETFAIRCTL_PROFILE"), "The profile of the API, the default one of the config file when empty")
+	url := fs.String("url", "", "The base URL of the API, overriding the profile")
+	token := fs.String("token", "", "The auth token of the API, overriding the profile")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		for _, cmd := range commands {
+			fmt.Fprintf(stderr, "  %-8s %-12s %s\n", cmd.name, cmd.args, cmd.usage)
+		}
+		fmt.Fprint(stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == fs.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fs.Usage()
+		return 2
+	}
+
+	conf, err := clientConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Loading config: %+v\n", err)
+		return 1
+	}
+	if *url != "" {
+		conf.URL = *url
+	}
+	if *token != "" {
+		conf.Token = *token
+	}
+
+	if err := cmd.run(ctx, client.New(conf), fs.Args()[1:], stdout, stderr); err != nil {
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "Running %s: %+v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drgarcia1986/street-fair/pkg/api"
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/fair/fairtest"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestAPI() *httptest.Server {
+	sf := fairtest.New(
+		fair.Model{Registry: "4041-0", Name: "VILA FORMOSA", District: "VILA FORMOSA", Address: "RUA MARAGOJIPE", AddressNumber: "S/N"},
+		fair.Model{Registry: "4045-2", Name: "PRACA SANTA HELENA", District: "VILA PRUDENTE", Address: "RUA JOSE DOS REIS", AddressNumber: "909"},
+	)
+	server := api.NewServer(8000, logrus.New())
+	server.AddVersion(api.APIVersion{Name: "v1", Register: fair.NewHTTPService(sf).RegisterHandlers})
+	return httptest.NewServer(server.Router)
+}
+
+func TestRun(t *testing.T) {
+	var testCases = []struct {
+		title          string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			"Without Command",
+			[]string{},
+			2, "", "Usage: streetfairctl [flags] <command>",
+		},
+		{
+			"Unknown Command",
+			[]string{"upsert"},
+			2, "", "Usage: streetfairctl [flags] <command>",
+		},
+		{
+			"Unknown Flag",
+			[]string{"-verbose", "list"},
+			2, "", "flag provided but not defined: -verbose",
+		},
+		{
+			"Unknown Command Flag",
+			[]string{"list", "-region8", "Leste 2"},
+			2, "", "Usage: streetfairctl list [flags]",
+		},
+		{
+			"Missing Argument",
+			[]string{"get"},
+			2, "", "Usage: streetfairctl get [flags] <registry>",
+		},
+		{
+			"Unknown Profile",
+			[]string{"-profile", "staging", "list"},
+			1, "", "Loading config: unknown profile staging",
+		},
+		{
+			"Get",
+			[]string{"get", "4041-0"},
+			0, `"registry": "4041-0"`, "",
+		},
+		{
+			"Get Not Found",
+			[]string{"get", "9999-9"},
+			1, "", "Running get: 404 Not Found",
+		},
+		{
+			"List Table",
+			[]string{"list", "-district", "VILA FORMOSA"},
+			0,
+			"REGISTRY  NAME          DISTRICT      REGION 5  NEIGHBORHOOD  ADDRESS             VERSION\n" +
+				"4041-0    VILA FORMOSA  VILA FORMOSA                          RUA MARAGOJIPE S/N  1\n",
+			"",
+		},
+		{
+			"List CSV",
+			[]string{"list", "-district", "VILA PRUDENTE", "-o", "csv"},
+			0,
+			strings.Join(csvHeader, ",") + "\n" +
+				"1,0,0,,,,VILA PRUDENTE,,,,,PRACA SANTA HELENA,4045-2,RUA JOSE DOS REIS,909,,\n",
+			"",
+		},
+		{
+			"List Unknown Output",
+			[]string{"list", "-o", "yaml"},
+			1, "", "Running list: unknown output format yaml",
+		},
+		{
+			"Create",
+			[]string{"create", "-registry", "1234-5", "-name", "NOVA"},
+			0, `"name": "NOVA"`, "",
+		},
+		{
+			"Create Invalid Field",
+			[]string{"create", "-registry", "1234-5", "-longitude", "west"},
+			1, "", "Running create: strconv.ParseFloat",
+		},
+		{
+			"Update",
+			[]string{"update", "-name", "VILA FORMOSA II", "4041-0"},
+			0, `"version": 2`, "",
+		},
+		{
+			"Update Stale Version",
+			[]string{"update", "-name", "VILA FORMOSA II", "-version", "3", "4041-0"},
+			1, "", "Running update: 412 Precondition Failed",
+		},
+		{
+			"Delete",
+			[]string{"delete", "-version", "1", "4045-2"},
+			0, "", "",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			srv := newTestAPI()
+			defer srv.Close()
+
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-config", filepath.Join(t.TempDir(), "config.json"), "-url", srv.URL + "/v1"}, tt.args...)
+			if code := run(context.Background(), args, &stdout, &stderr); code != tt.expectedCode {
+				t.Errorf("got exit code %d; want %d (%s)", code, tt.expectedCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.expectedStdout) || (tt.expectedStdout == "" && stdout.Len() > 0) {
+				t.Errorf("got stdout %q; want %q", stdout.String(), tt.expectedStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.expectedStderr) || (tt.expectedStderr == "" && stderr.Len() > 0) {
+				t.Errorf("got stderr %q; want %q", stderr.String(), tt.expectedStderr)
+			}
+		})
+	}
+}
+
+func TestClientConfigProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"default": "local", "profiles": {` +
+		`"local": {"url": "http://localhost:8000/v1"},` +
+		`"production": {"url": "https://fairs.example.com/v1", "token": "secret"}}}`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		profile       string
+		expectedURL   string
+		expectedToken string
+	}{
+		{"", "http://localhost:8000/v1", ""},
+		{"production", "https://fairs.example.com/v1", "secret"},
+	}
+	for _, tt := range testCases {
+		conf, err := clientConfig(path, tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.URL != tt.expectedURL || conf.Token != tt.expectedToken {
+			t.Errorf("%q: got %s %s; want %s %s", tt.profile, conf.URL, conf.Token, tt.expectedURL, tt.expectedToken)
+		}
+	}
+}
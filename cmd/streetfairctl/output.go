@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+// csvHeader is the header of the street fair CSV files, the same accepted by `import`
+var csvHeader = []string{
+	"ID", "LONG", "LAT", "SETCENS", "AREAP", "CODDIST", "DISTRITO", "CODSUBPREF", "SUBPREFE",
+	"REGIAO5", "REGIAO8", "NOME_FEIRA", "REGISTRO", "LOGRADOURO", "NUMERO", "BAIRRO", "REFERENCIA",
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeTable(w io.Writer, models []fair.Model) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGISTRY\tNAME\tDISTRICT\tREGION 5\tNEIGHBORHOOD\tADDRESS\tVERSION")
+	for _, m := range models {
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\t%s %s\t%d\n",
+			m.Registry, m.Name, m.District, m.Region5, m.Neighborhood, m.Address, m.AddressNumber, m.Version,
+		)
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, models []fair.Model) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for i, m := range models {
+		record := []string{
+			strconv.Itoa(i + 1), formatFloat(m.Longitude), formatFloat(m.Latitude), m.Setcens, m.Areap,
+			m.CodDistrict, m.District, m.CodSubCityHall, m.SubCityHall, m.Region5, m.Region8,
+			m.Name, m.Registry, m.Address, m.AddressNumber, m.Neighborhood, m.Landmark,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeModels writes models on the output format (table, json or csv)
+func writeModels(w io.Writer, format string, models []fair.Model) error {
+	switch format {
+	case "table":
+		return writeTable(w, models)
+	case "json":
+		if models == nil {
+			models = []fair.Model{}
+		}
+		return writeJSON(w, models)
+	case "csv":
+		return writeCSV(w, models)
+	}
+	return fmt.Errorf("unknown output format %s", format)
+}
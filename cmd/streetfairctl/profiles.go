@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/drgarcia1986/street-fair/pkg/client"
+)
+
+// Profile is an API endpoint, f.ex. the local, staging and production APIs
+type Profile struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// Profiles is the config file of streetfairctl:
+//
+//	{
+//	  "default": "local",
+//	  "profiles": {
+//	    "local": {"url": "http://localhost:8000/v1"},
+//	    "production": {"url": "https://fairs.example.com/v1", "token": "..."}
+//	  }
+//	}
+type Profiles struct {
+	Default  string             `json:"default"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "streetfairctl", "config.json")
+}
+
+func loadProfiles(path string) (*Profiles, error) {
+	p := new(Profiles)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// clientConfig returns the settings of the profile name (or the default one)
+// over the `FAIR_CLIENT_*` env vars, without profiles the env vars are used
+func clientConfig(configPath, name string) (*client.Config, error) {
+	conf, err := client.NewConfig()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := loadProfiles(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = profiles.Default
+	}
+	if name == "" {
+		return conf, nil
+	}
+	profile, ok := profiles.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s", name)
+	}
+	if profile.URL != "" {
+		conf.URL = profile.URL
+	}
+	if profile.Token != "" {
+		conf.Token = profile.Token
+	}
+	return conf, nil
+}
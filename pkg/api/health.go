@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Build information, injected at build time through `-ldflags -X`
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Check reports if some dependency of the server is able to work
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readinessResp struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+type versionResp struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+type health struct {
+	mu           sync.RWMutex
+	checks       []namedCheck
+	shuttingDown bool
+}
+
+func (h *health) add(c namedCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, c)
+}
+
+func (h *health) setShuttingDown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shuttingDown = true
+}
+
+func (h *health) snapshot() ([]namedCheck, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]namedCheck{}, h.checks...), h.shuttingDown
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (h *health) liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &readinessResp{Status: "ok"})
+}
+
+func (h *health) readiness(w http.ResponseWriter, r *http.Request) {
+	checks, shuttingDown := h.snapshot()
+	if shuttingDown {
+		writeJSON(w, http.StatusServiceUnavailable, &readinessResp{Status: "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	resp := &readinessResp{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+	status := http.StatusOK
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			resp.Checks[c.name] = checkResult{Status: "failing", Error: err.Error()}
+			if !c.optional {
+				resp.Status = "failing"
+				status = http.StatusServiceUnavailable
+			}
+			continue
+		}
+		resp.Checks[c.name] = checkResult{Status: "ok"}
+	}
+	writeJSON(w, status, resp)
+}
+
+func (h *health) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &versionResp{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	})
+}
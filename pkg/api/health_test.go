@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func okCheck(ctx context.Context) error {
+	return nil
+}
+
+func failingCheck(ctx context.Context) error {
+	return errors.New("some error")
+}
+
+func TestReadiness(t *testing.T) {
+	var testCases = []struct {
+		title          string
+		required       []Check
+		optional       []Check
+		shuttingDown   bool
+		expectedStatus int
+	}{
+		{"Without Checks", nil, nil, false, http.StatusOK},
+		{"Everything Ok", []Check{okCheck}, []Check{okCheck}, false, http.StatusOK},
+		{"Required Failing", []Check{okCheck, failingCheck}, nil, false, http.StatusServiceUnavailable},
+		{"Optional Failing", []Check{okCheck}, []Check{failingCheck}, false, http.StatusOK},
+		{"Shutting Down", []Check{okCheck}, nil, true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			s := NewServer(8000, logrus.New())
+			for i, c := range tt.required {
+				s.AddReadinessCheck(string(rune('a'+i)), c)
+			}
+			for i, c := range tt.optional {
+				s.AddOptionalCheck(string(rune('A'+i)), c)
+			}
+			if tt.shuttingDown {
+				s.health.setShuttingDown()
+			}
+
+			req, err := http.NewRequest("GET", "/readyz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			s.Router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("got %d; want %d (%s)", status, tt.expectedStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	s := NewServer(8000, logrus.New())
+	s.AddReadinessCheck("db", failingCheck)
+
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	s.Router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("got %d; want %d", status, http.StatusOK)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	s := NewServer(8000, logrus.New())
+
+	req, err := http.NewRequest("GET", "/version", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	s.Router.ServeHTTP(rr, req)
+
+	var v versionResp
+	if err := json.NewDecoder(rr.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Commit != Commit {
+		t.Errorf("got %s; want %s", v.Commit, Commit)
+	}
+	if v.GoVersion == "" {
+		t.Error("got empty go version")
+	}
+}
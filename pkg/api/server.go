@@ -1,8 +1,15 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -10,23 +17,124 @@ import (
 
 type Server struct {
 	Router *mux.Router
-	port   int
-	log    *logrus.Logger
+	// ShutdownDelay is how long the server keeps serving (with a failing
+	// readiness) after a termination signal, so load balancers can stop
+	// sending new requests before connections are drained
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is the maximum time to wait for in-flight requests
+	ShutdownTimeout time.Duration
+	port            int
+	log             *logrus.Logger
+	health          *health
+	versions        map[string]*APIVersion
+	// reserved are the first segments of the paths served on the root, not
+	// shadowed by the version aliased on it
+	reserved   map[string]bool
+	onShutdown []func()
+}
+
+// AddReadinessCheck registers a check required for the server to be ready
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.health.add(namedCheck{name: name, check: check})
+}
+
+// AddOptionalCheck registers a check that is reported on `/readyz`
+// but doesn't make the server unready when failing
+func (s *Server) AddOptionalCheck(name string, check Check) {
+	s.health.add(namedCheck{name: name, check: check, optional: true})
+}
+
+// firstSegment returns the first segment of the path, like `graphql` of
+// `/graphql` or `webhooks` of `/webhooks/{id}/`
+func firstSegment(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+// reserve takes the first segment of the path template from the version
+// aliased on the root, unless it's a variable
+func (s *Server) reserve(tpl string) {
+	if segment := firstSegment(tpl); segment != "" && !strings.Contains(segment, "{") {
+		s.reserved[segment] = true
+	}
+}
+
+// Register adds the handlers of register to the root, like `/graphql`.
+// Their paths take precedence over the version aliased on the root
+// (see AliasRoot) whatever the order of the calls
+func (s *Server) Register(register func(r *mux.Router)) {
+	r := s.Router.NewRoute().Subrouter()
+	register(r)
+	_ = r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			s.reserve(tpl)
+		}
+		return nil
+	})
+}
+
+// OnShutdown registers f to be called when the shutdown starts, to end the
+// long-lived requests (streams and WebSockets) not waited by the draining
+func (s *Server) OnShutdown(f func()) {
+	s.onShutdown = append(s.onShutdown, f)
 }
 
 func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	server := &http.Server{
 		Handler: s.Router,
 		Addr:    fmt.Sprintf(":%d", s.port),
 	}
-	s.log.WithField("port", s.port).Info("Starting Server")
-	return server.ListenAndServe()
+	for _, f := range s.onShutdown {
+		server.RegisterOnShutdown(f)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.log.WithField("port", s.port).Info("Starting Server")
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.log.Info("Shutting down Server")
+	s.health.setShuttingDown()
+	time.Sleep(s.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 func NewServer(port int, log *logrus.Logger) *Server {
-	return &Server{
-		port:   port,
-		log:    log,
-		Router: mux.NewRouter().StrictSlash(true),
+	s := &Server{
+		ShutdownTimeout: 10 * time.Second,
+		port:            port,
+		log:             log,
+		health:          &health{},
+		versions:        make(map[string]*APIVersion),
+		reserved:        make(map[string]bool),
+		Router:          mux.NewRouter().StrictSlash(true),
 	}
+	s.Register(func(r *mux.Router) {
+		r.HandleFunc("/healthz", s.health.liveness).Methods("GET")
+		r.HandleFunc("/readyz", s.health.readiness).Methods("GET")
+		r.HandleFunc("/version", s.health.version).Methods("GET")
+	})
+	return s
 }
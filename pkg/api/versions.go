@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrUnknownVersion = errors.New("Unknown API version")
+
+// APIVersion is a version of the API served under `/<Name>/`, the versions
+// run side by side until the deprecated ones reach their sunset
+type APIVersion struct {
+	Name string
+	// Deprecation is when the version was deprecated, zero if it isn't
+	Deprecation time.Time
+	// Sunset is when the version stops being served, zero if unknown
+	Sunset time.Time
+	// Link is the migration guide of the deprecated version
+	Link string
+	// Register adds the handlers of the version to the router
+	Register func(r *mux.Router)
+}
+
+// deprecation adds the `Deprecation` (RFC 9745), `Sunset` (RFC 8594)
+// and `Link` headers to the responses of a deprecated version
+func (v *APIVersion) deprecation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", v.Deprecation.Unix()))
+		if !v.Sunset.IsZero() {
+			w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if v.Link != "" {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, v.Link))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (v *APIVersion) mount(r *mux.Router) {
+	if !v.Deprecation.IsZero() {
+		r.Use(v.deprecation)
+	}
+	v.Register(r)
+}
+
+// AddVersion mounts the handlers of v under `/<v.Name>/`
+func (s *Server) AddVersion(v APIVersion) {
+	s.versions[v.Name] = &v
+	s.reserve("/" + v.Name)
+	v.mount(s.Router.PathPrefix("/" + v.Name).Subrouter())
+}
+
+// AliasRoot serves the handlers of the version name on the root too,
+// except on the paths reserved by the versions and Register
+func (s *Server) AliasRoot(name string) error {
+	v, ok := s.versions[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownVersion, name)
+	}
+	notReserved := func(r *http.Request, m *mux.RouteMatch) bool {
+		return !s.reserved[firstSegment(r.URL.Path)]
+	}
+	v.mount(s.Router.NewRoute().MatcherFunc(notReserved).Subrouter())
+	return nil
+}
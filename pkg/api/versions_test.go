@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func versionHandler(name string) func(r *mux.Router) {
+	return func(r *mux.Router) {
+		r.HandleFunc("/{registry}/", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		}).Methods("GET")
+	}
+}
+
+func TestVersions(t *testing.T) {
+	deprecation := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	s := NewServer(8000, logrus.New())
+	s.AddVersion(APIVersion{
+		Name:        "v1",
+		Deprecation: deprecation,
+		Sunset:      sunset,
+		Link:        "https://example.com/migrating-to-v2",
+		Register:    versionHandler("v1"),
+	})
+	s.AddVersion(APIVersion{Name: "v2", Register: versionHandler("v2")})
+	if err := s.AliasRoot("v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		url                 string
+		expectedBody        string
+		expectedDeprecation string
+		expectedSunset      string
+	}{
+		{"/v1/4041-0/", "v1", "@1622505600", "Wed, 01 Dec 2021 00:00:00 GMT"},
+		{"/v2/4041-0/", "v2", "", ""},
+		{"/4041-0/", "v2", "", ""},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.url, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			s.Router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got %d; want %d", rr.Code, http.StatusOK)
+			}
+			if actual := rr.Body.String(); actual != tt.expectedBody {
+				t.Errorf("got %s; want %s", actual, tt.expectedBody)
+			}
+			if actual := rr.Header().Get("Deprecation"); actual != tt.expectedDeprecation {
+				t.Errorf("got %s; want %s", actual, tt.expectedDeprecation)
+			}
+			if actual := rr.Header().Get("Sunset"); actual != tt.expectedSunset {
+				t.Errorf("got %s; want %s", actual, tt.expectedSunset)
+			}
+		})
+	}
+}
+
+func TestAliasRootUnknownVersion(t *testing.T) {
+	s := NewServer(8000, logrus.New())
+	if err := s.AliasRoot("v1"); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("got %v; want %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestAliasRootReservedPaths(t *testing.T) {
+	s := NewServer(8000, logrus.New())
+	s.AddVersion(APIVersion{Name: "v1", Register: versionHandler("v1")})
+	// the root is aliased before the other handlers are registered
+	if err := s.AliasRoot("v1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Register(func(r *mux.Router) {
+		r.HandleFunc("/webhooks/", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("webhooks"))
+		}).Methods("GET")
+	})
+
+	var testCases = []struct {
+		method       string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"GET", "/webhooks/", http.StatusOK, "webhooks"},
+		{"POST", "/webhooks/", http.StatusMethodNotAllowed, ""},
+		{"GET", "/4041-0/", http.StatusOK, "v1"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.Router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.url, nil))
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("got %d; want %d", rr.Code, tt.expectedCode)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("got %s; want %s", rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("got miss; want hit")
+	}
+	c.Set("c", []byte("3"), 0)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("got hit; want least recently used evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("got miss of %s; want hit", key)
+		}
+	}
+	if actual := c.Len(); actual != 2 {
+		t.Errorf("got %d; want 2", actual)
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set("short", []byte("1"), time.Second)
+	c.Set("forever", []byte("2"), 0)
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Error("got hit; want expired")
+	}
+	if v, ok := c.Get("forever"); !ok || string(v) != "2" {
+		t.Errorf("got %s, %v; want 2, true", v, ok)
+	}
+	if actual := c.Len(); actual != 1 {
+		t.Errorf("got %d; want 1", actual)
+	}
+}
+
+func TestLRUOverwrite(t *testing.T) {
+	c := NewLRU(10)
+	c.Set("a", []byte("1"), 0)
+	c.Set("a", []byte("2"), 0)
+
+	if v, _ := c.Get("a"); string(v) != "2" {
+		t.Errorf("got %s; want 2", v)
+	}
+	if actual := c.Len(); actual != 1 {
+		t.Errorf("got %d; want 1", actual)
+	}
+}
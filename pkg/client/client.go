@@ -0,0 +1,241 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/idempotency"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type Config struct {
+	// URL is the base URL of the API, including the version
+	URL string `default:"http://localhost:8000/v1"`
+	// Token is sent as a bearer token when not empty
+	Token   string
+	Timeout time.Duration `default:"10s"`
+	// Retries is the maximum number of retries of a failed request
+	Retries    int           `default:"3"`
+	MinBackoff time.Duration `default:"100ms"`
+	MaxBackoff time.Duration `default:"2s"`
+}
+
+// NewConfig returns the client settings from the `FAIR_CLIENT_*` env vars
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_client", conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// Filters are the filters of a street fair listing, empty ones are ignored
+type Filters struct {
+	District     string
+	Region5      string
+	Name         string
+	Neighborhood string
+}
+
+func (f *Filters) values() url.Values {
+	v := make(url.Values)
+	for key, value := range map[string]string{
+		"district":     f.District,
+		"region5":      f.Region5,
+		"name":         f.Name,
+		"neighborhood": f.Neighborhood,
+	} {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	return v
+}
+
+// Client is a typed client of the street fair API, it's safe for concurrent use
+type Client struct {
+	conf *Config
+	http *http.Client
+	// sleep waits between retries, it's replaced on tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff is the exponential wait before the retry attempt (starting at 1)
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.conf.MinBackoff << uint(attempt-1)
+	if d <= 0 || d > c.conf.MaxBackoff {
+		return c.conf.MaxBackoff
+	}
+	return d
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func ifMatch(version int64) string {
+	if version == 0 {
+		return "*"
+	}
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// do sends the request retrying with backoff the connection errors and the
+// transient responses, the requests are either idempotent or carry an
+// `Idempotency-Key`. The body of a successful response is decoded into out
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx, c.backoff(attempt)); err != nil {
+				return err
+			}
+		}
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.conf.URL, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, values := range header {
+			req.Header[k] = values
+		}
+		req.Header.Set("Accept", "application/json")
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.conf.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.conf.Token)
+		}
+
+		resp, err = c.http.Do(req)
+		if err == nil && !retryable(resp.StatusCode) {
+			break
+		}
+		if attempt == c.conf.Retries || ctx.Err() != nil {
+			break
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Get returns the street fair of registry
+func (c *Client) Get(ctx context.Context, registry string) (*fair.Model, error) {
+	m := new(fair.Model)
+	if err := c.do(ctx, "GET", "/"+url.PathEscape(registry)+"/", nil, nil, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// All returns every street fair matching filters
+func (c *Client) All(ctx context.Context, filters Filters) ([]fair.Model, error) {
+	path := "/"
+	if q := filters.values().Encode(); q != "" {
+		path += "?" + q
+	}
+	var models []fair.Model
+	if err := c.do(ctx, "GET", path, nil, nil, &models); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// Create stores a new street fair, the request carries an
+// `Idempotency-Key` so the retries don't duplicate it
+func (c *Client) Create(ctx context.Context, m *fair.Model) (*fair.Model, error) {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	created := new(fair.Model)
+	header := http.Header{idempotency.Header: []string{key}}
+	if err := c.do(ctx, "POST", "/", header, m, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Update changes the street fair of m.Registry when its current version is
+// m.Version (any version when zero), m is updated with the stored street fair
+func (c *Client) Update(ctx context.Context, m *fair.Model) error {
+	header := http.Header{"If-Match": []string{ifMatch(m.Version)}}
+	return c.do(ctx, "PUT", "/"+url.PathEscape(m.Registry)+"/", header, m, m)
+}
+
+// Delete removes the street fair of registry when its current
+// version is version (any version when zero)
+func (c *Client) Delete(ctx context.Context, registry string, version int64) error {
+	header := http.Header{"If-Match": []string{ifMatch(version)}}
+	return c.do(ctx, "DELETE", "/"+url.PathEscape(registry)+"/", header, nil, nil)
+}
+
+// New returns a Client of the API described by conf
+func New(conf *Config) *Client {
+	return &Client{
+		conf:  conf,
+		http:  &http.Client{Timeout: conf.Timeout},
+		sleep: sleep,
+	}
+}
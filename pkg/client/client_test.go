@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/api"
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/fair/fairtest"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c := New(&Config{URL: ts.URL + "/v1", Timeout: time.Second, Retries: 2})
+	c.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return c
+}
+
+func newTestAPI() http.Handler {
+	sf := fairtest.New()
+	server := api.NewServer(8000, logrus.New())
+	server.AddVersion(api.APIVersion{Name: "v1", Register: fair.NewHTTPService(sf).RegisterHandlers})
+	return server.Router
+}
+
+func TestClientCRUD(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, newTestAPI())
+
+	created, err := c.Create(ctx, &fair.Model{Registry: "4041-0", District: "VILA FORMOSA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Version != 1 {
+		t.Errorf("got version %d; want 1", created.Version)
+	}
+
+	created.Name = "VILA FORMOSA II"
+	if err := c.Update(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Version != 2 {
+		t.Errorf("got version %d; want 2", created.Version)
+	}
+
+	m, err := c.Get(ctx, "4041-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "VILA FORMOSA II" {
+		t.Errorf("got %s; want VILA FORMOSA II", m.Name)
+	}
+
+	models, err := c.All(ctx, Filters{District: "VILA FORMOSA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 1 {
+		t.Errorf("got %d models; want 1", len(models))
+	}
+
+	if err := c.Delete(ctx, "4041-0", 1); !errors.Is(err, fair.ErrVersionMismatch) {
+		t.Errorf("got %v; want %v", err, fair.ErrVersionMismatch)
+	}
+	if err := c.Delete(ctx, "4041-0", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "4041-0"); !errors.Is(err, fair.ErrNotFound) {
+		t.Errorf("got %v; want %v", err, fair.ErrNotFound)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	var testCases = []struct {
+		status   int
+		expected error
+	}{
+		{http.StatusNotFound, fair.ErrNotFound},
+		{http.StatusBadRequest, fair.ErrInvalidStreetFair},
+		{http.StatusPreconditionFailed, fair.ErrVersionMismatch},
+		{http.StatusPreconditionRequired, fair.ErrPreconditionRequired},
+		{http.StatusInternalServerError, fair.ErrInternal},
+	}
+
+	for _, tt := range testCases {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"msg":"some error"}`))
+			}))
+			_, err := c.Get(context.Background(), "4041-0")
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("got %v; want %v", err, tt.expected)
+			}
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.Msg != "some error" {
+				t.Errorf("got %v; want an *Error with message `some error`", err)
+			}
+		})
+	}
+}
+
+func TestClientCreateInvalid(t *testing.T) {
+	c := newTestClient(t, newTestAPI())
+	_, err := c.Create(context.Background(), &fair.Model{District: "VILA FORMOSA"})
+	if !errors.Is(err, fair.ErrInvalidStreetFair) {
+		t.Errorf("got %v; want %v", err, fair.ErrInvalidStreetFair)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+		t.Errorf("got %v; want an *Error with status %d", err, http.StatusBadRequest)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var testCases = []struct {
+		title            string
+		failures         int
+		expectedRequests int
+		expectedErr      error
+	}{
+		{"Without Failures", 0, 1, nil},
+		{"Recovering", 2, 3, nil},
+		{"Exhausting Retries", 5, 3, fair.ErrInternal},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				requests int
+				keys     = make(map[string]bool)
+			)
+			api := newTestAPI()
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests++
+				n := requests
+				keys[r.Header.Get("Idempotency-Key")] = true
+				mu.Unlock()
+				if n <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				api.ServeHTTP(w, r)
+			}))
+
+			_, err := c.Create(context.Background(), &fair.Model{Registry: "4041-0"})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("got %v; want %v", err, tt.expectedErr)
+			}
+			if requests != tt.expectedRequests {
+				t.Errorf("got %d requests; want %d", requests, tt.expectedRequests)
+			}
+			if len(keys) != 1 {
+				t.Errorf("got %d idempotency keys; want 1", len(keys))
+			}
+		})
+	}
+}
+
+func TestIterator(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, newTestAPI())
+	for _, registry := range []string{"4041-0", "4045-2", "1234-5"} {
+		if _, err := c.Create(ctx, &fair.Model{Registry: registry}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	it := c.Iter(ctx, Filters{})
+	for it.Next() {
+		seen[it.Model().Registry] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 3 {
+		t.Errorf("got %d street fairs; want 3", len(seen))
+	}
+}
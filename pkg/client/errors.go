@@ -0,0 +1,57 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+// Error is an error response of the API, it wraps the fair error of
+// its status so callers can check it with errors.Is
+type Error struct {
+	Status int
+	Msg    string
+	err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func errByStatus(status int) error {
+	switch status {
+	case http.StatusNotFound:
+		return fair.ErrNotFound
+	case http.StatusBadRequest:
+		return fair.ErrInvalidStreetFair
+	case http.StatusPreconditionFailed:
+		return fair.ErrVersionMismatch
+	case http.StatusPreconditionRequired:
+		return fair.ErrPreconditionRequired
+	}
+	if status >= http.StatusInternalServerError {
+		return fair.ErrInternal
+	}
+	return nil
+}
+
+func newError(resp *http.Response) error {
+	e := &Error{Status: resp.StatusCode, err: errByStatus(resp.StatusCode)}
+	body, _ := ioutil.ReadAll(resp.Body)
+	var msg struct {
+		Msg string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &msg); err == nil && msg.Msg != "" {
+		e.Msg = msg.Msg
+	} else {
+		e.Msg = string(body)
+	}
+	return e
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+// Iterator walks the street fairs of a listing:
+//
+//	it := c.Iter(ctx, client.Filters{District: "IGUATEMI"})
+//	for it.Next() {
+//		fmt.Println(it.Model().Name)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// The API has no pagination yet so the listing is fetched on the first
+// Next, callers don't depend on it to keep working once pages exist
+type Iterator struct {
+	ctx     context.Context
+	c       *Client
+	filters Filters
+	models  []fair.Model
+	fetched bool
+	pos     int
+	err     error
+}
+
+// Next advances to the next street fair, false when there are no
+// more of them or an error happened (see Err)
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.fetched {
+		it.fetched = true
+		if it.models, it.err = it.c.All(it.ctx, it.filters); it.err != nil {
+			return false
+		}
+	} else {
+		it.pos++
+	}
+	return it.pos < len(it.models)
+}
+
+// Model returns the current street fair
+func (it *Iterator) Model() *fair.Model {
+	return &it.models[it.pos]
+}
+
+// Err returns the error that stopped the iteration
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Iter returns an Iterator of the street fairs matching filters
+func (c *Client) Iter(ctx context.Context, filters Filters) *Iterator {
+	return &Iterator{ctx: ctx, c: c, filters: filters}
+}
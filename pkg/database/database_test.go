@@ -0,0 +1,110 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	var testCases = []struct {
+		title    string
+		conf     *Config
+		expected string
+	}{
+		{
+			"Fields",
+			&Config{Host: "db", Port: 5433, User: "u", Password: "p", DBName: "n", SSLMode: "disable", ConnectTimeout: 5},
+			"host=db port=5433 user=u password=p dbname=n sslmode=disable connect_timeout=5",
+		},
+		{
+			"Fields With Statement Timeout",
+			&Config{Host: "db", Port: 5432, User: "u", Password: "p", DBName: "n", SSLMode: "disable", ConnectTimeout: 5, StatementTimeout: 3 * time.Second},
+			"host=db port=5432 user=u password=p dbname=n sslmode=disable connect_timeout=5 statement_timeout=3000",
+		},
+		{
+			"URL",
+			&Config{URL: "postgres://u:p@db:5432/n?sslmode=disable", Host: "ignored"},
+			"postgres://u:p@db:5432/n?sslmode=disable",
+		},
+		{
+			"URL With Statement Timeout",
+			&Config{URL: "postgres://u:p@db:5432/n", StatementTimeout: time.Second},
+			"postgres://u:p@db:5432/n?statement_timeout=1000",
+		},
+		{
+			"Key Value URL With Statement Timeout",
+			&Config{URL: "host=db user=u", StatementTimeout: time.Second},
+			"host=db user=u statement_timeout=1000",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			actual, err := postgresDSN(tt.conf)
+			if err != nil {
+				t.Fatalf("got %+v; want <nil>", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("got %s; want %s", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	var testCases = []struct {
+		title    string
+		conf     *Config
+		expected string
+	}{
+		{"Default", &Config{DBName: "streetfair", ConnectTimeout: 5}, "streetfair.db?_busy_timeout=5000"},
+		{"URL", &Config{URL: "/tmp/fair.db?cache=shared", ConnectTimeout: 1}, "/tmp/fair.db?cache=shared&_busy_timeout=1000"},
+		{"Busy Timeout", &Config{URL: "fair.db?_busy_timeout=10"}, "fair.db?_busy_timeout=10"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			if actual := sqliteDSN(tt.conf); actual != tt.expected {
+				t.Errorf("got %s; want %s", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var testCases = []struct {
+		title     string
+		conf      *Config
+		expectErr bool
+	}{
+		{"SQLite", &Config{Driver: "sqlite", URL: filepath.Join(t.TempDir(), "fair.db"), LogLevel: "silent", MaxOpenConns: 2}, false},
+		{"Unknown Driver", &Config{Driver: "mysql", LogLevel: "warn"}, true},
+		{"Unknown Log Level", &Config{Driver: "sqlite", LogLevel: "debug"}, true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			db, err := Open(tt.conf, logrus.New())
+			if tt.expectErr {
+				if err == nil {
+					t.Error("got <nil>; want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %+v; want <nil>", err)
+			}
+
+			sqlDB, err := db.DB()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := sqlDB.Stats().MaxOpenConnections; actual != tt.conf.MaxOpenConns {
+				t.Errorf("got %d; want %d", actual, tt.conf.MaxOpenConns)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type ReplicasConfig struct {
+	// URLs are the DSNs of the read replicas, with the same driver
+	// and pool settings of the primary
+	URLs          []string      `envconfig:"replica_urls"`
+	CheckInterval time.Duration `default:"10s" envconfig:"replica_check_interval"`
+}
+
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// Cluster routes reads to the healthy replicas (round robin)
+// and writes to the primary
+type Cluster struct {
+	primary       *gorm.DB
+	replicas      []*replica
+	next          uint32
+	checkInterval time.Duration
+	log           *logrus.Logger
+}
+
+// Primary returns the database for writes (and reads that must see them)
+func (c *Cluster) Primary() *gorm.DB {
+	return c.primary
+}
+
+// Replica returns a healthy replica, or the primary when there is none
+func (c *Cluster) Replica() *gorm.DB {
+	n := len(c.replicas)
+	start := atomic.AddUint32(&c.next, 1)
+	for i := 0; i < n; i++ {
+		if r := c.replicas[(int(start)+i)%n]; r.isHealthy() {
+			return r.db
+		}
+	}
+	return c.primary
+}
+
+// CheckReplicas pings every replica, ejecting the unreachable ones and
+// bringing back the recovered ones, it fails if some replica is down
+func (c *Cluster) CheckReplicas(ctx context.Context) error {
+	var down int
+	for _, r := range c.replicas {
+		err := Ping(r.db)(ctx)
+		healthy := int32(1)
+		if err != nil {
+			healthy = 0
+			down++
+		}
+		if old := atomic.SwapInt32(&r.healthy, healthy); old != healthy {
+			entry := c.log.WithField("replica", r.name)
+			if err != nil {
+				entry.Warningf("Ejecting replica: %+v", err)
+			} else {
+				entry.Info("Replica is back")
+			}
+		}
+	}
+	if down > 0 {
+		return fmt.Errorf("%d of %d replicas are down", down, len(c.replicas))
+	}
+	return nil
+}
+
+// Watch checks the replicas periodically until ctx is done
+func (c *Cluster) Watch(ctx context.Context) {
+	if len(c.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(c.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = c.CheckReplicas(ctx)
+		}
+	}
+}
+
+// NewCluster connects to the primary and the replicas configured
+// by the `FAIR_DATABASE_*` env vars
+func NewCluster(log *logrus.Logger) (*Cluster, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_database", conf); err != nil {
+		return nil, err
+	}
+	replicasConf := new(ReplicasConfig)
+	if err := envconfig.Process("fair_database", replicasConf); err != nil {
+		return nil, err
+	}
+
+	primary, err := Open(conf, log)
+	if err != nil {
+		return nil, err
+	}
+	return OpenCluster(primary, conf, replicasConf, log)
+}
+
+// OpenCluster connects to the replicas of primary
+func OpenCluster(primary *gorm.DB, conf *Config, replicasConf *ReplicasConfig, log *logrus.Logger) (*Cluster, error) {
+	c := &Cluster{
+		primary:       primary,
+		checkInterval: replicasConf.CheckInterval,
+		log:           log,
+	}
+	for i, url := range replicasConf.URLs {
+		replicaConf := *conf
+		replicaConf.URL = url
+		db, err := Open(&replicaConf, log)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		c.replicas = append(c.replicas, &replica{
+			name:    fmt.Sprintf("replica-%d", i),
+			db:      db,
+			healthy: 1,
+		})
+	}
+	return c, nil
+}
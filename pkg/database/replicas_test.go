@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestCluster(t *testing.T, replicas int) *Cluster {
+	dir := t.TempDir()
+	conf := &Config{Driver: "sqlite", URL: filepath.Join(dir, "primary.db"), LogLevel: "silent"}
+	primary, err := Open(conf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replicasConf := &ReplicasConfig{}
+	for i := 0; i < replicas; i++ {
+		replicasConf.URLs = append(replicasConf.URLs, filepath.Join(dir, "replica"+string(rune('0'+i))+".db"))
+	}
+	c, err := OpenCluster(primary, conf, replicasConf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClusterWithoutReplicas(t *testing.T) {
+	c := newTestCluster(t, 0)
+
+	if c.Replica() != c.Primary() {
+		t.Error("got a replica; want the primary")
+	}
+	if err := c.CheckReplicas(context.Background()); err != nil {
+		t.Errorf("got %+v; want <nil>", err)
+	}
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	c := newTestCluster(t, 2)
+
+	first, second := c.Replica(), c.Replica()
+	if first == c.Primary() || second == c.Primary() {
+		t.Fatal("got the primary; want a replica")
+	}
+	if first == second {
+		t.Error("got the same replica twice; want round robin")
+	}
+}
+
+func TestClusterEjection(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t, 2)
+
+	sqlDB, err := c.replicas[0].db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.CheckReplicas(ctx); err == nil {
+		t.Error("got <nil>; want replicas down error")
+	}
+	for i := 0; i < 4; i++ {
+		if actual := c.Replica(); actual != c.replicas[1].db {
+			t.Fatalf("got %p; want the healthy replica %p", actual, c.replicas[1].db)
+		}
+	}
+
+	sqlDB, err = c.replicas[1].db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckReplicas(ctx); err == nil {
+		t.Error("got <nil>; want replicas down error")
+	}
+	if c.Replica() != c.Primary() {
+		t.Error("got a replica; want the primary")
+	}
+}
@@ -0,0 +1,355 @@
+package fair
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// insertSize is the number of street fairs of each INSERT of a batch, so
+// the statements stay under the limit of parameters of the databases
+const insertSize = 1000
+
+// Change is the outcome of an upsert
+type Change int
+
+const (
+	Unchanged Change = iota
+	Created
+	Updated
+)
+
+// UpsertResult is the outcome of the upsert of a street fair
+type UpsertResult struct {
+	Change Change
+	Err    error
+}
+
+// Batch creates the street fairs in batches, see Batcher
+type Batch interface {
+	// Create creates models at once. When it fails each model is created on
+	// its own to pinpoint the bad ones, the result has the error of each
+	// model (nil when every one was created)
+	Create(models []*Model) []error
+	// Upsert creates the new street fairs of models (or the ones deleted by
+	// a sync) and updates the changed ones, incrementing their version. As
+	// Create, a failure is retried one by one
+	Upsert(models []*Model) []UpsertResult
+	// DeleteMissing soft deletes the street fairs whose registries aren't
+	// kept, returning how many were deleted
+	DeleteMissing(keep map[string]bool) (int, error)
+	// Commit ends the batch. When atomic the street fairs are only stored
+	// now, unless some Create failed (rolling back all of them with ErrAborted)
+	Commit() error
+	// Rollback discards the street fairs of an atomic batch
+	Rollback() error
+}
+
+// Batcher is implemented by the StreetFair implementations able to create
+// many street fairs at once. An atomic batch runs in a single transaction,
+// otherwise each call of Create is committed on its own
+type Batcher interface {
+	Batch(atomic bool) (Batch, error)
+}
+
+// dataColumns are the columns of a street fair set by an upsert
+var dataColumns = []string{
+	"longitude", "latitude", "setcens", "areap", "cod_district", "district",
+	"cod_sub_city_hall", "sub_city_hall", "region5", "region8", "name",
+	"address", "address_number", "neighborhood", "landmark",
+}
+
+func registries(models []*Model) []string {
+	regs := make([]string, len(models))
+	for i, m := range models {
+		regs[i] = m.Registry
+	}
+	return regs
+}
+
+// createModels inserts models with their events on tx
+func createModels(tx *gorm.DB, models []*Model) error {
+	rows := make([]eventRow, len(models))
+	for i, m := range models {
+		if m.Registry == "" {
+			return ErrInvalidStreetFair
+		}
+		m.Version = 1
+		r, err := newEventRow(EventCreated, m.Registry, m)
+		if err != nil {
+			return err
+		}
+		rows[i] = r
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	if err := purgeDeleted(tx, registries(models)...); err != nil {
+		return err
+	}
+	if err := tx.CreateInBatches(models, insertSize).Error; err != nil {
+		return err
+	}
+	first, err := nextEventIDs(tx, len(rows))
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		rows[i].ID = first + int64(i)
+	}
+	return tx.CreateInBatches(rows, insertSize).Error
+}
+
+// upsertModels creates or updates models on tx, setting the change of
+// each one on results
+func upsertModels(tx *gorm.DB, models []*Model, results []UpsertResult) error {
+	for _, m := range models {
+		if m.Registry == "" {
+			return ErrInvalidStreetFair
+		}
+	}
+	current, err := stored(tx, models)
+	if err != nil {
+		return err
+	}
+
+	var created []*Model
+	for i, m := range models {
+		cur, ok := current[m.Registry]
+		switch {
+		case !ok:
+			created = append(created, m)
+			results[i].Change = Created
+		case len(changedFields(cur, m)) == 0:
+			*m = *cur
+			results[i].Change = Unchanged
+		default:
+			r := tx.Model(&Model{}).Where("registry = ?", m.Registry).Select(append(dataColumns, "updated_at")).Updates(m)
+			if r.Error != nil {
+				return r.Error
+			}
+			r = tx.Model(&Model{}).Where("registry = ?", m.Registry).
+				UpdateColumn("version", gorm.Expr("version + 1"))
+			if r.Error != nil {
+				return r.Error
+			}
+			if err := tx.Where("registry = ?", m.Registry).First(m).Error; err != nil {
+				return err
+			}
+			if err := appendEvent(tx, EventUpdated, m.Registry, m); err != nil {
+				return err
+			}
+			results[i].Change = Updated
+		}
+	}
+	return createModels(tx, created)
+}
+
+type dbBatch struct {
+	s *sf
+	// tx is the transaction of the atomic batch
+	tx     *gorm.DB
+	failed bool
+}
+
+func (b *dbBatch) db() *gorm.DB {
+	if b.tx != nil {
+		return b.tx
+	}
+	return b.s.db
+}
+
+func (b *dbBatch) Create(models []*Model) []error {
+	// the nested transactions of an atomic batch are savepoints, a failure
+	// doesn't abort the whole transaction
+	err := b.db().Transaction(func(tx *gorm.DB) error {
+		return createModels(tx, models)
+	})
+	if err == nil {
+		return nil
+	}
+
+	errs := make([]error, len(models))
+	var failed bool
+	for i := range models {
+		err := b.db().Transaction(func(tx *gorm.DB) error {
+			return createModels(tx, models[i:i+1])
+		})
+		if errors.Is(err, ErrInvalidStreetFair) {
+			errs[i] = err
+		} else if err != nil {
+			b.s.log.WithField("model", models[i]).
+				Errorf("Creating a new street fair: %+v", err)
+			errs[i] = ErrInternal
+		}
+		failed = failed || errs[i] != nil
+	}
+	if !failed {
+		return nil
+	}
+	b.failed = true
+	return errs
+}
+
+func (b *dbBatch) Upsert(models []*Model) []UpsertResult {
+	results := make([]UpsertResult, len(models))
+	err := b.db().Transaction(func(tx *gorm.DB) error {
+		return upsertModels(tx, models, results)
+	})
+	if err == nil {
+		return results
+	}
+
+	for i := range models {
+		results[i] = UpsertResult{}
+		err := b.db().Transaction(func(tx *gorm.DB) error {
+			return upsertModels(tx, models[i:i+1], results[i:i+1])
+		})
+		if errors.Is(err, ErrInvalidStreetFair) {
+			results[i].Err = err
+		} else if err != nil {
+			b.s.log.WithField("model", models[i]).
+				Errorf("Upserting a street fair: %+v", err)
+			results[i].Err = ErrInternal
+		}
+		b.failed = b.failed || results[i].Err != nil
+	}
+	return results
+}
+
+func (b *dbBatch) DeleteMissing(keep map[string]bool) (int, error) {
+	missing, err := missing(b.db(), keep)
+	if err != nil {
+		b.s.log.Errorf("Listing the missing street fairs: %+v", err)
+		return 0, ErrInternal
+	}
+
+	var deleted int
+	for start := 0; start < len(missing); start += insertSize {
+		end := start + insertSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		chunk := missing[start:end]
+		err := b.db().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("registry IN ?", chunk).Delete(&Model{}).Error; err != nil {
+				return err
+			}
+			for _, registry := range chunk {
+				if err := appendEvent(tx, EventDeleted, registry, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.s.log.WithField("registries", chunk).
+				Errorf("Deleting the missing street fairs: %+v", err)
+			return deleted, ErrInternal
+		}
+		deleted += len(chunk)
+	}
+	return deleted, nil
+}
+
+func (b *dbBatch) Commit() error {
+	if b.tx == nil {
+		return nil
+	}
+	if b.failed {
+		_ = b.Rollback()
+		return ErrAborted
+	}
+	if err := b.tx.Commit().Error; err != nil {
+		b.s.log.Errorf("Committing a batch of street fairs: %+v", err)
+		return ErrInternal
+	}
+	return nil
+}
+
+func (b *dbBatch) Rollback() error {
+	if b.tx == nil {
+		return nil
+	}
+	return b.tx.Rollback().Error
+}
+
+func (s *sf) Batch(atomic bool) (Batch, error) {
+	if !atomic {
+		return &dbBatch{s: s}, nil
+	}
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		s.log.Errorf("Starting a batch of street fairs: %+v", tx.Error)
+		return nil, ErrInternal
+	}
+	return &dbBatch{s: s, tx: tx}, nil
+}
+
+// hookedBatch calls after once the street fairs of a batch are stored
+type hookedBatch struct {
+	Batch
+	atomic bool
+	after  func()
+}
+
+func (h *hookedBatch) Create(models []*Model) []error {
+	errs := h.Batch.Create(models)
+	if h.atomic {
+		return errs
+	}
+	created := len(models)
+	for _, err := range errs {
+		if err != nil {
+			created--
+		}
+	}
+	if created > 0 {
+		h.after()
+	}
+	return errs
+}
+
+func (h *hookedBatch) Upsert(models []*Model) []UpsertResult {
+	results := h.Batch.Upsert(models)
+	if h.atomic {
+		return results
+	}
+	for _, r := range results {
+		if r.Err == nil && r.Change != Unchanged {
+			h.after()
+			break
+		}
+	}
+	return results
+}
+
+func (h *hookedBatch) DeleteMissing(keep map[string]bool) (int, error) {
+	deleted, err := h.Batch.DeleteMissing(keep)
+	if deleted > 0 && !h.atomic {
+		h.after()
+	}
+	return deleted, err
+}
+
+func (h *hookedBatch) Commit() error {
+	err := h.Batch.Commit()
+	if err == nil && h.atomic {
+		h.after()
+	}
+	return err
+}
+
+// newHookedBatch returns a Batch of sf calling after when the street
+// fairs are stored, or ErrInvalidOperation when sf isn't a Batcher
+func newHookedBatch(sf StreetFair, atomic bool, after func()) (Batch, error) {
+	batcher, ok := sf.(Batcher)
+	if !ok {
+		return nil, ErrInvalidOperation
+	}
+	b, err := batcher.Batch(atomic)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedBatch{Batch: b, atomic: atomic, after: after}, nil
+}
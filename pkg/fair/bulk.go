@@ -0,0 +1,104 @@
+package fair
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+var (
+	ErrInvalidOperation = errors.New("Invalid bulk operation")
+	ErrAborted          = errors.New("Aborted by the failure of another operation")
+)
+
+// Operation is a single change of a bulk request, `Version` is the
+// required version of update and delete (zero means any version)
+type Operation struct {
+	Op       string `json:"op"`
+	Registry string `json:"registry,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	Model    *Model `json:"model,omitempty"`
+}
+
+// OperationResult is the outcome of an Operation, Model is
+// the stored street fair after creates and updates
+type OperationResult struct {
+	Model *Model
+	Err   error
+}
+
+func (op *Operation) registry() string {
+	if op.Registry == "" && op.Model != nil {
+		return op.Model.Registry
+	}
+	return op.Registry
+}
+
+func (s *sf) apply(op *Operation) (*Model, error) {
+	switch op.Op {
+	case OpCreate:
+		if op.Model == nil {
+			return nil, ErrInvalidOperation
+		}
+		return s.Create(op.Model)
+	case OpUpdate:
+		if op.Model == nil {
+			return nil, ErrInvalidOperation
+		}
+		op.Model.Registry = op.registry()
+		op.Model.Version = op.Version
+		if err := s.Update(op.Model); err != nil {
+			return nil, err
+		}
+		return op.Model, nil
+	case OpDelete:
+		if op.registry() == "" {
+			return nil, ErrInvalidOperation
+		}
+		return nil, s.Delete(op.registry(), op.Version)
+	}
+	return nil, ErrInvalidOperation
+}
+
+// Bulk applies ops in order. When atomic, every operation runs in a single
+// transaction and a failure rolls back all of them (the others result in
+// ErrAborted), otherwise each one is applied on its own (best-effort)
+func (s *sf) Bulk(ops []Operation, atomic bool) []OperationResult {
+	results := make([]OperationResult, len(ops))
+	if !atomic {
+		for i := range ops {
+			results[i].Model, results[i].Err = s.apply(&ops[i])
+		}
+		return results
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		txSF := &sf{db: tx, log: s.log}
+		txSF.replica = txSF.primary
+		for i := range ops {
+			m, err := txSF.apply(&ops[i])
+			if err != nil {
+				results[i].Err = err
+				return err
+			}
+			results[i].Model = m
+		}
+		return nil
+	})
+	if err == nil {
+		return results
+	}
+
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = OperationResult{Err: ErrAborted}
+		}
+	}
+	return results
+}
@@ -0,0 +1,182 @@
+package fair
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/cache"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// generationKey holds a token that is part of every cached key,
+// changing it on mutations invalidates all cached results at once
+const generationKey = "fair:generation"
+
+type cachedSF struct {
+	seq     uint64 // first field to keep the 64-bit alignment of atomic ops
+	sf      StreetFair
+	backend cache.Backend
+	ttl     time.Duration
+	group   singleflight.Group
+	log     *logrus.Logger
+}
+
+func (c *cachedSF) generation() string {
+	if gen, ok := c.backend.Get(generationKey); ok {
+		return string(gen)
+	}
+	return c.invalidate()
+}
+
+func (c *cachedSF) invalidate() string {
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36) + "." +
+		strconv.FormatUint(atomic.AddUint64(&c.seq, 1), 36)
+	c.backend.Set(generationKey, []byte(gen), 0)
+	return gen
+}
+
+// load returns the cached value of key or, once for every concurrent
+// caller, stores the result of fn
+func (c *cachedSF) load(key string, dst interface{}, fn func() (interface{}, error)) error {
+	if data, ok := c.backend.Get(key); ok {
+		if err := json.Unmarshal(data, dst); err == nil {
+			return nil
+		}
+		c.log.WithField("key", key).Warning("Invalid cached street fair")
+	}
+
+	data, err, _ := c.group.Do(key, func() (interface{}, error) {
+		v, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		c.backend.Set(key, data, c.ttl)
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data.([]byte), dst)
+}
+
+func (c *cachedSF) Create(model *Model) (*Model, error) {
+	m, err := c.sf.Create(model)
+	if err == nil {
+		c.invalidate()
+	}
+	return m, err
+}
+
+func (c *cachedSF) All(filters map[string]string) ([]Model, error) {
+	values := url.Values{}
+	for k, v := range filters {
+		if v != "" {
+			values.Set(k, v)
+		}
+	}
+	key := "fair:" + c.generation() + ":all:" + values.Encode()
+
+	var models []Model
+	err := c.load(key, &models, func() (interface{}, error) {
+		return c.sf.All(filters)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+func (c *cachedSF) Delete(registry string, version int64) error {
+	err := c.sf.Delete(registry, version)
+	if err == nil {
+		c.invalidate()
+	}
+	return err
+}
+
+func (c *cachedSF) Update(model *Model) error {
+	err := c.sf.Update(model)
+	if err == nil {
+		c.invalidate()
+	}
+	return err
+}
+
+func (c *cachedSF) Bulk(ops []Operation, atomic bool) []OperationResult {
+	results := c.sf.Bulk(ops, atomic)
+	for _, r := range results {
+		if r.Err == nil {
+			c.invalidate()
+			break
+		}
+	}
+	return results
+}
+
+func (c *cachedSF) Get(registry string) (*Model, error) {
+	key := "fair:" + c.generation() + ":get:" + registry
+
+	var model Model
+	err := c.load(key, &model, func() (interface{}, error) {
+		return c.sf.Get(registry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model, nil
+}
+
+// Query runs q on the wrapped StreetFair, the queries aren't cached
+func (c *cachedSF) Query(q *Query) ([]Model, error) {
+	return RunQuery(c.sf, q)
+}
+
+// Batch invalidates the cached results once the street fairs of the
+// batch are stored
+func (c *cachedSF) Batch(atomic bool) (Batch, error) {
+	return newHookedBatch(c.sf, atomic, func() { c.invalidate() })
+}
+
+// Diff compares to the street fairs of the wrapped StreetFair, when it's a Differ
+func (c *cachedSF) Diff(models []*Model) ([]ModelDiff, error) {
+	if d, ok := c.sf.(Differ); ok {
+		return d.Diff(models)
+	}
+	return nil, ErrInvalidOperation
+}
+
+// Missing lists the street fairs of the wrapped StreetFair, when it's a Differ
+func (c *cachedSF) Missing(keep map[string]bool) ([]string, error) {
+	if d, ok := c.sf.(Differ); ok {
+		return d.Missing(keep)
+	}
+	return nil, ErrInvalidOperation
+}
+
+// Primary bypasses the cache, reading from the primary database when
+// the wrapped StreetFair supports it
+func (c *cachedSF) Primary() StreetFair {
+	if p, ok := c.sf.(PrimaryReader); ok {
+		return p.Primary()
+	}
+	return c.sf
+}
+
+// NewCached returns a StreetFair caching the results of `Get` and `All`
+// of sf on backend for ttl, every mutation invalidates the cached results
+func NewCached(sf StreetFair, backend cache.Backend, ttl time.Duration, log *logrus.Logger) StreetFair {
+	return &cachedSF{
+		sf:      sf,
+		backend: backend,
+		ttl:     ttl,
+		log:     log,
+	}
+}
@@ -0,0 +1,151 @@
+package fair
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/cache"
+	"github.com/sirupsen/logrus"
+)
+
+type countingStreetFair struct {
+	fakeStreetFair
+	gets  int32
+	alls  int32
+	delay time.Duration
+}
+
+func (f *countingStreetFair) Get(registry string) (*Model, error) {
+	atomic.AddInt32(&f.gets, 1)
+	time.Sleep(f.delay)
+	return f.fakeStreetFair.Get(registry)
+}
+
+func (f *countingStreetFair) All(filters map[string]string) ([]Model, error) {
+	atomic.AddInt32(&f.alls, 1)
+	return f.fakeStreetFair.All(filters)
+}
+
+func TestCachedGet(t *testing.T) {
+	fsf := &countingStreetFair{fakeStreetFair: fakeStreetFair{getReturn: fakeModel("4041-0")}}
+	c := NewCached(fsf, cache.NewLRU(10), time.Minute, logrus.New())
+
+	for i := 0; i < 3; i++ {
+		m, err := c.Get("4041-0")
+		if err != nil {
+			t.Fatalf("got %+v; want <nil>", err)
+		}
+		if m.Registry != "4041-0" {
+			t.Errorf("got %s; want 4041-0", m.Registry)
+		}
+	}
+	if actual := atomic.LoadInt32(&fsf.gets); actual != 1 {
+		t.Errorf("got %d calls; want 1", actual)
+	}
+
+	if _, err := c.Get("9999-1"); err != nil {
+		t.Fatal(err)
+	}
+	if actual := atomic.LoadInt32(&fsf.gets); actual != 2 {
+		t.Errorf("got %d calls; want 2", actual)
+	}
+}
+
+func TestCachedGetNotFound(t *testing.T) {
+	fsf := &countingStreetFair{fakeStreetFair: fakeStreetFair{getErr: ErrNotFound}}
+	c := NewCached(fsf, cache.NewLRU(10), time.Minute, logrus.New())
+
+	if _, err := c.Get("9999-1"); err != ErrNotFound {
+		t.Errorf("got %+v; want ErrNotFound", err)
+	}
+}
+
+func TestCachedAllFilters(t *testing.T) {
+	fsf := &countingStreetFair{fakeStreetFair: fakeStreetFair{allReturn: []Model{*fakeModel("4041-0")}}}
+	c := NewCached(fsf, cache.NewLRU(10), time.Minute, logrus.New())
+
+	filters := []map[string]string{
+		{"district": "VILA FORMOSA", "name": ""},
+		{"district": "VILA FORMOSA"},
+		{"district": "MORUMBI"},
+	}
+	for _, f := range filters {
+		models, err := c.All(f)
+		if err != nil {
+			t.Fatalf("got %+v; want <nil>", err)
+		}
+		if actual := len(models); actual != 1 {
+			t.Errorf("got %d; want 1", actual)
+		}
+	}
+	if actual := atomic.LoadInt32(&fsf.alls); actual != 2 {
+		t.Errorf("got %d calls; want 2", actual)
+	}
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	var mutations = []struct {
+		title  string
+		mutate func(sf StreetFair) error
+	}{
+		{"Create", func(sf StreetFair) error { _, err := sf.Create(fakeModel("4041-0")); return err }},
+		{"Update", func(sf StreetFair) error { return sf.Update(fakeModel("4041-0")) }},
+		{"Delete", func(sf StreetFair) error { return sf.Delete("4041-0", 0) }},
+	}
+
+	for _, tt := range mutations {
+		t.Run(tt.title, func(t *testing.T) {
+			fsf := &countingStreetFair{fakeStreetFair: fakeStreetFair{getReturn: fakeModel("4041-0")}}
+			c := NewCached(fsf, cache.NewLRU(10), time.Minute, logrus.New())
+
+			if _, err := c.Get("4041-0"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.All(map[string]string{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.mutate(c); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Get("4041-0"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.All(map[string]string{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := atomic.LoadInt32(&fsf.gets); actual != 2 {
+				t.Errorf("got %d gets; want 2", actual)
+			}
+			if actual := atomic.LoadInt32(&fsf.alls); actual != 2 {
+				t.Errorf("got %d alls; want 2", actual)
+			}
+		})
+	}
+}
+
+func TestCachedStampede(t *testing.T) {
+	fsf := &countingStreetFair{
+		fakeStreetFair: fakeStreetFair{getReturn: fakeModel("4041-0")},
+		delay:          50 * time.Millisecond,
+	}
+	c := NewCached(fsf, cache.NewLRU(10), time.Minute, logrus.New())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Get("4041-0"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if actual := atomic.LoadInt32(&fsf.gets); actual != 1 {
+		t.Errorf("got %d calls; want 1", actual)
+	}
+}
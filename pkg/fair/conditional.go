@@ -0,0 +1,103 @@
+package fair
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrPreconditionRequired = errors.New("Header `If-Match` is required")
+
+// modelETag is the strong ETag of a street fair, its version and identity,
+// as the versions restart when a street fair is deleted and created again
+func modelETag(m *Model) string {
+	return fmt.Sprintf(`"%d-%s"`, m.Version, modelIdentity(m))
+}
+
+// modelIdentity tells apart the street fairs of a registry by their creation,
+// in microseconds as stored by the databases
+func modelIdentity(m *Model) string {
+	created := m.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+	sum := sha1.Sum([]byte(m.Registry + "\x00" + created))
+	return hex.EncodeToString(sum[:8])
+}
+
+// listETag is the strong ETag of an encoded list of street fairs
+func listETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func setValidators(w http.ResponseWriter, etag string, modified time.Time) {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// etagMatch compares etag with the values of If-None-Match (weak comparison)
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the validators on w and, when the conditions of the request
+// match them, responds with `304 Not Modified`. `If-None-Match` takes precedence
+// over `If-Modified-Since`
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	setValidators(w, etag, modified)
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatch(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || modified.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ifMatchVersion returns the street fair version required by `If-Match`,
+// zero means any version (`If-Match: *`), and the identity of the street
+// fair when the header has its ETag instead of only the version
+func ifMatchVersion(r *http.Request) (int64, string, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" {
+		return 0, "", ErrPreconditionRequired
+	} else if h == "*" {
+		return 0, "", nil
+	}
+	if !strings.HasPrefix(h, `"`) || !strings.HasSuffix(h, `"`) {
+		return 0, "", ErrVersionMismatch
+	}
+
+	tag, identity := strings.Trim(h, `"`), ""
+	if i := strings.Index(tag, "-"); i >= 0 {
+		tag, identity = tag[:i], tag[i+1:]
+		if identity == "" {
+			return 0, "", ErrVersionMismatch
+		}
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, "", ErrVersionMismatch
+	}
+	return version, identity, nil
+}
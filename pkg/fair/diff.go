@@ -0,0 +1,118 @@
+package fair
+
+import "gorm.io/gorm"
+
+// FieldChange is a field of a street fair changed by an upsert
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// ModelDiff is the change an upsert of a street fair would make
+type ModelDiff struct {
+	Registry string        `json:"registry"`
+	Change   Change        `json:"-"`
+	Fields   []FieldChange `json:"fields,omitempty"`
+}
+
+// Differ is implemented by the StreetFair implementations able to compare
+// street fairs to the stored ones, without writing
+type Differ interface {
+	// Diff returns what the upsert of models would change on each one
+	Diff(models []*Model) ([]ModelDiff, error)
+	// Missing returns the registries of the street fairs that aren't kept
+	Missing(keep map[string]bool) ([]string, error)
+}
+
+// dataFields are the fields of a street fair set by an upsert, by their
+// JSON names
+var dataFields = []struct {
+	name  string
+	value func(m *Model) interface{}
+}{
+	{"longitude", func(m *Model) interface{} { return m.Longitude }},
+	{"latitude", func(m *Model) interface{} { return m.Latitude }},
+	{"setcens", func(m *Model) interface{} { return m.Setcens }},
+	{"areap", func(m *Model) interface{} { return m.Areap }},
+	{"cod_district", func(m *Model) interface{} { return m.CodDistrict }},
+	{"district", func(m *Model) interface{} { return m.District }},
+	{"cod_sub_city_hall", func(m *Model) interface{} { return m.CodSubCityHall }},
+	{"sub_city_hall", func(m *Model) interface{} { return m.SubCityHall }},
+	{"region_5", func(m *Model) interface{} { return m.Region5 }},
+	{"region_8", func(m *Model) interface{} { return m.Region8 }},
+	{"name", func(m *Model) interface{} { return m.Name }},
+	{"address", func(m *Model) interface{} { return m.Address }},
+	{"address_number", func(m *Model) interface{} { return m.AddressNumber }},
+	{"neighborhood", func(m *Model) interface{} { return m.Neighborhood }},
+	{"landmark", func(m *Model) interface{} { return m.Landmark }},
+}
+
+// changedFields returns the fields of current changed by m
+func changedFields(current, m *Model) []FieldChange {
+	var changes []FieldChange
+	for _, f := range dataFields {
+		if old, new := f.value(current), f.value(m); old != new {
+			changes = append(changes, FieldChange{Field: f.name, Old: old, New: new})
+		}
+	}
+	return changes
+}
+
+// stored returns the stored street fairs of models by registry
+func stored(db *gorm.DB, models []*Model) (map[string]*Model, error) {
+	var rows []Model
+	if err := db.Where("registry IN ?", registries(models)).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	current := make(map[string]*Model, len(rows))
+	for i := range rows {
+		current[rows[i].Registry] = &rows[i]
+	}
+	return current, nil
+}
+
+// missing returns the stored registries that aren't kept
+func missing(db *gorm.DB, keep map[string]bool) ([]string, error) {
+	var registries []string
+	if err := db.Model(&Model{}).Order("registry").Pluck("registry", &registries).Error; err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, registry := range registries {
+		if !keep[registry] {
+			missing = append(missing, registry)
+		}
+	}
+	return missing, nil
+}
+
+func (s *sf) Diff(models []*Model) ([]ModelDiff, error) {
+	current, err := stored(s.replica(), models)
+	if err != nil {
+		s.log.Errorf("Diffing street fairs: %+v", err)
+		return nil, ErrInternal
+	}
+	diffs := make([]ModelDiff, len(models))
+	for i, m := range models {
+		diffs[i].Registry = m.Registry
+		cur, ok := current[m.Registry]
+		if !ok {
+			diffs[i].Change = Created
+			continue
+		}
+		if diffs[i].Fields = changedFields(cur, m); len(diffs[i].Fields) > 0 {
+			diffs[i].Change = Updated
+		}
+	}
+	return diffs, nil
+}
+
+func (s *sf) Missing(keep map[string]bool) ([]string, error) {
+	registries, err := missing(s.replica(), keep)
+	if err != nil {
+		s.log.Errorf("Listing the missing street fairs: %+v", err)
+		return nil, ErrInternal
+	}
+	return registries, nil
+}
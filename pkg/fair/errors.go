@@ -6,4 +6,6 @@ var (
 	ErrNotFound          = errors.New("Street Fair Not Found")
 	ErrInvalidStreetFair = errors.New("Invalid Street Fair")
 	ErrInternal          = errors.New("InternalServerError")
+	ErrNotMigrated       = errors.New("Street Fair schema not migrated")
+	ErrVersionMismatch   = errors.New("Street Fair version mismatch")
 )
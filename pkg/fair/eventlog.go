@@ -0,0 +1,187 @@
+package fair
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventLog persists the events of the street fairs, so the subscribers
+// of the Bus can resume after a disconnection
+type EventLog interface {
+	// Since returns up to limit events after the event id, oldest first
+	Since(id int64, limit int) ([]Event, error)
+	// Last returns the id of the last event, zero when there is none
+	Last() (int64, error)
+	// Purge removes the delivered events created before t
+	Purge(t time.Time) error
+}
+
+// Outbox is the EventLog written in the same transaction of the changes of
+// the street fairs, its events are delivered at-least-once by a relay
+type Outbox interface {
+	EventLog
+	// Claim returns up to limit undelivered events, oldest first, hiding them
+	// from the other relays for lease. An event is only claimed when there is
+	// no earlier undelivered event of its registry claimed by another relay
+	Claim(now time.Time, lease time.Duration, limit int) ([]Event, error)
+	// Release makes the claimed events ids claimable again
+	Release(ids []int64) error
+	MarkDelivered(ids []int64, at time.Time) error
+}
+
+type eventRow struct {
+	ID           int64 `gorm:"primaryKey"`
+	Type         string
+	Registry     string
+	Model        string
+	CreatedAt    time.Time
+	DeliveredAt  *time.Time
+	ClaimedUntil *time.Time
+}
+
+func (eventRow) TableName() string {
+	return "street_fair_events"
+}
+
+func (r *eventRow) event() (Event, error) {
+	e := Event{ID: r.ID, Type: r.Type, Registry: r.Registry, Time: r.CreatedAt.UTC()}
+	if r.Model != "" {
+		e.Model = new(Model)
+		if err := json.Unmarshal([]byte(r.Model), e.Model); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+func newEventRow(eventType, registry string, m *Model) (eventRow, error) {
+	r := eventRow{Type: eventType, Registry: registry, CreatedAt: time.Now().UTC()}
+	if m != nil {
+		model, err := json.Marshal(m)
+		if err != nil {
+			return r, err
+		}
+		r.Model = string(model)
+	}
+	return r, nil
+}
+
+// nextEventIDs takes n ids of events on tx, returning the first one. The
+// ids come from the counter of `street_fair_event_ids`, its row lock is held
+// until tx ends, so the ids are visible in order: an event is never read
+// before an event of a smaller id that commits later
+func nextEventIDs(tx *gorm.DB, n int) (int64, error) {
+	if err := tx.Exec("UPDATE street_fair_event_ids SET last_id = last_id + ?", n).Error; err != nil {
+		return 0, err
+	}
+	var last int64
+	if err := tx.Raw("SELECT last_id FROM street_fair_event_ids").Scan(&last).Error; err != nil {
+		return 0, err
+	}
+	return last - int64(n) + 1, nil
+}
+
+// appendEvent writes the event of a change on tx, the transaction of the
+// change. It's written after the street fair, holding its row lock, so the
+// ids of the events of a registry follow the order of its changes
+func appendEvent(tx *gorm.DB, eventType, registry string, m *Model) error {
+	r, err := newEventRow(eventType, registry, m)
+	if err != nil {
+		return err
+	}
+	if r.ID, err = nextEventIDs(tx, 1); err != nil {
+		return err
+	}
+	return tx.Create(&r).Error
+}
+
+type dbOutbox struct {
+	db *gorm.DB
+}
+
+func (o *dbOutbox) events(rows []eventRow) ([]Event, error) {
+	events := make([]Event, len(rows))
+	for i := range rows {
+		var err error
+		if events[i], err = rows[i].event(); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+func (o *dbOutbox) Since(id int64, limit int) ([]Event, error) {
+	var rows []eventRow
+	if err := o.db.Where("id > ?", id).Order("id").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return o.events(rows)
+}
+
+func (o *dbOutbox) Last() (int64, error) {
+	var last int64
+	err := o.db.Model(&eventRow{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error
+	return last, err
+}
+
+func (o *dbOutbox) Purge(t time.Time) error {
+	return o.db.Where("delivered_at IS NOT NULL AND created_at < ?", t).Delete(&eventRow{}).Error
+}
+
+func (o *dbOutbox) Claim(now time.Time, lease time.Duration, limit int) ([]Event, error) {
+	var rows []eventRow
+	err := o.db.Table("street_fair_events AS e").
+		Where("e.delivered_at IS NULL AND (e.claimed_until IS NULL OR e.claimed_until < ?)", now).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM street_fair_events AS p
+			WHERE p.registry = e.registry AND p.id < e.id AND p.delivered_at IS NULL AND p.claimed_until >= ?
+		)`, now).
+		Order("e.id").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	until := now.Add(lease)
+	claimed := make([]eventRow, 0, len(rows))
+	// lost are the registries of the events claimed by another relay since
+	// the lookup, their later events are left to keep the order
+	lost := make(map[string]bool)
+	for _, row := range rows {
+		if lost[row.Registry] {
+			continue
+		}
+		r := o.db.Model(&eventRow{}).
+			Where("id = ? AND delivered_at IS NULL AND (claimed_until IS NULL OR claimed_until < ?)", row.ID, now).
+			Update("claimed_until", until)
+		if r.Error != nil {
+			return nil, r.Error
+		} else if r.RowsAffected == 0 {
+			lost[row.Registry] = true
+			continue
+		}
+		claimed = append(claimed, row)
+	}
+	return o.events(claimed)
+}
+
+func (o *dbOutbox) Release(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return o.db.Model(&eventRow{}).Where("id IN ?", ids).Update("claimed_until", nil).Error
+}
+
+func (o *dbOutbox) MarkDelivered(ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return o.db.Model(&eventRow{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"delivered_at": at, "claimed_until": nil}).Error
+}
+
+// NewOutbox returns an Outbox on the table `street_fair_events` of db
+func NewOutbox(db *gorm.DB) Outbox {
+	return &dbOutbox{db: db}
+}
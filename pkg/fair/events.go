@@ -0,0 +1,270 @@
+package fair
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// subscriberBuffer is the number of events a subscriber may fall behind
+// before being dropped by the Bus
+const subscriberBuffer = 256
+
+// followPage is the number of persisted events read at once by Follow
+const followPage = 500
+
+// Event is a change of a street fair, Model is the street fair after the
+// change (nil on deletes). ID is the position of the event on the outbox,
+// the ids are visible in order (see appendEvent)
+type Event struct {
+	ID       int64     `json:"id,omitempty"`
+	Type     string    `json:"type"`
+	Registry string    `json:"registry"`
+	Model    *Model    `json:"model,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Bus is an in-process publish/subscribe of events. Publishing never blocks,
+// a subscriber falling behind is dropped by closing its channel
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+
+	events EventLog
+	// position is the id of the last event of the log published by Follow
+	position int64
+	wake     chan struct{}
+	log      *logrus.Logger
+}
+
+// Subscribe returns a channel receiving the events published from now on
+// and a function to unsubscribe, that must be called when done
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends e to the subscribers
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e.ID > b.position {
+		b.position = e.ID
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// UseLog publishes the events persisted on events from its last one, see
+// Follow. The events are persisted by the outbox
+func (b *Bus) UseLog(events EventLog, log *logrus.Logger) error {
+	last, err := events.Last()
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events, b.position, b.log = events, last, log
+	return nil
+}
+
+// Since returns up to limit persisted events after the event id, up to the
+// last one published, so they're followed by the events of a subscription
+// made before the call. None when the Bus doesn't persist its events
+func (b *Bus) Since(id int64, limit int) ([]Event, error) {
+	b.mu.Lock()
+	events, position := b.events, b.position
+	b.mu.Unlock()
+	if events == nil {
+		return nil, nil
+	}
+	page, err := events.Since(id, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page {
+		if page[i].ID > position {
+			return page[:i], nil
+		}
+	}
+	return page, nil
+}
+
+// Notify wakes Follow without blocking
+func (b *Bus) Notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// follow publishes the persisted events after the position
+func (b *Bus) follow() error {
+	b.mu.Lock()
+	events, position := b.events, b.position
+	b.mu.Unlock()
+	if events == nil {
+		return nil
+	}
+	for {
+		page, err := events.Since(position, followPage)
+		if err != nil {
+			return err
+		}
+		for i := range page {
+			b.Publish(page[i])
+			position = page[i].ID
+		}
+		if len(page) < followPage {
+			return nil
+		}
+	}
+}
+
+// Follow publishes the events persisted on the log, every interval or when
+// notified, until ctx is done. Each instance follows the whole log, so its
+// subscribers get the changes made by every instance
+func (b *Bus) Follow(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := b.follow(); err != nil {
+			b.log.Errorf("Following street fair events: %+v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+	}
+}
+
+// Watch purges the persisted events older than retention periodically
+// until ctx is done
+func (b *Bus) Watch(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			events := b.events
+			b.mu.Unlock()
+			if events == nil {
+				continue
+			}
+			if err := events.Purge(time.Now().Add(-retention)); err != nil {
+				b.log.Errorf("Purging street fair events: %+v", err)
+			}
+		}
+	}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{}), wake: make(chan struct{}, 1)}
+}
+
+// notifyingSF calls notify after the changes of the street fairs, so the
+// relay delivers their events from the outbox right away
+type notifyingSF struct {
+	StreetFair
+	notify func()
+}
+
+func (n *notifyingSF) Create(m *Model) (*Model, error) {
+	created, err := n.StreetFair.Create(m)
+	if err == nil {
+		n.notify()
+	}
+	return created, err
+}
+
+func (n *notifyingSF) Update(m *Model) error {
+	err := n.StreetFair.Update(m)
+	if err == nil {
+		n.notify()
+	}
+	return err
+}
+
+func (n *notifyingSF) Delete(registry string, version int64) error {
+	err := n.StreetFair.Delete(registry, version)
+	if err == nil {
+		n.notify()
+	}
+	return err
+}
+
+func (n *notifyingSF) Bulk(ops []Operation, atomic bool) []OperationResult {
+	results := n.StreetFair.Bulk(ops, atomic)
+	n.notify()
+	return results
+}
+
+// Batch notifies once the street fairs of the batch are stored
+func (n *notifyingSF) Batch(atomic bool) (Batch, error) {
+	return newHookedBatch(n.StreetFair, atomic, n.notify)
+}
+
+// Diff compares to the street fairs of the wrapped StreetFair, when it's a Differ
+func (n *notifyingSF) Diff(models []*Model) ([]ModelDiff, error) {
+	if d, ok := n.StreetFair.(Differ); ok {
+		return d.Diff(models)
+	}
+	return nil, ErrInvalidOperation
+}
+
+// Missing lists the street fairs of the wrapped StreetFair, when it's a Differ
+func (n *notifyingSF) Missing(keep map[string]bool) ([]string, error) {
+	if d, ok := n.StreetFair.(Differ); ok {
+		return d.Missing(keep)
+	}
+	return nil, ErrInvalidOperation
+}
+
+// Query runs q on the wrapped StreetFair
+func (n *notifyingSF) Query(q *Query) ([]Model, error) {
+	return RunQuery(n.StreetFair, q)
+}
+
+// Primary reads from the primary database when the wrapped StreetFair supports it
+func (n *notifyingSF) Primary() StreetFair {
+	if r, ok := n.StreetFair.(PrimaryReader); ok {
+		return r.Primary()
+	}
+	return n.StreetFair
+}
+
+// NewNotifying returns a StreetFair calling notify after the successful
+// changes of sf
+func NewNotifying(sf StreetFair, notify func()) StreetFair {
+	return &notifyingSF{StreetFair: sf, notify: notify}
+}
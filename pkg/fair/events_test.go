@@ -0,0 +1,240 @@
+package fair
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/migrations"
+	"github.com/drgarcia1986/street-fair/pkg/tests"
+	"github.com/sirupsen/logrus"
+)
+
+func TestBusDropsLaggingSubscriber(t *testing.T) {
+	bus := NewBus()
+	events, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		bus.Publish(Event{Type: EventCreated})
+	}
+
+	var received int
+	for range events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("got %d events; want %d", received, subscriberBuffer)
+	}
+}
+
+func TestNotifying(t *testing.T) {
+	var notified int
+	fsf := &fakeStreetFair{createReturn: fakeModel("4041-0")}
+	sf := NewNotifying(fsf, func() { notified++ })
+
+	if _, err := sf.Create(fakeModel("4041-0")); err != nil {
+		t.Fatal(err)
+	}
+	fsf.deleteErr = ErrNotFound
+	_ = sf.Delete("1234-5", 0)
+	if notified != 1 {
+		t.Errorf("got %d; want 1 notification", notified)
+	}
+	if _, err := sf.(Batcher).Batch(false); err != ErrInvalidOperation {
+		t.Errorf("got %+v; want ErrInvalidOperation without a Batcher", err)
+	}
+}
+
+func newTestOutbox(t *testing.T) (StreetFair, Outbox) {
+	db, err := tests.NewDB(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migrations.New(db, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := testSetup(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("1 = 1").Delete(&eventRow{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	sf, err := New(db, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sf, NewOutbox(db)
+}
+
+func TestOutbox(t *testing.T) {
+	sf, outbox := newTestOutbox(t)
+
+	if _, err := sf.Create(fakeModel("4041-0")); err != nil {
+		t.Fatal(err)
+	}
+	m := fakeModel("4041-0")
+	m.Name = "VILA FORMOSA II"
+	if err := sf.Update(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Delete("4041-0", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Delete("4041-0", 0); err != ErrNotFound {
+		t.Fatalf("got %+v; want ErrNotFound", err)
+	}
+	sf.Bulk([]Operation{
+		{Op: OpCreate, Model: fakeModel("4045-2")},
+		{Op: OpDelete, Registry: "1234-5"},
+	}, true)
+
+	events, err := outbox.Since(0, 10)
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	var testCases = []struct {
+		eventType string
+		name      string
+	}{
+		{EventCreated, "VILA FORMOSA"},
+		{EventUpdated, "VILA FORMOSA II"},
+		{EventDeleted, ""},
+	}
+	if actual := len(events); actual != len(testCases) {
+		t.Fatalf("got %d events; want %d (the aborted bulk rolled back)", actual, len(testCases))
+	}
+	for i, tt := range testCases {
+		e := events[i]
+		if e.Type != tt.eventType || e.Registry != "4041-0" {
+			t.Errorf("got %s %s; want %s 4041-0", e.Type, e.Registry, tt.eventType)
+		}
+		if tt.name != "" && (e.Model == nil || e.Model.Name != tt.name) {
+			t.Errorf("got %+v; want the street fair %s", e.Model, tt.name)
+		}
+	}
+}
+
+func TestOutboxClaim(t *testing.T) {
+	sf, outbox := newTestOutbox(t)
+	for _, registry := range []string{"4041-0", "4045-2"} {
+		if _, err := sf.Create(fakeModel(registry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sf.Delete("4041-0", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	first, err := outbox.Claim(now, time.Minute, 1)
+	if err != nil || len(first) != 1 || first[0].Registry != "4041-0" {
+		t.Fatalf("got %+v, %+v; want the create of 4041-0", first, err)
+	}
+	// the delete of 4041-0 waits for its create, claimed by another relay
+	second, err := outbox.Claim(now, time.Minute, 10)
+	if err != nil || len(second) != 1 || second[0].Registry != "4045-2" {
+		t.Fatalf("got %+v, %+v; want only the create of 4045-2", second, err)
+	}
+
+	if err := outbox.MarkDelivered([]int64{first[0].ID}, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Release([]int64{second[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	third, err := outbox.Claim(now, time.Minute, 10)
+	if err != nil || len(third) != 2 || third[0].ID != second[0].ID || third[1].Type != EventDeleted {
+		t.Fatalf("got %+v, %+v; want the released create and the delete", third, err)
+	}
+	if again, _ := outbox.Claim(now, time.Minute, 10); len(again) != 0 {
+		t.Errorf("got %d; want the claimed events hidden", len(again))
+	}
+	if expired, _ := outbox.Claim(now.Add(2*time.Minute), time.Minute, 10); len(expired) != 2 {
+		t.Errorf("got %d; want the expired claims claimable", len(expired))
+	}
+
+	if err := outbox.Purge(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := outbox.Since(0, 10); len(events) != 2 {
+		t.Errorf("got %d; want the undelivered events kept by the purge", len(events))
+	}
+}
+
+func TestBusFollowsTheOutbox(t *testing.T) {
+	sf, outbox := newTestOutbox(t)
+	// the buses of two instances
+	var buses []*Bus
+	var subs []<-chan Event
+	for i := 0; i < 2; i++ {
+		bus := NewBus()
+		if err := bus.UseLog(outbox, logrus.New()); err != nil {
+			t.Fatal(err)
+		}
+		events, unsubscribe := bus.Subscribe()
+		defer unsubscribe()
+		buses, subs = append(buses, bus), append(subs, events)
+	}
+
+	for _, registry := range []string{"4041-0", "4045-2"} {
+		if _, err := sf.Create(fakeModel(registry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first event fails on the relay and is retried after the second one
+	now := time.Now().UTC()
+	claimed, err := outbox.Claim(now, time.Minute, 10)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("got %+v, %+v; want 2 claimed events", claimed, err)
+	}
+	if err := outbox.Release([]int64{claimed[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.MarkDelivered([]int64{claimed[1].ID}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, bus := range buses {
+		if err := bus.follow(); err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range claimed {
+			select {
+			case e := <-subs[i]:
+				if e.ID != expected.ID || e.Registry != expected.Registry {
+					t.Errorf("bus %d: got %d %s; want %d %s", i, e.ID, e.Registry, expected.ID, expected.Registry)
+				}
+			default:
+				t.Fatalf("bus %d: got no event; want %d %s", i, expected.ID, expected.Registry)
+			}
+		}
+	}
+
+	retried, err := outbox.Claim(now, time.Minute, 10)
+	if err != nil || len(retried) != 1 || retried[0].ID != claimed[0].ID {
+		t.Fatalf("got %+v, %+v; want the released event", retried, err)
+	}
+	if err := outbox.MarkDelivered([]int64{retried[0].ID}, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := buses[0].follow(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-subs[0]:
+		t.Errorf("got %+v; want the retried event published once", e)
+	default:
+	}
+
+	// a client resuming after the first event gets the second one
+	events, err := buses[1].Since(claimed[0].ID, 10)
+	if err != nil || len(events) != 1 || events[0].ID != claimed[1].ID {
+		t.Errorf("got %+v, %+v; want the event %d", events, err, claimed[1].ID)
+	}
+}
@@ -3,6 +3,7 @@ package fair
 import (
 	"errors"
 
+	"github.com/drgarcia1986/street-fair/pkg/database"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -10,14 +11,31 @@ import (
 type StreetFair interface {
 	Create(model *Model) (*Model, error)
 	All(filters map[string]string) ([]Model, error)
-	Delete(registry string) error
+	Delete(registry string, version int64) error
 	Update(model *Model) error
 	Get(registry string) (*Model, error)
+	Bulk(ops []Operation, atomic bool) []OperationResult
+}
+
+// PrimaryReader is implemented by the StreetFair implementations able to
+// read from the primary database, useful to read your own writes
+type PrimaryReader interface {
+	Primary() StreetFair
 }
 
 type sf struct {
-	db  *gorm.DB
-	log *logrus.Logger
+	db      *gorm.DB
+	replica func() *gorm.DB
+	log     *logrus.Logger
+}
+
+// Primary returns a StreetFair reading from the primary database
+func (s *sf) Primary() StreetFair {
+	return &sf{db: s.db, replica: s.primary, log: s.log}
+}
+
+func (s *sf) primary() *gorm.DB {
+	return s.db
 }
 
 // Create creates a new street fair
@@ -25,9 +43,19 @@ func (s *sf) Create(model *Model) (*Model, error) {
 	if model.Registry == "" {
 		return nil, ErrInvalidStreetFair
 	}
-	if r := s.db.Create(model); r.Error != nil {
+	model.Version = 1
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := purgeDeleted(tx, model.Registry); err != nil {
+			return err
+		}
+		if err := tx.Create(model).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, EventCreated, model.Registry, model)
+	})
+	if err != nil {
 		s.log.WithField("model", model).
-			Errorf("Creating a new street fair: %+v", r.Error)
+			Errorf("Creating a new street fair: %+v", err)
 		return nil, ErrInternal
 	}
 	return model, nil
@@ -40,7 +68,7 @@ func (s *sf) All(filters map[string]string) ([]Model, error) {
 		}
 	}
 	var models []Model
-	if r := s.db.Where(filters).Find(&models); r.Error != nil {
+	if r := s.replica().Where(filters).Find(&models); r.Error != nil {
 		s.log.WithField("filters", filters).
 			Errorf("Getting all street fairs: %+v", r.Error)
 		return nil, ErrInternal
@@ -48,33 +76,93 @@ func (s *sf) All(filters map[string]string) ([]Model, error) {
 	return models, nil
 }
 
-func (s *sf) Delete(registry string) error {
-	r := s.db.Where("registry = ?", registry).Delete(Model{})
-	if r.Error != nil {
+// purgeDeleted removes the street fairs of registries deleted by a sync,
+// so they can be created again
+func purgeDeleted(tx *gorm.DB, registries ...string) error {
+	return tx.Unscoped().Where("registry IN ? AND deleted_at IS NOT NULL", registries).Delete(&Model{}).Error
+}
+
+// Delete deletes a street fair, when version isn't zero
+// it must match the current version of the street fair
+func (s *sf) Delete(registry string, version int64) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		q := tx.Unscoped().Where("registry = ? AND deleted_at IS NULL", registry)
+		if version != 0 {
+			q = q.Where("version = ?", version)
+		}
+		r := q.Delete(Model{})
+		if r.Error != nil {
+			return r.Error
+		} else if r.RowsAffected == 0 {
+			return s.notAffected(tx, registry, version)
+		}
+		return appendEvent(tx, EventDeleted, registry, nil)
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionMismatch) || errors.Is(err, ErrInternal) {
+		return err
+	} else if err != nil {
 		s.log.WithField("registry", registry).
-			Errorf("Deleting a street fair: %+v", r.Error)
+			Errorf("Deleting a street fair: %+v", err)
 		return ErrInternal
-	} else if r.RowsAffected == 0 {
-		return ErrNotFound
 	}
 	return nil
 }
 
+// Update updates a street fair incrementing its version, when the version
+// of model isn't zero it must match the current version of the street fair.
+// On success model is reloaded with the stored values
 func (s *sf) Update(model *Model) error {
-	r := s.db.Where("registry = ?", model.Registry).Updates(model)
-	if r.Error != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		q := tx.Model(&Model{}).Where("registry = ?", model.Registry)
+		if model.Version != 0 {
+			q = q.Where("version = ?", model.Version)
+		}
+		r := q.Omit("registry", "version", "created_at").Updates(model)
+		if r.Error != nil {
+			return r.Error
+		} else if r.RowsAffected == 0 {
+			return s.notAffected(tx, model.Registry, model.Version)
+		}
+
+		r = tx.Model(&Model{}).Where("registry = ?", model.Registry).
+			UpdateColumn("version", gorm.Expr("version + 1"))
+		if r.Error != nil {
+			return r.Error
+		}
+		if err := tx.Where("registry = ?", model.Registry).First(model).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, EventUpdated, model.Registry, model)
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionMismatch) || errors.Is(err, ErrInternal) {
+		return err
+	} else if err != nil {
 		s.log.WithField("model", model).
-			Errorf("Updating a street fair: %+v", r.Error)
+			Errorf("Updating a street fair: %+v", err)
 		return ErrInternal
-	} else if r.RowsAffected == 0 {
-		return ErrNotFound
 	}
 	return nil
 }
 
+// notAffected tells why a conditional change didn't affect any row
+func (s *sf) notAffected(db *gorm.DB, registry string, version int64) error {
+	if version == 0 {
+		return ErrNotFound
+	}
+	var count int64
+	if r := db.Model(&Model{}).Where("registry = ?", registry).Count(&count); r.Error != nil {
+		s.log.WithField("registry", registry).
+			Errorf("Checking a street fair version: %+v", r.Error)
+		return ErrInternal
+	} else if count == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
+
 func (s *sf) Get(registry string) (*Model, error) {
 	var model Model
-	if r := s.db.Where("registry = ?", registry).First(&model); r.Error != nil {
+	if r := s.replica().Where("registry = ?", registry).First(&model); r.Error != nil {
 		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
 		}
@@ -85,11 +173,26 @@ func (s *sf) Get(registry string) (*Model, error) {
 	return &model, nil
 }
 
-// New returns a instance concret StreetFair implementation
-func New(db *gorm.DB, log *logrus.Logger) (StreetFair, error) {
-	if err := db.AutoMigrate(&Model{}); err != nil {
-		log.Errorf("Migrating StreetFair: %+v", err)
-		return nil, err
+func newSF(db *gorm.DB, replica func() *gorm.DB, log *logrus.Logger) (StreetFair, error) {
+	if !db.Migrator().HasTable(&Model{}) {
+		log.Error("StreetFair table not found, apply the migrations first")
+		return nil, ErrNotMigrated
 	}
-	return &sf{db: db, log: log}, nil
+	s := &sf{db: db, replica: replica, log: log}
+	if replica == nil {
+		s.replica = s.primary
+	}
+	return s, nil
+}
+
+// New returns a instance concret StreetFair implementation,
+// the database schema must be already migrated (see pkg/migrations)
+func New(db *gorm.DB, log *logrus.Logger) (StreetFair, error) {
+	return newSF(db, nil, log)
+}
+
+// NewWithReplicas returns a StreetFair reading from the replicas of the
+// cluster and writing to its primary
+func NewWithReplicas(cluster *database.Cluster, log *logrus.Logger) (StreetFair, error) {
+	return newSF(cluster.Primary(), cluster.Replica, log)
 }
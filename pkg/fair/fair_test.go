@@ -1,10 +1,14 @@
 package fair
 
 import (
+	"context"
+	"reflect"
 	"testing"
 
+	"github.com/drgarcia1986/street-fair/pkg/migrations"
 	"github.com/drgarcia1986/street-fair/pkg/tests"
 	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -103,7 +107,7 @@ func testDelete(sf StreetFair, t *testing.T) {
 		t.Fatalf("got %+v; want <nil>", err)
 	}
 
-	if err := sf.Delete(expectedRegistry); err != nil {
+	if err := sf.Delete(expectedRegistry, 0); err != nil {
 		t.Errorf("got %+v; want <nil>", err)
 	}
 }
@@ -113,7 +117,7 @@ func testDeleteNotFound(sf StreetFair, t *testing.T) {
 		t.Fatalf("got %+v; want <nil>", err)
 	}
 
-	if err := sf.Delete("9999-1"); err != ErrNotFound {
+	if err := sf.Delete("9999-1", 0); err != ErrNotFound {
 		t.Errorf("got %+v; want ErrNotFound", err)
 	}
 }
@@ -171,13 +175,356 @@ func testUpdateNotFound(sf StreetFair, t *testing.T) {
 	}
 }
 
+func testCreateVersion(sf StreetFair, t *testing.T) {
+	m, err := sf.Create(fakeModel("4041-5"))
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+
+	if m.Version != 1 {
+		t.Errorf("got %d; want 1", m.Version)
+	}
+	if m.CreatedAt.IsZero() || m.UpdatedAt.IsZero() {
+		t.Errorf("got %+v; want timestamps", m)
+	}
+}
+
+func testUpdateVersion(sf StreetFair, t *testing.T) {
+	m, err := sf.Create(fakeModel("4041-5"))
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+
+	first := *m
+	first.Name = "First Editor"
+	if err := sf.Update(&first); err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("got %d; want 2", first.Version)
+	}
+	if first.CreatedAt.IsZero() {
+		t.Error("got zero created_at; want the stored one")
+	}
+
+	second := *m
+	second.Name = "Second Editor"
+	if err := sf.Update(&second); err != ErrVersionMismatch {
+		t.Errorf("got %+v; want ErrVersionMismatch", err)
+	}
+
+	nm, err := sf.Get(m.Registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nm.Name != first.Name {
+		t.Errorf("got %s; want %s", nm.Name, first.Name)
+	}
+}
+
+func testDeleteVersion(sf StreetFair, t *testing.T) {
+	m, err := sf.Create(fakeModel("4041-5"))
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+
+	if err := sf.Delete(m.Registry, m.Version+1); err != ErrVersionMismatch {
+		t.Errorf("got %+v; want ErrVersionMismatch", err)
+	}
+	if err := sf.Delete("9999-1", 1); err != ErrNotFound {
+		t.Errorf("got %+v; want ErrNotFound", err)
+	}
+	if err := sf.Delete(m.Registry, m.Version); err != nil {
+		t.Errorf("got %+v; want <nil>", err)
+	}
+}
+
+func testBulkAtomic(sf StreetFair, t *testing.T) {
+	if _, err := sf.Create(fakeModel("4045-2")); err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+
+	results := sf.Bulk([]Operation{
+		{Op: OpCreate, Model: fakeModel("4041-0")},
+		{Op: OpDelete, Registry: "4045-2", Version: 1},
+		{Op: OpUpdate, Model: fakeModel("9999-1")},
+	}, true)
+
+	expected := []error{ErrAborted, ErrAborted, ErrNotFound}
+	for i, r := range results {
+		if r.Err != expected[i] {
+			t.Errorf("item %d: got %+v; want %+v", i, r.Err, expected[i])
+		}
+	}
+
+	models, err := sf.All(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := len(models); actual != 1 || models[0].Registry != "4045-2" {
+		t.Errorf("got %+v; want only 4045-2", models)
+	}
+}
+
+func testBulkBestEffort(sf StreetFair, t *testing.T) {
+	results := sf.Bulk([]Operation{
+		{Op: OpCreate, Model: fakeModel("4041-0")},
+		{Op: OpUpdate, Model: fakeModel("9999-1")},
+		{Op: "upsert", Model: fakeModel("4045-2")},
+		{Op: OpCreate, Model: fakeModel("4045-2")},
+	}, false)
+
+	expected := []error{nil, ErrNotFound, ErrInvalidOperation, nil}
+	for i, r := range results {
+		if r.Err != expected[i] {
+			t.Errorf("item %d: got %+v; want %+v", i, r.Err, expected[i])
+		}
+	}
+	if results[0].Model == nil || results[0].Model.Version != 1 {
+		t.Errorf("got %+v; want the created model", results[0].Model)
+	}
+
+	models, err := sf.All(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := len(models); actual != 2 {
+		t.Errorf("got %d; want 2", actual)
+	}
+}
+
+func testQuery(sf StreetFair, t *testing.T) {
+	for _, r := range []string{"4041-0", "4045-2", "4047-1"} {
+		m := fakeModel(r)
+		m.Name = "FAIR " + r
+		if _, err := sf.Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	models, err := RunQuery(sf, &Query{
+		Filters: map[string]string{"district": "VILA FORMOSA"},
+		Columns: []string{"registry", "name"},
+		Sort:    "-name",
+		Limit:   2,
+		Offset:  1,
+	})
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if actual := len(models); actual != 2 {
+		t.Fatalf("got %d; want 2", actual)
+	}
+	if actual := models[0].Registry; actual != "4045-2" {
+		t.Errorf("got %s; want 4045-2", actual)
+	}
+	if actual := models[0].Name; actual != "FAIR 4045-2" {
+		t.Errorf("got %s; want FAIR 4045-2", actual)
+	}
+	if actual := models[0].District; actual != "" {
+		t.Errorf("got %s; want the not selected district empty", actual)
+	}
+}
+
+func testQueryInvalid(sf StreetFair, t *testing.T) {
+	for _, q := range []*Query{
+		{Columns: []string{"name; drop table street_fairs"}},
+		{Filters: map[string]string{"bogus": "x"}},
+		{Sort: "-bogus"},
+		{Limit: -1},
+	} {
+		if _, err := RunQuery(sf, q); err != ErrInvalidQuery {
+			t.Errorf("got %+v; want ErrInvalidQuery", err)
+		}
+	}
+}
+
+func testBatch(sf StreetFair, t *testing.T) {
+	b, err := sf.(Batcher).Batch(false)
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if errs := b.Create([]*Model{fakeModel("4041-0"), fakeModel("4045-2")}); errs != nil {
+		t.Fatalf("got %+v; want <nil>", errs)
+	}
+
+	// the duplicated and the empty registries fail, the others are created
+	errs := b.Create([]*Model{fakeModel("4041-0"), fakeModel("4046-0"), fakeModel("")})
+	if len(errs) != 3 || errs[0] != ErrInternal || errs[1] != nil || errs[2] != ErrInvalidStreetFair {
+		t.Fatalf("got %+v; want [ErrInternal <nil> ErrInvalidStreetFair]", errs)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+
+	models, _ := sf.All(map[string]string{})
+	if actual := len(models); actual != 3 {
+		t.Errorf("got %d; want 3", actual)
+	}
+	if actual := models[0].Version; actual != 1 {
+		t.Errorf("got %d; want 1", actual)
+	}
+}
+
+func testBatchAtomic(sf StreetFair, t *testing.T) {
+	b, err := sf.(Batcher).Batch(true)
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if errs := b.Create([]*Model{fakeModel("4041-0"), fakeModel("4045-2")}); errs != nil {
+		t.Fatalf("got %+v; want <nil>", errs)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+
+	b, err = sf.(Batcher).Batch(true)
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if errs := b.Create([]*Model{fakeModel("4046-0")}); errs != nil {
+		t.Fatalf("got %+v; want <nil>", errs)
+	}
+	if errs := b.Create([]*Model{fakeModel("4047-0"), fakeModel("4041-0")}); len(errs) != 2 || errs[1] == nil {
+		t.Fatalf("got %+v; want the duplicated registry failed", errs)
+	}
+	if err := b.Commit(); err != ErrAborted {
+		t.Fatalf("got %+v; want ErrAborted", err)
+	}
+
+	models, _ := sf.All(map[string]string{})
+	if actual := len(models); actual != 2 {
+		t.Errorf("got %d; want only the 2 of the committed batch", actual)
+	}
+}
+
+func testUpsert(sf StreetFair, t *testing.T) {
+	if _, err := sf.Create(fakeModel("4041-0")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sf.Create(fakeModel("4045-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := sf.(Batcher).Batch(false)
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	changed := fakeModel("4045-2")
+	changed.Landmark = ""
+	results := b.Upsert([]*Model{fakeModel("4041-0"), changed, fakeModel("4046-0"), fakeModel("")})
+	expected := []Change{Unchanged, Updated, Created}
+	for i, change := range expected {
+		if results[i].Err != nil || results[i].Change != change {
+			t.Errorf("got %+v; want %d", results[i], change)
+		}
+	}
+	if results[3].Err != ErrInvalidStreetFair {
+		t.Errorf("got %+v; want ErrInvalidStreetFair", results[3].Err)
+	}
+
+	m, err := sf.Get("4045-2")
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if m.Landmark != "" || m.Version != 2 {
+		t.Errorf("got %q at version %d; want the landmark cleared at version 2", m.Landmark, m.Version)
+	}
+	if m, _ := sf.Get("4041-0"); m == nil || m.Version != 1 {
+		t.Errorf("got %+v; want 4041-0 unchanged at version 1", m)
+	}
+}
+
+func testDeleteMissing(sf StreetFair, t *testing.T) {
+	for _, registry := range []string{"4041-0", "4045-2", "4046-0"} {
+		if _, err := sf.Create(fakeModel(registry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := sf.(Batcher).Batch(true)
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	deleted, err := b.DeleteMissing(map[string]bool{"4041-0": true})
+	if err != nil || deleted != 2 {
+		t.Fatalf("got %d, %+v; want 2, <nil>", deleted, err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+
+	if models, _ := sf.All(map[string]string{}); len(models) != 1 {
+		t.Errorf("got %d; want 1", len(models))
+	}
+	if _, err := sf.Get("4045-2"); err != ErrNotFound {
+		t.Errorf("got %+v; want ErrNotFound", err)
+	}
+	if err := sf.Delete("4045-2", 0); err != ErrNotFound {
+		t.Errorf("got %+v; want ErrNotFound", err)
+	}
+
+	// the deleted street fairs can be created (and upserted) again
+	if _, err := sf.Create(fakeModel("4045-2")); err != nil {
+		t.Errorf("got %+v; want <nil>", err)
+	}
+	b, _ = sf.(Batcher).Batch(false)
+	if results := b.Upsert([]*Model{fakeModel("4046-0")}); results[0].Err != nil || results[0].Change != Created {
+		t.Errorf("got %+v; want created", results[0])
+	}
+}
+
+func testDiff(sf StreetFair, t *testing.T) {
+	for _, registry := range []string{"4041-0", "4045-2"} {
+		if _, err := sf.Create(fakeModel(registry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changed := fakeModel("4041-0")
+	changed.Name, changed.Latitude = "VILA FORMOSA II", -23.5
+	diffs, err := sf.(Differ).Diff([]*Model{changed, fakeModel("4046-0")})
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	expected := []FieldChange{
+		{Field: "latitude", Old: float64(-23558733), New: -23.5},
+		{Field: "name", Old: "VILA FORMOSA", New: "VILA FORMOSA II"},
+	}
+	if diffs[0].Change != Updated || !reflect.DeepEqual(diffs[0].Fields, expected) {
+		t.Errorf("got %+v; want %+v updated", diffs[0], expected)
+	}
+	if diffs[1].Change != Created {
+		t.Errorf("got %+v; want created", diffs[1])
+	}
+
+	missing, err := sf.(Differ).Missing(map[string]bool{"4041-0": true})
+	if err != nil || !reflect.DeepEqual(missing, []string{"4045-2"}) {
+		t.Errorf("got %v, %+v; want [4045-2], <nil>", missing, err)
+	}
+	if m, _ := sf.Get("4041-0"); m.Name != "VILA FORMOSA" {
+		t.Errorf("got %s; want the street fair unchanged", m.Name)
+	}
+}
+
 func testSetup(db *gorm.DB) error {
-	if r := db.Where("1 = 1").Delete(&Model{}); r.Error != nil {
+	if r := db.Unscoped().Where("1 = 1").Delete(&Model{}); r.Error != nil {
 		return r.Error
 	}
 	return nil
 }
 
+func TestNewNotMigrated(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(db, logrus.New()); err != ErrNotMigrated {
+		t.Errorf("got %+v; want ErrNotMigrated", err)
+	}
+}
+
 func TestStreetFair(t *testing.T) {
 	var unitTests = []struct {
 		title string
@@ -193,14 +540,34 @@ func TestStreetFair(t *testing.T) {
 		{"GetNotFound", testGetNotFound},
 		{"Update", testUpdate},
 		{"UpdateNotFound", testUpdateNotFound},
+		{"CreateVersion", testCreateVersion},
+		{"UpdateVersion", testUpdateVersion},
+		{"DeleteVersion", testDeleteVersion},
+		{"BulkAtomic", testBulkAtomic},
+		{"BulkBestEffort", testBulkBestEffort},
+		{"Query", testQuery},
+		{"QueryInvalid", testQueryInvalid},
+		{"Batch", testBatch},
+		{"BatchAtomic", testBatchAtomic},
+		{"Upsert", testUpsert},
+		{"DeleteMissing", testDeleteMissing},
+		{"Diff", testDiff},
 	}
 
 	for _, ut := range unitTests {
-		db, err := tests.NewDB()
+		db, err := tests.NewDB(t)
 		if err != nil {
 			t.Fatal(err)
 		}
 
+		migrator, err := migrations.New(db, logrus.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
 		d, err := New(db, logrus.New())
 		if err != nil {
 			t.Fatal(err)
@@ -0,0 +1,209 @@
+// Package fairtest has an in-memory fair.StreetFair for the tests of the
+// APIs built on it. It's apart from pkg/tests, that is imported by the
+// tests of pkg/fair
+package fairtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+// StreetFair is an in-memory fair.StreetFair, its changes are published
+// to Bus when set, as the outbox relay does
+type StreetFair struct {
+	mu     sync.Mutex
+	models map[string]fair.Model
+	Bus    *fair.Bus
+}
+
+func (m *StreetFair) publish(events []fair.Event) {
+	if m.Bus == nil {
+		return
+	}
+	for _, e := range events {
+		m.Bus.Publish(e)
+	}
+}
+
+func newEvent(eventType, registry string, model *fair.Model) fair.Event {
+	e := fair.Event{Type: eventType, Registry: registry, Time: time.Now().UTC()}
+	if model != nil {
+		copied := *model
+		e.Model = &copied
+	}
+	return e
+}
+
+func (m *StreetFair) Create(model *fair.Model) (*fair.Model, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.create(model)
+	if err != nil {
+		return nil, err
+	}
+	m.publish([]fair.Event{e})
+	return model, nil
+}
+
+func (m *StreetFair) create(model *fair.Model) (fair.Event, error) {
+	if model.Registry == "" {
+		return fair.Event{}, fair.ErrInvalidStreetFair
+	}
+	model.Version = 1
+	m.models[model.Registry] = *model
+	return newEvent(fair.EventCreated, model.Registry, model), nil
+}
+
+func (m *StreetFair) All(filters map[string]string) ([]fair.Model, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var models []fair.Model
+	for _, model := range m.models {
+		if filters["district"] == "" || filters["district"] == model.District {
+			models = append(models, model)
+		}
+	}
+	return models, nil
+}
+
+// Delete removes the street fair of registry, any version when zero
+func (m *StreetFair) Delete(registry string, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.delete(registry, version)
+	if err != nil {
+		return err
+	}
+	m.publish([]fair.Event{e})
+	return nil
+}
+
+func (m *StreetFair) delete(registry string, version int64) (fair.Event, error) {
+	current, ok := m.models[registry]
+	if !ok {
+		return fair.Event{}, fair.ErrNotFound
+	} else if version != 0 && current.Version != version {
+		return fair.Event{}, fair.ErrVersionMismatch
+	}
+	delete(m.models, registry)
+	return newEvent(fair.EventDeleted, registry, nil), nil
+}
+
+// Update replaces the street fair of model.Registry, any version when zero
+func (m *StreetFair) Update(model *fair.Model) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.update(model)
+	if err != nil {
+		return err
+	}
+	m.publish([]fair.Event{e})
+	return nil
+}
+
+func (m *StreetFair) update(model *fair.Model) (fair.Event, error) {
+	current, ok := m.models[model.Registry]
+	if !ok {
+		return fair.Event{}, fair.ErrNotFound
+	} else if model.Version != 0 && current.Version != model.Version {
+		return fair.Event{}, fair.ErrVersionMismatch
+	}
+	model.Version = current.Version + 1
+	m.models[model.Registry] = *model
+	return newEvent(fair.EventUpdated, model.Registry, model), nil
+}
+
+func (m *StreetFair) Get(registry string) (*fair.Model, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	model, ok := m.models[registry]
+	if !ok {
+		return nil, fair.ErrNotFound
+	}
+	return &model, nil
+}
+
+// Bulk applies ops in order like the fair.StreetFair of the database: when
+// atomic a failure restores the street fairs (the others result in
+// fair.ErrAborted), otherwise each one is applied on its own
+func (m *StreetFair) Bulk(ops []fair.Operation, atomic bool) []fair.OperationResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]fair.Model, len(m.models))
+	for k, v := range m.models {
+		snapshot[k] = v
+	}
+	results := make([]fair.OperationResult, len(ops))
+	var events []fair.Event
+	for i := range ops {
+		e, err := m.apply(&ops[i])
+		if err != nil {
+			results[i].Err = err
+			if atomic {
+				break
+			}
+			continue
+		}
+		if ops[i].Op != fair.OpDelete {
+			results[i].Model = ops[i].Model
+		}
+		events = append(events, e)
+	}
+
+	if atomic {
+		for i := range results {
+			if results[i].Err == nil {
+				continue
+			}
+			m.models = snapshot
+			for j := range results {
+				if j != i {
+					results[j] = fair.OperationResult{Err: fair.ErrAborted}
+				}
+			}
+			return results
+		}
+	}
+	m.publish(events)
+	return results
+}
+
+func (m *StreetFair) apply(op *fair.Operation) (fair.Event, error) {
+	registry := op.Registry
+	if registry == "" && op.Model != nil {
+		registry = op.Model.Registry
+	}
+	switch op.Op {
+	case fair.OpCreate:
+		if op.Model == nil {
+			return fair.Event{}, fair.ErrInvalidOperation
+		}
+		return m.create(op.Model)
+	case fair.OpUpdate:
+		if op.Model == nil {
+			return fair.Event{}, fair.ErrInvalidOperation
+		}
+		op.Model.Registry = registry
+		op.Model.Version = op.Version
+		return m.update(op.Model)
+	case fair.OpDelete:
+		if registry == "" {
+			return fair.Event{}, fair.ErrInvalidOperation
+		}
+		return m.delete(registry, op.Version)
+	}
+	return fair.Event{}, fair.ErrInvalidOperation
+}
+
+// New returns a StreetFair with models, at their first version
+func New(models ...fair.Model) *StreetFair {
+	m := &StreetFair{models: make(map[string]fair.Model)}
+	for _, model := range models {
+		model.Version = 1
+		m.models[model.Registry] = model
+	}
+	return m
+}
@@ -0,0 +1,71 @@
+package fairtest
+
+import (
+	"testing"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+func TestBulk(t *testing.T) {
+	var testCases = []struct {
+		title              string
+		atomic             bool
+		expected           []error
+		expectedRegistries []string
+		expectedEvents     int
+	}{
+		{
+			"Atomic",
+			true,
+			[]error{fair.ErrAborted, fair.ErrAborted, fair.ErrNotFound, fair.ErrAborted},
+			[]string{"4045-2"},
+			0,
+		},
+		{
+			"Best-Effort",
+			false,
+			[]error{nil, nil, fair.ErrNotFound, fair.ErrInvalidOperation},
+			[]string{"4041-0"},
+			2,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			bus := fair.NewBus()
+			events, cancel := bus.Subscribe()
+			defer cancel()
+			sf := New(fair.Model{Registry: "4045-2"})
+			sf.Bus = bus
+
+			results := sf.Bulk([]fair.Operation{
+				{Op: fair.OpCreate, Model: &fair.Model{Registry: "4041-0"}},
+				{Op: fair.OpDelete, Registry: "4045-2", Version: 1},
+				{Op: fair.OpUpdate, Model: &fair.Model{Registry: "9999-1"}},
+				{Op: "upsert", Model: &fair.Model{Registry: "4047-1"}},
+			}, tt.atomic)
+
+			for i, r := range results {
+				if r.Err != tt.expected[i] {
+					t.Errorf("item %d: got %+v; want %+v", i, r.Err, tt.expected[i])
+				}
+			}
+			models, err := sf.All(map[string]string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(models) != len(tt.expectedRegistries) || models[0].Registry != tt.expectedRegistries[0] {
+				t.Errorf("got %+v; want only %v", models, tt.expectedRegistries)
+			}
+
+			published := 0
+			for len(events) > 0 {
+				<-events
+				published++
+			}
+			if published != tt.expectedEvents {
+				t.Errorf("got %d events; want %d", published, tt.expectedEvents)
+			}
+		})
+	}
+}
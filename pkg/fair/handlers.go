@@ -3,19 +3,47 @@ package fair
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/drgarcia1986/street-fair/pkg/idempotency"
 	"github.com/gorilla/mux"
 )
 
+// ReadPrimaryHeader is the request header hinting that reads must be
+// served by the primary database (f.ex. right after a write)
+const ReadPrimaryHeader = "X-Read-Primary"
+
+// View is the representation of a Model on the responses, it allows
+// API versions to change the payloads while sharing the handlers
+type View func(m *Model) interface{}
+
 type HTTPService struct {
-	sf StreetFair
+	sf          StreetFair
+	idempotency *idempotency.Idempotency
+	view        View
 }
 
+// maxBulkOperations is the maximum number of operations of a bulk request
+const maxBulkOperations = 1000
+
 type errResp struct {
 	Msg string `json:"msg"`
 }
 
+type bulkItemResp struct {
+	Index    int         `json:"index"`
+	Op       string      `json:"op"`
+	Registry string      `json:"registry,omitempty"`
+	Status   int         `json:"status"`
+	Code     string      `json:"code,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Model    interface{} `json:"model,omitempty"`
+}
+
 func prepareResponse(w http.ResponseWriter, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -27,12 +55,106 @@ func errorResponse(w http.ResponseWriter, err error, status int) {
 }
 
 func statusByErr(err error) int {
-	if errors.Is(err, ErrNotFound) {
+	switch {
+	case errors.Is(err, ErrNotFound):
 		return http.StatusNotFound
+	case errors.Is(err, ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrPreconditionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, ErrInvalidStreetFair), errors.Is(err, ErrInvalidOperation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAborted):
+		return http.StatusFailedDependency
 	}
 	return http.StatusInternalServerError
 }
 
+// codeByErr is the machine readable code of the errors of bulk items
+func codeByErr(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrVersionMismatch):
+		return "version_mismatch"
+	case errors.Is(err, ErrInvalidStreetFair):
+		return "invalid_street_fair"
+	case errors.Is(err, ErrInvalidOperation):
+		return "invalid_operation"
+	case errors.Is(err, ErrAborted):
+		return "aborted"
+	}
+	return "internal"
+}
+
+// decodeOperations reads a JSON array or, with the content type
+// `application/x-ndjson`, a stream of operations (one per line)
+func decodeOperations(r *http.Request) ([]Operation, error) {
+	var ops []Operation
+	dec := json.NewDecoder(r.Body)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-ndjson") {
+		if err := dec.Decode(&ops); err != nil {
+			return nil, err
+		}
+	} else {
+		for dec.More() {
+			var op Operation
+			if err := dec.Decode(&op); err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+			if len(ops) > maxBulkOperations {
+				break
+			}
+		}
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("There are no operations")
+	} else if len(ops) > maxBulkOperations {
+		return nil, fmt.Errorf("Too many operations (maximum %d)", maxBulkOperations)
+	}
+	return ops, nil
+}
+
+// render returns the representation of m on the responses
+func (h *HTTPService) render(m *Model) interface{} {
+	if h.view == nil {
+		return m
+	}
+	return h.view(m)
+}
+
+// reader returns the StreetFair for reads honoring the ReadPrimaryHeader
+func (h *HTTPService) reader(r *http.Request) StreetFair {
+	if primary, _ := strconv.ParseBool(r.Header.Get(ReadPrimaryHeader)); primary {
+		return h.primary()
+	}
+	return h.sf
+}
+
+func (h *HTTPService) primary() StreetFair {
+	if p, ok := h.sf.(PrimaryReader); ok {
+		return p.Primary()
+	}
+	return h.sf
+}
+
+// checkIdentity fails with ErrVersionMismatch when the street fair of
+// registry isn't the one of the `If-Match` ETag (f.ex. deleted and created
+// again), the version is checked by the change
+func (h *HTTPService) checkIdentity(registry, identity string) error {
+	if identity == "" {
+		return nil
+	}
+	m, err := h.primary().Get(registry)
+	if err != nil {
+		return err
+	} else if modelIdentity(m) != identity {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
 func (h *HTTPService) Create(w http.ResponseWriter, r *http.Request) {
 	var p Model
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
@@ -42,11 +164,12 @@ func (h *HTTPService) Create(w http.ResponseWriter, r *http.Request) {
 
 	model, err := h.sf.Create(&p)
 	if err != nil {
-		errorResponse(w, err, http.StatusInternalServerError)
+		errorResponse(w, err, statusByErr(err))
 		return
 	}
+	setValidators(w, modelETag(model), model.UpdatedAt)
 	prepareResponse(w, http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(&model)
+	_ = json.NewEncoder(w).Encode(h.render(model))
 }
 
 func (h *HTTPService) All(w http.ResponseWriter, r *http.Request) {
@@ -56,18 +179,44 @@ func (h *HTTPService) All(w http.ResponseWriter, r *http.Request) {
 		"name":         r.FormValue("name"),
 		"neighborhood": r.FormValue("neighborhood"),
 	}
-	models, err := h.sf.All(filters)
+	models, err := h.reader(r).All(filters)
+	if err != nil {
+		errorResponse(w, err, http.StatusInternalServerError)
+		return
+	}
+	var views interface{} = models
+	if h.view != nil {
+		rendered := make([]interface{}, len(models))
+		for i := range models {
+			rendered[i] = h.view(&models[i])
+		}
+		views = rendered
+	}
+	body, err := json.Marshal(views)
 	if err != nil {
 		errorResponse(w, err, http.StatusInternalServerError)
 		return
 	}
+	// the list has no Last-Modified, the deleted street fairs and the ones
+	// leaving the filters don't change the updated_at of the listed ones
+	if notModified(w, r, listETag(body), time.Time{}) {
+		return
+	}
 	prepareResponse(w, http.StatusOK)
-	_ = json.NewEncoder(w).Encode(&models)
+	_, _ = w.Write(append(body, '\n'))
 }
 
 func (h *HTTPService) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	if err := h.sf.Delete(vars["registry"]); err != nil {
+	version, identity, err := ifMatchVersion(r)
+	if err == nil {
+		err = h.checkIdentity(vars["registry"], identity)
+	}
+	if err != nil {
+		errorResponse(w, err, statusByErr(err))
+		return
+	}
+	if err := h.sf.Delete(vars["registry"], version); err != nil {
 		errorResponse(w, err, statusByErr(err))
 		return
 	}
@@ -85,29 +234,106 @@ func (h *HTTPService) Update(w http.ResponseWriter, r *http.Request) {
 		errorResponse(w, errors.New("Cannot update field `registry`"), http.StatusBadRequest)
 		return
 	}
+	version, identity, err := ifMatchVersion(r)
+	if err == nil {
+		err = h.checkIdentity(p.Registry, identity)
+	}
+	if err != nil {
+		errorResponse(w, err, statusByErr(err))
+		return
+	}
 
+	p.Version = version
 	if err := h.sf.Update(&p); err != nil {
 		errorResponse(w, err, statusByErr(err))
 		return
 	}
+	setValidators(w, modelETag(&p), p.UpdatedAt)
 	prepareResponse(w, http.StatusOK)
-	_ = json.NewEncoder(w).Encode(&p)
+	_ = json.NewEncoder(w).Encode(h.render(&p))
 }
 
 func (h *HTTPService) Get(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	model, err := h.sf.Get(vars["registry"])
+	model, err := h.reader(r).Get(vars["registry"])
 	if err != nil {
 		errorResponse(w, err, statusByErr(err))
 		return
 	}
+	if notModified(w, r, modelETag(model), model.UpdatedAt) {
+		return
+	}
 	prepareResponse(w, http.StatusOK)
-	_ = json.NewEncoder(w).Encode(model)
+	_ = json.NewEncoder(w).Encode(h.render(model))
+}
+
+// Bulk applies a list of operations, atomically (default) or best-effort
+// with `?mode=best-effort`, responding the result of each one
+func (h *HTTPService) Bulk(w http.ResponseWriter, r *http.Request) {
+	var atomic bool
+	switch mode := r.FormValue("mode"); mode {
+	case "", "atomic":
+		atomic = true
+	case "best-effort":
+	default:
+		errorResponse(w, fmt.Errorf("Invalid mode `%s`", mode), http.StatusBadRequest)
+		return
+	}
+
+	ops, err := decodeOperations(r)
+	if err != nil {
+		errorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	results := h.sf.Bulk(ops, atomic)
+	resp := make([]bulkItemResp, len(results))
+	for i, result := range results {
+		resp[i] = bulkItemResp{
+			Index:    i,
+			Op:       ops[i].Op,
+			Registry: ops[i].registry(),
+			Status:   http.StatusOK,
+		}
+		if result.Model != nil {
+			resp[i].Model = h.render(result.Model)
+		}
+		if result.Err != nil {
+			resp[i].Status = statusByErr(result.Err)
+			resp[i].Code = codeByErr(result.Err)
+			resp[i].Error = result.Err.Error()
+		} else if ops[i].Op == OpCreate {
+			resp[i].Status = http.StatusCreated
+		} else if ops[i].Op == OpDelete {
+			resp[i].Status = http.StatusNoContent
+		}
+	}
+	prepareResponse(w, http.StatusOK)
+	_ = json.NewEncoder(w).Encode(&resp)
+}
+
+// UseIdempotency enables the `Idempotency-Key` header on create and bulk,
+// it must be called before RegisterHandlers
+func (h *HTTPService) UseIdempotency(i *idempotency.Idempotency) {
+	h.idempotency = i
+}
+
+// UseView changes the representation of the models on the responses
+func (h *HTTPService) UseView(v View) {
+	h.view = v
+}
+
+func (h *HTTPService) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	if h.idempotency == nil {
+		return next
+	}
+	return h.idempotency.Handler(next)
 }
 
 func (h *HTTPService) RegisterHandlers(r *mux.Router) {
+	r.HandleFunc("/_bulk", h.idempotent(h.Bulk)).Methods("POST")
 	r.HandleFunc("/", h.All).Methods("GET")
-	r.HandleFunc("/", h.Create).Methods("POST")
+	r.HandleFunc("/", h.idempotent(h.Create)).Methods("POST")
 	r.HandleFunc("/{registry}/", h.Delete).Methods("DELETE")
 	r.HandleFunc("/{registry}/", h.Update).Methods("PUT")
 	r.HandleFunc("/{registry}/", h.Get).Methods("GET")
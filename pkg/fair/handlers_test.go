@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -23,6 +24,9 @@ type fakeStreetFair struct {
 	updateErr      error
 	getReturn      *Model
 	getErr         error
+	bulkReturn     []OperationResult
+	bulkOps        []Operation
+	bulkAtomic     bool
 }
 
 func (f *fakeStreetFair) Create(model *Model) (*Model, error) {
@@ -34,7 +38,7 @@ func (f *fakeStreetFair) All(filters map[string]string) ([]Model, error) {
 	return f.allReturn, f.allErr
 }
 
-func (f *fakeStreetFair) Delete(registry string) error {
+func (f *fakeStreetFair) Delete(registry string, version int64) error {
 	return f.deleteErr
 }
 
@@ -46,6 +50,11 @@ func (f *fakeStreetFair) Get(registry string) (*Model, error) {
 	return f.getReturn, f.getErr
 }
 
+func (f *fakeStreetFair) Bulk(ops []Operation, atomic bool) []OperationResult {
+	f.bulkOps, f.bulkAtomic = ops, atomic
+	return f.bulkReturn
+}
+
 func TestHandlerGet(t *testing.T) {
 	var testCases = []struct {
 		title          string
@@ -256,21 +265,37 @@ func TestHandlerDelete(t *testing.T) {
 	var testCases = []struct {
 		title          string
 		methodError    error
+		ifMatch        string
 		expectedStatus int
 	}{
 		{
 			"Everything OK",
 			nil,
+			`"1"`,
 			http.StatusNoContent,
 		},
 		{
 			"Not Found",
 			ErrNotFound,
+			`"1"`,
 			http.StatusNotFound,
 		},
+		{
+			"Version Mismatch",
+			ErrVersionMismatch,
+			`"1"`,
+			http.StatusPreconditionFailed,
+		},
+		{
+			"Without If-Match",
+			nil,
+			"",
+			http.StatusPreconditionRequired,
+		},
 		{
 			"Server Error",
 			errors.New("some error"),
+			"*",
 			http.StatusInternalServerError,
 		},
 	}
@@ -285,6 +310,7 @@ func TestHandlerDelete(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			req.Header.Set("If-Match", tt.ifMatch)
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(api.Delete)
 			handler.ServeHTTP(rr, req)
@@ -302,6 +328,7 @@ func TestHandlerUpdate(t *testing.T) {
 		methodError    error
 		payload        string
 		urlRegistry    string
+		ifMatch        string
 		expectedStatus int
 	}{
 		{
@@ -309,6 +336,7 @@ func TestHandlerUpdate(t *testing.T) {
 			nil,
 			`{"longitude":-46450424,"latitude":-23602582,"setcens":"355030833000022","areap":"3550308005274","cod_district":"32","district":"IGUATEMI","cod_sub_city_hall":"30","sub_city_hall":"SAO MATEUS","region_5":"Leste","region_8":"Leste 2","name":"JD.BOA ESPERANCA","registry":"5171-3","address":"RUA IGUPIARA","address_number":"S/N","neighborhood":"JD BOA ESPERANCA","landmark":""}`,
 			"5171-3",
+			`"1"`,
 			http.StatusOK,
 		},
 		{
@@ -316,6 +344,7 @@ func TestHandlerUpdate(t *testing.T) {
 			ErrNotFound,
 			`{"longitude":-46450424,"latitude":-23602582,"setcens":"355030833000022","areap":"3550308005274","cod_district":"32","district":"IGUATEMI","cod_sub_city_hall":"30","sub_city_hall":"SAO MATEUS","region_5":"Leste","region_8":"Leste 2","name":"JD.BOA ESPERANCA","registry":"5171-3","address":"RUA IGUPIARA","address_number":"S/N","neighborhood":"JD BOA ESPERANCA","landmark":""}`,
 			"5171-3",
+			`"1"`,
 			http.StatusNotFound,
 		},
 		{
@@ -323,6 +352,7 @@ func TestHandlerUpdate(t *testing.T) {
 			nil,
 			`{"longitude":-46450424,"latitude":-23602582,"setcens":"355030833000022","areap":"3550308005274","cod_district":"32","district":"IGUATEMI","cod_sub_city_hall":"30","sub_city_hall":"SAO MATEUS","region_5":"Leste","region_8":"Leste 2","name":"JD.BOA ESPERANCA","registry":"5171-3","address":"RUA IGUPIARA","address_number":"S/N","neighborhood":"JD BOA ESPERANCA","landmark":""}`,
 			"0000-1",
+			`"1"`,
 			http.StatusBadRequest,
 		},
 		{
@@ -330,8 +360,33 @@ func TestHandlerUpdate(t *testing.T) {
 			errors.New("some error"),
 			`{"longitude":-46450424,"latitude":-23602582,"setcens":"355030833000022","areap":"3550308005274","cod_district":"32","district":"IGUATEMI","cod_sub_city_hall":"30","sub_city_hall":"SAO MATEUS","region_5":"Leste","region_8":"Leste 2","name":"JD.BOA ESPERANCA","registry":"5171-3","address":"RUA IGUPIARA","address_number":"S/N","neighborhood":"JD BOA ESPERANCA","landmark":""}`,
 			"5171-3",
+			`"1"`,
 			http.StatusInternalServerError,
 		},
+		{
+			"Version Mismatch",
+			ErrVersionMismatch,
+			`{"longitude":-46450424,"latitude":-23602582,"setcens":"355030833000022","areap":"3550308005274","cod_district":"32","district":"IGUATEMI","cod_sub_city_hall":"30","sub_city_hall":"SAO MATEUS","region_5":"Leste","region_8":"Leste 2","name":"JD.BOA ESPERANCA","registry":"5171-3","address":"RUA IGUPIARA","address_number":"S/N","neighborhood":"JD BOA ESPERANCA","landmark":""}`,
+			"5171-3",
+			`"1"`,
+			http.StatusPreconditionFailed,
+		},
+		{
+			"Without If-Match",
+			nil,
+			`{"longitude":-46450424,"latitude":-23602582,"setcens":"355030833000022","areap":"3550308005274","cod_district":"32","district":"IGUATEMI","cod_sub_city_hall":"30","sub_city_hall":"SAO MATEUS","region_5":"Leste","region_8":"Leste 2","name":"JD.BOA ESPERANCA","registry":"5171-3","address":"RUA IGUPIARA","address_number":"S/N","neighborhood":"JD BOA ESPERANCA","landmark":""}`,
+			"5171-3",
+			"",
+			http.StatusPreconditionRequired,
+		},
+		{
+			"Invalid If-Match",
+			nil,
+			`{"longitude":-46450424,"latitude":-23602582,"setcens":"355030833000022","areap":"3550308005274","cod_district":"32","district":"IGUATEMI","cod_sub_city_hall":"30","sub_city_hall":"SAO MATEUS","region_5":"Leste","region_8":"Leste 2","name":"JD.BOA ESPERANCA","registry":"5171-3","address":"RUA IGUPIARA","address_number":"S/N","neighborhood":"JD BOA ESPERANCA","landmark":""}`,
+			"5171-3",
+			`W/"1"`,
+			http.StatusPreconditionFailed,
+		},
 	}
 
 	for _, tt := range testCases {
@@ -346,6 +401,7 @@ func TestHandlerUpdate(t *testing.T) {
 				t.Fatal(err)
 			}
 			req = mux.SetURLVars(req, map[string]string{"registry": tt.urlRegistry})
+			req.Header.Set("If-Match", tt.ifMatch)
 
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(api.Update)
@@ -357,3 +413,330 @@ func TestHandlerUpdate(t *testing.T) {
 		})
 	}
 }
+
+type fakePrimaryStreetFair struct {
+	fakeStreetFair
+	primary *fakeStreetFair
+}
+
+func (f *fakePrimaryStreetFair) Primary() StreetFair {
+	return f.primary
+}
+
+func TestHandlerReadPrimary(t *testing.T) {
+	var testCases = []struct {
+		title           string
+		header          string
+		expectedPrimary bool
+	}{
+		{"Without Header", "", false},
+		{"Header True", "true", true},
+		{"Header False", "false", false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			fsf := &fakePrimaryStreetFair{
+				fakeStreetFair: fakeStreetFair{getReturn: fakeModel("replica")},
+				primary:        &fakeStreetFair{getReturn: fakeModel("primary")},
+			}
+			api := NewHTTPService(fsf)
+			req, err := http.NewRequest("GET", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(ReadPrimaryHeader, tt.header)
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(api.Get)
+			handler.ServeHTTP(rr, req)
+
+			var model Model
+			if err := json.NewDecoder(rr.Body).Decode(&model); err != nil {
+				t.Fatal(err)
+			}
+			expected := "replica"
+			if tt.expectedPrimary {
+				expected = "primary"
+			}
+			if model.Registry != expected {
+				t.Errorf("got %s; want %s", model.Registry, expected)
+			}
+		})
+	}
+}
+
+func TestHandlerGetConditional(t *testing.T) {
+	updatedAt := time.Date(2021, 8, 13, 18, 51, 28, 0, time.UTC)
+	var testCases = []struct {
+		title          string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{"Without Conditions", "", "", http.StatusOK},
+		{"If-None-Match Matching", "If-None-Match", `"3-ceeab6d7ac7e693b"`, http.StatusNotModified},
+		{"If-None-Match Weak Matching", "If-None-Match", `W/"3-ceeab6d7ac7e693b"`, http.StatusNotModified},
+		{"If-None-Match Stale", "If-None-Match", `"2-ceeab6d7ac7e693b"`, http.StatusOK},
+		{"If-None-Match Only Version", "If-None-Match", `"3"`, http.StatusOK},
+		{"If-Modified-Since Not Modified", "If-Modified-Since", updatedAt.Format(http.TimeFormat), http.StatusNotModified},
+		{"If-Modified-Since Modified", "If-Modified-Since", updatedAt.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			m := fakeModel("4041-5")
+			m.Version = 3
+			m.CreatedAt, m.UpdatedAt = updatedAt, updatedAt
+			api := NewHTTPService(&fakeStreetFair{getReturn: m})
+
+			req, err := http.NewRequest("GET", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(api.Get)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("got %d; want %d", status, tt.expectedStatus)
+			}
+			if actual := rr.Header().Get("ETag"); actual != `"3-ceeab6d7ac7e693b"` {
+				t.Errorf("got %s; want \"3-ceeab6d7ac7e693b\"", actual)
+			}
+			if actual := rr.Header().Get("Last-Modified"); actual != updatedAt.Format(http.TimeFormat) {
+				t.Errorf("got %s; want %s", actual, updatedAt.Format(http.TimeFormat))
+			}
+		})
+	}
+}
+
+func TestHandlerRecreatedETag(t *testing.T) {
+	sf, _ := newTestOutbox(t)
+	api := NewHTTPService(sf)
+	router := mux.NewRouter()
+	api.RegisterHandlers(router)
+
+	do := func(method, ifMatch string) *httptest.ResponseRecorder {
+		var body *bytes.Buffer
+		if method == "PUT" {
+			b, err := json.Marshal(fakeModel("4041-0"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = bytes.NewBuffer(b)
+		} else {
+			body = new(bytes.Buffer)
+		}
+		req := httptest.NewRequest(method, "/4041-0/", body)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if _, err := sf.Create(fakeModel("4041-0")); err != nil {
+		t.Fatal(err)
+	}
+	etag := do("GET", "").Header().Get("ETag")
+	if status := do("DELETE", etag).Code; status != http.StatusNoContent {
+		t.Fatalf("got %d; want %d", status, http.StatusNoContent)
+	}
+	if _, err := sf.Create(fakeModel("4041-0")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the version restarts, the ETag doesn't
+	recreated := do("GET", "")
+	if actual := recreated.Header().Get("ETag"); actual == etag {
+		t.Errorf("got %s; want an ETag other than the deleted street fair one", actual)
+	}
+	req := httptest.NewRequest("GET", "/4041-0/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusOK)
+	}
+	for _, method := range []string{"PUT", "DELETE"} {
+		if status := do(method, etag).Code; status != http.StatusPreconditionFailed {
+			t.Errorf("%s: got %d; want %d", method, status, http.StatusPreconditionFailed)
+		}
+	}
+	if status := do("PUT", recreated.Header().Get("ETag")).Code; status != http.StatusOK {
+		t.Errorf("got %d; want %d", status, http.StatusOK)
+	}
+}
+
+func TestHandlerAllConditional(t *testing.T) {
+	api := NewHTTPService(&fakeStreetFair{allReturn: []Model{*fakeModel("4041-5")}})
+
+	req, err := http.NewRequest("GET", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(api.All).ServeHTTP(rr, req)
+
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("got empty ETag")
+	}
+	if actual := rr.Header().Get("Last-Modified"); actual != "" {
+		t.Errorf("got %s; want no Last-Modified", actual)
+	}
+
+	// a deleted street fair doesn't change the updated_at of the others
+	req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(api.All).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("got %d; want %d", status, http.StatusOK)
+	}
+
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(api.All).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotModified {
+		t.Errorf("got %d; want %d", status, http.StatusNotModified)
+	}
+}
+
+func TestHandlerBulk(t *testing.T) {
+	var testCases = []struct {
+		title            string
+		url              string
+		contentType      string
+		payload          string
+		results          []OperationResult
+		expectedStatus   int
+		expectedAtomic   bool
+		expectedStatuses []int
+	}{
+		{
+			"Everything Ok - Array",
+			"/_bulk",
+			"application/json",
+			`[{"op":"create","model":{"registry":"4041-0"}},{"op":"delete","registry":"4045-2","version":1}]`,
+			[]OperationResult{{Model: fakeModel("4041-0")}, {}},
+			http.StatusOK,
+			true,
+			[]int{http.StatusCreated, http.StatusNoContent},
+		},
+		{
+			"Everything Ok - NDJSON Best Effort",
+			"/_bulk?mode=best-effort",
+			"application/x-ndjson",
+			"{\"op\":\"update\",\"model\":{\"registry\":\"4041-0\"}}\n{\"op\":\"delete\",\"registry\":\"4045-2\"}\n",
+			[]OperationResult{{Model: fakeModel("4041-0")}, {Err: ErrNotFound}},
+			http.StatusOK,
+			false,
+			[]int{http.StatusOK, http.StatusNotFound},
+		},
+		{
+			"Aborted",
+			"/_bulk",
+			"application/json",
+			`[{"op":"create","model":{"registry":"4041-0"}},{"op":"update","model":{"registry":"4045-2"},"version":3}]`,
+			[]OperationResult{{Err: ErrAborted}, {Err: ErrVersionMismatch}},
+			http.StatusOK,
+			true,
+			[]int{http.StatusFailedDependency, http.StatusPreconditionFailed},
+		},
+		{
+			"Invalid Mode",
+			"/_bulk?mode=whatever",
+			"application/json",
+			`[{"op":"delete","registry":"4045-2"}]`,
+			nil,
+			http.StatusBadRequest,
+			false,
+			nil,
+		},
+		{
+			"Without Operations",
+			"/_bulk",
+			"application/json",
+			`[]`,
+			nil,
+			http.StatusBadRequest,
+			false,
+			nil,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			fsf := &fakeStreetFair{bulkReturn: tt.results}
+			api := NewHTTPService(fsf)
+			req, err := http.NewRequest("POST", tt.url, strings.NewReader(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(api.Bulk).ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Fatalf("got %d; want %d (%s)", status, tt.expectedStatus, rr.Body.String())
+			}
+			if tt.expectedStatuses == nil {
+				return
+			}
+			if fsf.bulkAtomic != tt.expectedAtomic {
+				t.Errorf("got atomic %v; want %v", fsf.bulkAtomic, tt.expectedAtomic)
+			}
+
+			var items []bulkItemResp
+			if err := json.NewDecoder(rr.Body).Decode(&items); err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(tt.expectedStatuses) {
+				t.Fatalf("got %d items; want %d", len(items), len(tt.expectedStatuses))
+			}
+			for i, item := range items {
+				if item.Status != tt.expectedStatuses[i] {
+					t.Errorf("item %d: got %d; want %d", i, item.Status, tt.expectedStatuses[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerView(t *testing.T) {
+	type view struct {
+		ID string `json:"id"`
+	}
+	fsf := &fakeStreetFair{
+		getReturn: fakeModel("4041-0"),
+		allReturn: []Model{*fakeModel("4041-0"), *fakeModel("4045-2")},
+	}
+	api := NewHTTPService(fsf)
+	api.UseView(func(m *Model) interface{} { return &view{ID: m.Registry} })
+	router := mux.NewRouter()
+	api.RegisterHandlers(router)
+
+	var testCases = []struct {
+		url      string
+		expected string
+	}{
+		{"/4041-0/", `{"id":"4041-0"}`},
+		{"/", `[{"id":"4041-0"},{"id":"4045-2"}]`},
+	}
+	for _, tt := range testCases {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if actual := strings.TrimSpace(rr.Body.String()); actual != tt.expected {
+			t.Errorf("got %s; want %s", actual, tt.expected)
+		}
+	}
+}
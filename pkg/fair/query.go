@@ -0,0 +1,179 @@
+package fair
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidQuery = errors.New("Invalid street fair query")
+
+// columns are the columns of the street fairs that can be selected and sorted
+var columns = map[string]bool{
+	"longitude": true, "latitude": true, "setcens": true, "areap": true,
+	"cod_district": true, "district": true, "cod_sub_city_hall": true, "sub_city_hall": true,
+	"region5": true, "region8": true, "name": true, "registry": true, "address": true,
+	"address_number": true, "neighborhood": true, "landmark": true, "version": true,
+	"created_at": true, "updated_at": true,
+}
+
+// Query is a listing of street fairs with selected columns, sorting and paging
+type Query struct {
+	Filters map[string]string
+	// Columns are the selected columns, every one when empty
+	Columns []string
+	// Sort is the column to sort by, descending with the `-` prefix
+	Sort   string
+	Limit  int
+	Offset int
+}
+
+func (q *Query) validate() error {
+	for c := range q.Filters {
+		if !columns[c] {
+			return ErrInvalidQuery
+		}
+	}
+	for _, c := range q.Columns {
+		if !columns[c] {
+			return ErrInvalidQuery
+		}
+	}
+	if q.Sort != "" && !columns[strings.TrimPrefix(q.Sort, "-")] {
+		return ErrInvalidQuery
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return ErrInvalidQuery
+	}
+	return nil
+}
+
+// Querier is implemented by the StreetFair implementations able to run a
+// Query on the database, selecting only the requested columns
+type Querier interface {
+	Query(q *Query) ([]Model, error)
+}
+
+// RunQuery runs q on sf, when sf isn't a Querier it's run over All
+// (sorting and paging in memory, with every column)
+func RunQuery(sf StreetFair, q *Query) ([]Model, error) {
+	if querier, ok := sf.(Querier); ok {
+		return querier.Query(q)
+	}
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	filters := make(map[string]string, len(q.Filters))
+	for k, v := range q.Filters {
+		filters[k] = v
+	}
+	models, err := sf.All(filters)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(models, func(i, j int) bool { return models[i].Registry < models[j].Registry })
+	if q.Sort != "" {
+		column, desc := strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+		sort.SliceStable(models, func(i, j int) bool {
+			if desc {
+				i, j = j, i
+			}
+			return lessBy(column, &models[i], &models[j])
+		})
+	}
+
+	if q.Offset >= len(models) {
+		return []Model{}, nil
+	}
+	models = models[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(models) {
+		models = models[:q.Limit]
+	}
+	return models, nil
+}
+
+func textColumn(column string, m *Model) string {
+	switch column {
+	case "setcens":
+		return m.Setcens
+	case "areap":
+		return m.Areap
+	case "cod_district":
+		return m.CodDistrict
+	case "district":
+		return m.District
+	case "cod_sub_city_hall":
+		return m.CodSubCityHall
+	case "sub_city_hall":
+		return m.SubCityHall
+	case "region5":
+		return m.Region5
+	case "region8":
+		return m.Region8
+	case "name":
+		return m.Name
+	case "address":
+		return m.Address
+	case "address_number":
+		return m.AddressNumber
+	case "neighborhood":
+		return m.Neighborhood
+	case "landmark":
+		return m.Landmark
+	}
+	return m.Registry
+}
+
+// lessBy compares a and b by the column
+func lessBy(column string, a, b *Model) bool {
+	switch column {
+	case "longitude":
+		return a.Longitude < b.Longitude
+	case "latitude":
+		return a.Latitude < b.Latitude
+	case "version":
+		return a.Version < b.Version
+	case "created_at":
+		return a.CreatedAt.Before(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Before(b.UpdatedAt)
+	}
+	return textColumn(column, a) < textColumn(column, b)
+}
+
+// Query runs q on the database, the sorting is stable by registry
+func (s *sf) Query(q *Query) ([]Model, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	db := s.replica()
+	for k, v := range q.Filters {
+		if v != "" {
+			db = db.Where(map[string]interface{}{k: v})
+		}
+	}
+	if len(q.Columns) > 0 {
+		db = db.Select(q.Columns)
+	}
+	if q.Sort != "" {
+		order := strings.TrimPrefix(q.Sort, "-")
+		if strings.HasPrefix(q.Sort, "-") {
+			order += " desc"
+		}
+		db = db.Order(order)
+	}
+	db = db.Order("registry").Offset(q.Offset)
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+
+	models := []Model{}
+	if r := db.Find(&models); r.Error != nil {
+		s.log.WithField("query", q).
+			Errorf("Querying street fairs: %+v", r.Error)
+		return nil, ErrInternal
+	}
+	return models, nil
+}
@@ -0,0 +1,192 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/gorilla/mux"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidLastEventID = errors.New("Invalid last event id")
+	errLagging            = errors.New("Subscriber is lagging behind")
+)
+
+// replayPage is the number of persisted events read at once on a resume
+const replayPage = 500
+
+// Config holds the settings of the change feed
+type Config struct {
+	// Retention is how long the events are kept to resume the feeds
+	Retention time.Duration `default:"168h"`
+	// Heartbeat is the interval of the keep-alive messages of idle feeds
+	Heartbeat time.Duration `default:"15s"`
+	// Interval is how often the events are read from the table (the local
+	// changes are read right away)
+	Interval time.Duration `default:"1s"`
+}
+
+// NewConfig returns the settings from the `FAIR_EVENTS_*` env vars
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_events", conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+type errResp struct {
+	Msg string `json:"msg"`
+}
+
+func errorResponse(w http.ResponseWriter, err error, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&errResp{Msg: err.Error()})
+}
+
+// filter selects the events of a feed, the deletes carry no street
+// fair so they always match
+type filter struct {
+	district string
+	region5  string
+}
+
+func newFilter(r *http.Request) filter {
+	q := r.URL.Query()
+	return filter{district: q.Get("district"), region5: q.Get("region5")}
+}
+
+func (f filter) matches(e *fair.Event) bool {
+	if e.Model == nil {
+		return true
+	}
+	return (f.district == "" || f.district == e.Model.District) &&
+		(f.region5 == "" || f.region5 == e.Model.Region5)
+}
+
+// lastEventID is the id of the last event received by the client, from the
+// `Last-Event-ID` header or the `last_event_id` parameter (zero when absent)
+func lastEventID(r *http.Request) (int64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidLastEventID
+	}
+	return id, nil
+}
+
+// Handler serves the changes of the street fairs published on a Bus
+// as Server-Sent Events and by WebSocket
+type Handler struct {
+	bus       *fair.Bus
+	heartbeat time.Duration
+	log       *logrus.Logger
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// stream is the connection of a feed to the client
+type stream interface {
+	// open starts the stream, once subscribed to the events
+	open() error
+	send(e *fair.Event) error
+	// ping keeps the stream alive while idle
+	ping() error
+}
+
+// follow sends to s the persisted events after lastID and then the published
+// ones matching f, until ctx is done or the Handler is closed. The bus
+// publishes the events in the order of their ids, so lastID is where the
+// client is on the log of every instance
+func (h *Handler) follow(ctx context.Context, lastID int64, f filter, s stream) error {
+	// subscribing before reading the log, the events published meanwhile
+	// are read twice and skipped by id
+	live, unsubscribe := h.bus.Subscribe()
+	defer unsubscribe()
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	for lastID > 0 {
+		events, err := h.bus.Since(lastID, replayPage)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			if f.matches(&events[i]) {
+				if err := s.send(&events[i]); err != nil {
+					return err
+				}
+			}
+			lastID = events[i].ID
+		}
+		if len(events) < replayPage {
+			break
+		}
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-h.done:
+			return nil
+		case <-ticker.C:
+			if err := s.ping(); err != nil {
+				return err
+			}
+		case e, ok := <-live:
+			if !ok {
+				return errLagging
+			}
+			if e.ID != 0 && e.ID <= lastID {
+				continue
+			}
+			if e.ID != 0 {
+				lastID = e.ID
+			}
+			if !f.matches(&e) {
+				continue
+			}
+			if err := s.send(&e); err != nil {
+				return err
+			}
+			ticker.Reset(h.heartbeat)
+		}
+	}
+}
+
+// Close ends the open feeds, the clients are expected to reconnect
+// (resuming from the last event) to another instance
+func (h *Handler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// RegisterHandlers serves the feeds on `/events` (SSE) and `/events/ws`
+// (WebSocket)
+func (h *Handler) RegisterHandlers(r *mux.Router) {
+	r.HandleFunc("/events", h.sse).Methods("GET")
+	r.HandleFunc("/events/ws", h.websocket).Methods("GET")
+}
+
+// New returns a Handler of the events published on bus
+func New(bus *fair.Bus, conf *Config, log *logrus.Logger) *Handler {
+	return &Handler{bus: bus, heartbeat: conf.Heartbeat, log: log, done: make(chan struct{})}
+}
@@ -0,0 +1,172 @@
+package feed
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// memLog is an in-memory fair.EventLog, the outbox followed by bus
+type memLog struct {
+	mu     sync.Mutex
+	events []fair.Event
+	bus    *fair.Bus
+}
+
+func (l *memLog) Append(e *fair.Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.ID = int64(len(l.events) + 1)
+	l.events = append(l.events, *e)
+	return nil
+}
+
+func (l *memLog) Since(id int64, limit int) ([]fair.Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var events []fair.Event
+	for _, e := range l.events {
+		if e.ID > id && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (l *memLog) Last() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(len(l.events)), nil
+}
+
+func (l *memLog) Purge(t time.Time) error {
+	return nil
+}
+
+// publish appends an event and notifies the bus following the log
+func (l *memLog) publish(eventType, registry, district string) {
+	e := fair.Event{Type: eventType, Registry: registry, Time: time.Now()}
+	if eventType != fair.EventDeleted {
+		e.Model = &fair.Model{Registry: registry, District: district}
+	}
+	_ = l.Append(&e)
+	l.bus.Notify()
+}
+
+func newTestServer(t *testing.T) (*memLog, *Handler, *httptest.Server) {
+	bus := fair.NewBus()
+	events := &memLog{bus: bus}
+	if err := bus.UseLog(events, logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go bus.Follow(ctx, time.Hour)
+	h := New(bus, &Config{Heartbeat: time.Minute}, logrus.New())
+
+	r := mux.NewRouter()
+	h.RegisterHandlers(r)
+	ts := httptest.NewServer(r)
+	t.Cleanup(func() {
+		cancel()
+		h.Close()
+		ts.Close()
+	})
+	return events, h, ts
+}
+
+// readSSE returns the ids of the next n events of the stream
+func readSSE(t *testing.T, reader *bufio.Reader, n int) []string {
+	var ids []string
+	for len(ids) < n {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimSpace(strings.TrimPrefix(line, "id: ")))
+		}
+	}
+	return ids
+}
+
+func TestSSE(t *testing.T) {
+	events, _, ts := newTestServer(t)
+	events.publish(fair.EventCreated, "4041-0", "VILA FORMOSA")
+	events.publish(fair.EventCreated, "4045-2", "VILA PRUDENTE")
+	events.publish(fair.EventUpdated, "4041-0", "VILA FORMOSA")
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/events?district=VILA+FORMOSA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if actual := resp.Header.Get("Content-Type"); actual != "text/event-stream" {
+		t.Errorf("got %s; want text/event-stream", actual)
+	}
+
+	events.publish(fair.EventUpdated, "4045-2", "VILA PRUDENTE")
+	events.publish(fair.EventDeleted, "4045-2", "")
+
+	expected := []string{"3", "5"}
+	if actual := readSSE(t, bufio.NewReader(resp.Body), 2); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v; want %v", actual, expected)
+	}
+}
+
+func TestInvalidLastEventID(t *testing.T) {
+	_, _, ts := newTestServer(t)
+
+	for _, path := range []string{"/events?last_event_id=x", "/events/ws?last_event_id=-1"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got %d; want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	events, h, ts := newTestServer(t)
+	events.publish(fair.EventCreated, "4041-0", "VILA FORMOSA")
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/events/ws?last_event_id=0"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	events.publish(fair.EventUpdated, "4041-0", "VILA FORMOSA")
+	var e fair.Event
+	if err := conn.ReadJSON(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 2 || e.Type != fair.EventUpdated || e.Model.District != "VILA FORMOSA" {
+		t.Errorf("got %+v; want the update 2", e)
+	}
+
+	h.Close()
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("got %+v; want going away close", err)
+	}
+}
@@ -0,0 +1,68 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+type sseStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseStream) open() error {
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.Header().Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseStream) send(e *fair.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.ID != 0 {
+		if _, err := fmt.Fprintf(s.w, "id: %d\n", e.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseStream) ping() error {
+	if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// sse streams the events as Server-Sent Events, the `id` of each event
+// is sent back by the EventSource as `Last-Event-ID` on reconnections
+func (h *Handler) sse(w http.ResponseWriter, r *http.Request) {
+	lastID, err := lastEventID(r)
+	if err != nil {
+		errorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorResponse(w, errors.New("Streaming unsupported"), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.follow(r.Context(), lastID, newFilter(r), &sseStream{w: w, flusher: flusher}); err != nil {
+		h.log.WithField("last_event_id", lastID).Warnf("Ending events stream: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/gorilla/websocket"
+)
+
+// writeWait is the maximum time to write a message to a WebSocket
+const writeWait = 10 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+type wsStream struct {
+	w    http.ResponseWriter
+	r    *http.Request
+	conn *websocket.Conn
+	// cancel ends the feed when the client leaves
+	cancel context.CancelFunc
+}
+
+func (s *wsStream) open() error {
+	conn, err := upgrader.Upgrade(s.w, s.r, nil)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+
+	// reading handles the control messages and tells when the client leaves
+	go func() {
+		defer s.cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *wsStream) send(e *fair.Event) error {
+	_ = s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return s.conn.WriteJSON(e)
+}
+
+func (s *wsStream) ping() error {
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+}
+
+func (s *wsStream) close(code int, reason string) {
+	_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	s.conn.Close()
+}
+
+// websocket sends every event as a JSON text message, the client resumes
+// with the `last_event_id` parameter (or the `Last-Event-ID` header)
+func (h *Handler) websocket(w http.ResponseWriter, r *http.Request) {
+	lastID, err := lastEventID(r)
+	if err != nil {
+		errorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	s := &wsStream{w: w, r: r, cancel: cancel}
+	err = h.follow(ctx, lastID, newFilter(r), s)
+	if s.conn == nil {
+		// the upgrader already answered the client
+		return
+	}
+
+	switch {
+	case errors.Is(err, errLagging):
+		s.close(websocket.CloseTryAgainLater, err.Error())
+	case err != nil:
+		h.log.WithField("last_event_id", lastID).Warnf("Ending events WebSocket: %v", err)
+		s.conn.Close()
+	default:
+		select {
+		case <-h.done:
+			s.close(websocket.CloseGoingAway, "Server is shutting down")
+		default:
+			s.close(websocket.CloseNormalClosure, "")
+		}
+	}
+}
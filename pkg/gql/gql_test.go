@@ -0,0 +1,272 @@
+package gql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/fair/fairtest"
+	"github.com/gorilla/mux"
+)
+
+// querierStreetFair records the queries run on it
+type querierStreetFair struct {
+	*fairtest.StreetFair
+	queries []fair.Query
+}
+
+func (q *querierStreetFair) Query(query *fair.Query) ([]fair.Model, error) {
+	q.queries = append(q.queries, *query)
+	return []fair.Model{{Registry: "4041-0", Name: "VILA FORMOSA"}}, nil
+}
+
+// laggingStreetFair reads from a replica behind its primary
+type laggingStreetFair struct {
+	*fairtest.StreetFair
+	replica *fairtest.StreetFair
+}
+
+func (l *laggingStreetFair) Get(registry string) (*fair.Model, error) {
+	return l.replica.Get(registry)
+}
+
+func (l *laggingStreetFair) Primary() fair.StreetFair {
+	return l.StreetFair
+}
+
+type response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func newTestRouter(t *testing.T, sf fair.StreetFair, conf *Config) *mux.Router {
+	h, err := New(sf, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	h.RegisterHandlers(r)
+	return r
+}
+
+func post(t *testing.T, r http.Handler, query string, variables map[string]interface{}) (int, *response) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, &resp
+}
+
+func registries(t *testing.T, resp *response) []string {
+	if len(resp.Errors) > 0 {
+		t.Fatalf("got %+v; want no errors", resp.Errors)
+	}
+	var result []string
+	for _, f := range resp.Data["fairs"].([]interface{}) {
+		result = append(result, f.(map[string]interface{})["registry"].(string))
+	}
+	return result
+}
+
+func testFairs() []fair.Model {
+	return []fair.Model{
+		{Registry: "4041-0", Name: "VILA FORMOSA", District: "VILA FORMOSA"},
+		{Registry: "4045-2", Name: "PRACA SANTA HELENA", District: "VILA PRUDENTE"},
+		{Registry: "1012-8", Name: "ALTO DA MOOCA", District: "VILA FORMOSA"},
+	}
+}
+
+func TestFairsQuery(t *testing.T) {
+	r := newTestRouter(t, fairtest.New(testFairs()...), &Config{MaxDepth: 6, MaxComplexity: 5000})
+
+	var unitTests = []struct {
+		title    string
+		query    string
+		expected []string
+	}{
+		{"All", `{ fairs { registry } }`, []string{"1012-8", "4041-0", "4045-2"}},
+		{"Filter", `{ fairs(filter: {district: "VILA FORMOSA"}) { registry } }`, []string{"1012-8", "4041-0"}},
+		{"Sort", `{ fairs(sort: {field: NAME, desc: true}) { registry } }`, []string{"4041-0", "4045-2", "1012-8"}},
+		{"Page", `{ fairs(page: {limit: 1, offset: 1}) { registry } }`, []string{"4041-0"}},
+		{"PageAfterTheEnd", `{ fairs(page: {offset: 10}) { registry } }`, nil},
+	}
+
+	for _, ut := range unitTests {
+		t.Run(ut.title, func(t *testing.T) {
+			status, resp := post(t, r, ut.query, nil)
+			if status != http.StatusOK {
+				t.Errorf("got %d; want %d", status, http.StatusOK)
+			}
+			if actual := registries(t, resp); !reflect.DeepEqual(actual, ut.expected) {
+				t.Errorf("got %v; want %v", actual, ut.expected)
+			}
+		})
+	}
+}
+
+func TestFairQuery(t *testing.T) {
+	r := newTestRouter(t, fairtest.New(testFairs()...), &Config{MaxDepth: 6, MaxComplexity: 5000})
+
+	_, resp := post(t, r, `query($r: String!) { fair(registry: $r) { name version } }`, map[string]interface{}{"r": "4045-2"})
+	expected := map[string]interface{}{"name": "PRACA SANTA HELENA", "version": float64(1)}
+	if actual := resp.Data["fair"]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v; want %v", actual, expected)
+	}
+
+	_, resp = post(t, r, `{ fair(registry: "0000-0") { name } }`, nil)
+	if actual := resp.Data["fair"]; actual != nil {
+		t.Errorf("got %v; want <nil>", actual)
+	}
+}
+
+func TestGet(t *testing.T) {
+	r := newTestRouter(t, fairtest.New(testFairs()...), &Config{MaxDepth: 6, MaxComplexity: 5000})
+
+	query := url.Values{"query": {`{ fairs(page: {limit: 1}) { registry } }`}}
+	req := httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if actual := registries(t, &resp); !reflect.DeepEqual(actual, []string{"1012-8"}) {
+		t.Errorf("got %v; want [1012-8]", actual)
+	}
+}
+
+func TestSelectedColumns(t *testing.T) {
+	sf := &querierStreetFair{StreetFair: fairtest.New()}
+	r := newTestRouter(t, sf, &Config{MaxDepth: 6, MaxComplexity: 5000})
+
+	query := `{ fairs { name ...location } } fragment location on StreetFair { district updatedAt }`
+	if _, resp := post(t, r, query, nil); len(resp.Errors) > 0 {
+		t.Fatalf("got %+v; want no errors", resp.Errors)
+	}
+
+	expected := []string{"registry", "name", "district", "updated_at"}
+	if actual := len(sf.queries); actual != 1 {
+		t.Fatalf("got %d queries; want 1", actual)
+	}
+	if actual := sf.queries[0].Columns; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v; want %v", actual, expected)
+	}
+}
+
+func TestMutations(t *testing.T) {
+	sf := fairtest.New(testFairs()...)
+	r := newTestRouter(t, sf, &Config{MaxDepth: 6, MaxComplexity: 5000})
+
+	_, resp := post(t, r, `mutation { createFair(input: {registry: "9999-9", name: "NOVA"}) { registry version } }`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("got %+v; want no errors", resp.Errors)
+	}
+	if _, err := sf.Get("9999-9"); err != nil {
+		t.Errorf("got %+v; want <nil>", err)
+	}
+
+	_, resp = post(t, r, `mutation { updateFair(registry: "4041-0", version: 1, input: {name: "NOVA VILA"}) { name district version } }`, nil)
+	expected := map[string]interface{}{"name": "NOVA VILA", "district": "VILA FORMOSA", "version": float64(2)}
+	if actual := resp.Data["updateFair"]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v; want %v", actual, expected)
+	}
+
+	_, resp = post(t, r, `mutation { updateFair(registry: "4041-0", version: 1, input: {name: "OLD"}) { name } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != fair.ErrVersionMismatch.Error() {
+		t.Errorf("got %+v; want %s", resp.Errors, fair.ErrVersionMismatch)
+	}
+
+	for _, mutation := range []string{
+		`mutation { updateFair(registry: "4045-2", input: {name: "OLD"}) { name } }`,
+		`mutation { deleteFair(registry: "4045-2") }`,
+	} {
+		if _, resp = post(t, r, mutation, nil); len(resp.Errors) != 1 {
+			t.Errorf("got %+v; want a required version error", resp.Errors)
+		}
+	}
+	_, resp = post(t, r, `mutation { deleteFair(registry: "4045-2", version: 0) }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != ErrVersionRequired.Error() {
+		t.Errorf("got %+v; want %s", resp.Errors, ErrVersionRequired)
+	}
+
+	_, resp = post(t, r, `mutation { deleteFair(registry: "4045-2", version: 1) }`, nil)
+	if actual := resp.Data["deleteFair"]; actual != true {
+		t.Errorf("got %v; want true", actual)
+	}
+	if _, err := sf.Get("4045-2"); !errors.Is(err, fair.ErrNotFound) {
+		t.Errorf("got %+v; want ErrNotFound", err)
+	}
+}
+
+func TestUpdateReadsPrimary(t *testing.T) {
+	primary := fairtest.New(testFairs()...)
+	if err := primary.Update(&fair.Model{Registry: "4041-0", Name: "VILA FORMOSA", District: "VILA PRUDENTE", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	sf := &laggingStreetFair{StreetFair: primary, replica: fairtest.New(testFairs()...)}
+	r := newTestRouter(t, sf, &Config{MaxDepth: 6, MaxComplexity: 5000})
+
+	_, resp := post(t, r, `mutation { updateFair(registry: "4041-0", version: 2, input: {name: "NOVA VILA"}) { name district version } }`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("got %+v; want no errors", resp.Errors)
+	}
+	expected := map[string]interface{}{"name": "NOVA VILA", "district": "VILA PRUDENTE", "version": float64(3)}
+	if actual := resp.Data["updateFair"]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v; want %v", actual, expected)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	r := newTestRouter(t, fairtest.New(testFairs()...), &Config{MaxDepth: 3, MaxComplexity: 100})
+
+	var unitTests = []struct {
+		title     string
+		query     string
+		variables map[string]interface{}
+		expected  int
+	}{
+		{"Allowed", `{ fairs(page: {limit: 10}) { registry name } }`, nil, http.StatusOK},
+		{"TooComplex", `{ fairs { registry name } }`, nil, http.StatusBadRequest},
+		{"TooComplexByVariable", `query($p: Page) { fairs(page: $p) { registry } }`, map[string]interface{}{"p": map[string]interface{}{"limit": 500}}, http.StatusBadRequest},
+		{"FragmentsDepth", `{ a: fair(registry: "4041-0") { ...f } } fragment f on StreetFair { name ... on StreetFair { ... on StreetFair { ... on StreetFair { registry } } } }`, nil, http.StatusOK},
+		{"Introspection", `{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`, nil, http.StatusOK},
+		{"Invalid", `{ fairs {`, nil, http.StatusBadRequest},
+	}
+
+	for _, ut := range unitTests {
+		t.Run(ut.title, func(t *testing.T) {
+			if status, _ := post(t, r, ut.query, ut.variables); status != ut.expected {
+				t.Errorf("got %d; want %d", status, ut.expected)
+			}
+		})
+	}
+}
+
+func TestCheckLimitsDepth(t *testing.T) {
+	r := newTestRouter(t, fairtest.New(), &Config{MaxDepth: 1, MaxComplexity: 100})
+
+	status, resp := post(t, r, `{ fair(registry: "4041-0") { name } }`, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("got %d; want %d", status, http.StatusBadRequest)
+	}
+	if len(resp.Errors) != 1 {
+		t.Fatalf("got %d errors; want 1", len(resp.Errors))
+	}
+}
@@ -0,0 +1,104 @@
+package gql
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const maxBodySize = 1 << 20
+
+// Config holds the limits of the GraphQL queries
+type Config struct {
+	MaxDepth      int `default:"6" split_words:"true"`
+	MaxComplexity int `default:"5000" split_words:"true"`
+}
+
+// NewConfig returns the settings from the `FAIR_GRAPHQL_*` env vars
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_graphql", conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Handler serves GraphQL requests, by `GET` with the `query` parameter
+// or by `POST` with a JSON body
+type Handler struct {
+	schema graphql.Schema
+	conf   *Config
+}
+
+func writeResult(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func errorResult(err error) *graphql.Result {
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.FormatError(err)}}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if r.Method == http.MethodGet {
+		req.Query = r.FormValue("query")
+		req.OperationName = r.FormValue("operationName")
+		if v := r.FormValue("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeResult(w, http.StatusBadRequest, errorResult(err))
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeResult(w, http.StatusBadRequest, errorResult(err))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query)})})
+	if err != nil {
+		writeResult(w, http.StatusBadRequest, errorResult(err))
+		return
+	}
+	if err := checkLimits(doc, req.Variables, h.conf.MaxDepth, h.conf.MaxComplexity); err != nil {
+		writeResult(w, http.StatusBadRequest, errorResult(err))
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+	writeResult(w, http.StatusOK, result)
+}
+
+// RegisterHandlers serves h on `/graphql`
+func (h *Handler) RegisterHandlers(r *mux.Router) {
+	r.Handle("/graphql", h).Methods("GET", "POST")
+}
+
+// New returns a GraphQL Handler of the street fairs of sf
+func New(sf fair.StreetFair, conf *Config) (*Handler, error) {
+	schema, err := newSchema(sf)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{schema: schema, conf: conf}, nil
+}
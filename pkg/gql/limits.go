@@ -0,0 +1,131 @@
+package gql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+var (
+	ErrTooDeep    = errors.New("Query is too deep")
+	ErrTooComplex = errors.New("Query is too complex")
+)
+
+// limits computes the depth and the complexity of a query. Every field costs
+// one, the fields selected on `fairs` cost once by street fair of the page
+// and the introspection fields are free
+type limits struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// visiting guards against fragment cycles (rejected later by the validation)
+	visiting map[string]bool
+}
+
+// pageLimit returns the page size of a `fairs` field
+func (l *limits) pageLimit(f *ast.Field) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "page" {
+			continue
+		}
+		switch page := arg.Value.(type) {
+		case *ast.ObjectValue:
+			for _, field := range page.Fields {
+				if field.Name.Value == "limit" {
+					return l.intValue(field.Value)
+				}
+			}
+		case *ast.Variable:
+			if values, ok := l.variables[page.Name.Value].(map[string]interface{}); ok {
+				if limit, ok := values["limit"].(float64); ok {
+					return int(limit)
+				}
+			}
+		}
+	}
+	return defaultPageSize
+}
+
+func (l *limits) intValue(v ast.Value) int {
+	switch value := v.(type) {
+	case *ast.IntValue:
+		if n, err := strconv.Atoi(value.Value); err == nil {
+			return n
+		}
+	case *ast.Variable:
+		if n, ok := l.variables[value.Name.Value].(float64); ok {
+			return int(n)
+		}
+	}
+	return defaultPageSize
+}
+
+// measure returns the depth and the complexity of a selection set
+func (l *limits) measure(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var d, c int
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				// the introspection is bounded by the schema
+				continue
+			}
+			d, c = l.measure(s.SelectionSet)
+			if s.Name.Value == "fairs" {
+				c *= l.pageLimit(s)
+			}
+			d, c = d+1, c+1
+		case *ast.InlineFragment:
+			d, c = l.measure(s.SelectionSet)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			fragment, ok := l.fragments[name]
+			if !ok || l.visiting[name] {
+				continue
+			}
+			l.visiting[name] = true
+			d, c = l.measure(fragment.SelectionSet)
+			delete(l.visiting, name)
+		}
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+	return depth, complexity
+}
+
+// checkLimits fails when an operation of doc is deeper than maxDepth
+// or more complex than maxComplexity
+func checkLimits(doc *ast.Document, variables map[string]interface{}, maxDepth, maxComplexity int) error {
+	l := &limits{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		visiting:  make(map[string]bool),
+	}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			l.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		depth, complexity := l.measure(op.SelectionSet)
+		if depth > maxDepth {
+			return fmt.Errorf("%w: depth %d (maximum %d)", ErrTooDeep, depth, maxDepth)
+		}
+		if complexity > maxComplexity {
+			return fmt.Errorf("%w: complexity %d (maximum %d)", ErrTooComplex, complexity, maxComplexity)
+		}
+	}
+	return nil
+}
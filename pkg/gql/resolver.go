@@ -0,0 +1,129 @@
+package gql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/graphql-go/graphql"
+)
+
+var ErrVersionRequired = errors.New("The current version is required")
+
+type resolver struct {
+	sf fair.StreetFair
+}
+
+// fair gets a street fair by registry, it's null when not found
+func (r *resolver) fair(p graphql.ResolveParams) (interface{}, error) {
+	m, err := r.sf.Get(p.Args["registry"].(string))
+	if errors.Is(err, fair.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (r *resolver) fairs(p graphql.ResolveParams) (interface{}, error) {
+	q := &fair.Query{
+		Filters: make(map[string]string),
+		Columns: selectedColumns(p.Info),
+		Limit:   defaultPageSize,
+	}
+	if filter, ok := p.Args["filter"].(map[string]interface{}); ok {
+		for k, v := range filter {
+			if s, ok := v.(string); ok && s != "" {
+				q.Filters[k] = s
+			}
+		}
+	}
+	if page, ok := p.Args["page"].(map[string]interface{}); ok {
+		q.Limit, _ = page["limit"].(int)
+		q.Offset, _ = page["offset"].(int)
+	}
+	if q.Limit <= 0 || q.Limit > maxPageSize {
+		return nil, fmt.Errorf("The page limit must be between 1 and %d", maxPageSize)
+	} else if q.Offset < 0 {
+		return nil, errors.New("The page offset must not be negative")
+	}
+	if sort, ok := p.Args["sort"].(map[string]interface{}); ok {
+		q.Sort, _ = sort["field"].(string)
+		if desc, _ := sort["desc"].(bool); desc {
+			q.Sort = "-" + q.Sort
+		}
+	}
+
+	models, err := fair.RunQuery(r.sf, q)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*fair.Model, len(models))
+	for i := range models {
+		result[i] = &models[i]
+	}
+	return result, nil
+}
+
+func applyInput(m *fair.Model, input map[string]interface{}) {
+	for _, f := range fields {
+		if v, ok := input[f.name]; ok && v != nil && f.set != nil {
+			f.set(m, v)
+		}
+	}
+}
+
+// version returns the required current version of a mutation, a zero one
+// would change any version
+func version(args map[string]interface{}) (int64, error) {
+	v, _ := args["version"].(int)
+	if v <= 0 {
+		return 0, ErrVersionRequired
+	}
+	return int64(v), nil
+}
+
+func (r *resolver) createFair(p graphql.ResolveParams) (interface{}, error) {
+	m := new(fair.Model)
+	applyInput(m, p.Args["input"].(map[string]interface{}))
+	return r.sf.Create(m)
+}
+
+// primary returns the StreetFair reading from the primary when available,
+// the replicas and the cache may lag the writes
+func (r *resolver) primary() fair.StreetFair {
+	if p, ok := r.sf.(fair.PrimaryReader); ok {
+		return p.Primary()
+	}
+	return r.sf
+}
+
+// updateFair changes the fields of the input, keeping the others of the
+// primary, so stale fields don't overwrite the newer ones
+func (r *resolver) updateFair(p graphql.ResolveParams) (interface{}, error) {
+	v, err := version(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	m, err := r.primary().Get(p.Args["registry"].(string))
+	if err != nil {
+		return nil, err
+	}
+	m.Version = v
+	applyInput(m, p.Args["input"].(map[string]interface{}))
+	if err := r.sf.Update(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (r *resolver) deleteFair(p graphql.ResolveParams) (interface{}, error) {
+	v, err := version(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.sf.Delete(p.Args["registry"].(string), v); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
@@ -0,0 +1,227 @@
+package gql
+
+import (
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// field is a field of the StreetFair type and its column
+type field struct {
+	name   string
+	column string
+	typ    graphql.Output
+	get    func(m *fair.Model) interface{}
+	// set is nil on read-only fields
+	set func(m *fair.Model, v interface{})
+}
+
+func timeString(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func stringField(name, column string, ptr func(m *fair.Model) *string) field {
+	return field{
+		name:   name,
+		column: column,
+		typ:    graphql.String,
+		get:    func(m *fair.Model) interface{} { return *ptr(m) },
+		set:    func(m *fair.Model, v interface{}) { *ptr(m) = v.(string) },
+	}
+}
+
+func floatField(name string, ptr func(m *fair.Model) *float64) field {
+	return field{
+		name:   name,
+		column: name,
+		typ:    graphql.Float,
+		get:    func(m *fair.Model) interface{} { return *ptr(m) },
+		set:    func(m *fair.Model, v interface{}) { *ptr(m) = v.(float64) },
+	}
+}
+
+var fields = []field{
+	floatField("longitude", func(m *fair.Model) *float64 { return &m.Longitude }),
+	floatField("latitude", func(m *fair.Model) *float64 { return &m.Latitude }),
+	stringField("setcens", "setcens", func(m *fair.Model) *string { return &m.Setcens }),
+	stringField("areap", "areap", func(m *fair.Model) *string { return &m.Areap }),
+	stringField("codDistrict", "cod_district", func(m *fair.Model) *string { return &m.CodDistrict }),
+	stringField("district", "district", func(m *fair.Model) *string { return &m.District }),
+	stringField("codSubCityHall", "cod_sub_city_hall", func(m *fair.Model) *string { return &m.CodSubCityHall }),
+	stringField("subCityHall", "sub_city_hall", func(m *fair.Model) *string { return &m.SubCityHall }),
+	stringField("region5", "region5", func(m *fair.Model) *string { return &m.Region5 }),
+	stringField("region8", "region8", func(m *fair.Model) *string { return &m.Region8 }),
+	stringField("name", "name", func(m *fair.Model) *string { return &m.Name }),
+	stringField("registry", "registry", func(m *fair.Model) *string { return &m.Registry }),
+	stringField("address", "address", func(m *fair.Model) *string { return &m.Address }),
+	stringField("addressNumber", "address_number", func(m *fair.Model) *string { return &m.AddressNumber }),
+	stringField("neighborhood", "neighborhood", func(m *fair.Model) *string { return &m.Neighborhood }),
+	stringField("landmark", "landmark", func(m *fair.Model) *string { return &m.Landmark }),
+	{name: "version", column: "version", typ: graphql.Int, get: func(m *fair.Model) interface{} { return m.Version }},
+	{name: "createdAt", column: "created_at", typ: graphql.String, get: func(m *fair.Model) interface{} { return timeString(m.CreatedAt) }},
+	{name: "updatedAt", column: "updated_at", typ: graphql.String, get: func(m *fair.Model) interface{} { return timeString(m.UpdatedAt) }},
+}
+
+var columnByField = func() map[string]string {
+	columns := make(map[string]string, len(fields))
+	for _, f := range fields {
+		columns[f.name] = f.column
+	}
+	return columns
+}()
+
+var sortFields = graphql.NewEnum(graphql.EnumConfig{
+	Name: "SortField",
+	Values: graphql.EnumValueConfigMap{
+		"REGISTRY":     {Value: "registry"},
+		"NAME":         {Value: "name"},
+		"DISTRICT":     {Value: "district"},
+		"REGION5":      {Value: "region5"},
+		"NEIGHBORHOOD": {Value: "neighborhood"},
+		"UPDATED_AT":   {Value: "updated_at"},
+	},
+})
+
+// selectedColumns returns the columns of the fields selected on the street
+// fairs, the registry is always selected to identify them
+func selectedColumns(info graphql.ResolveInfo) []string {
+	seen := map[string]bool{"registry": true}
+	columns := []string{"registry"}
+
+	var walk func(set *ast.SelectionSet)
+	walk = func(set *ast.SelectionSet) {
+		if set == nil {
+			return
+		}
+		for _, selection := range set.Selections {
+			switch s := selection.(type) {
+			case *ast.Field:
+				if c, ok := columnByField[s.Name.Value]; ok && !seen[c] {
+					seen[c] = true
+					columns = append(columns, c)
+				}
+			case *ast.InlineFragment:
+				walk(s.SelectionSet)
+			case *ast.FragmentSpread:
+				if fragment, ok := info.Fragments[s.Name.Value].(*ast.FragmentDefinition); ok && !seen["..."+s.Name.Value] {
+					seen["..."+s.Name.Value] = true
+					walk(fragment.SelectionSet)
+				}
+			}
+		}
+	}
+	for _, f := range info.FieldASTs {
+		walk(f.SelectionSet)
+	}
+	return columns
+}
+
+func newSchema(sf fair.StreetFair) (graphql.Schema, error) {
+	streetFairFields := graphql.Fields{}
+	inputFields := graphql.InputObjectConfigFieldMap{}
+	for _, f := range fields {
+		f := f
+		streetFairFields[f.name] = &graphql.Field{
+			Type: f.typ,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return f.get(p.Source.(*fair.Model)), nil
+			},
+		}
+		if f.set != nil && f.name != "registry" {
+			inputFields[f.name] = &graphql.InputObjectFieldConfig{Type: f.typ}
+		}
+	}
+	streetFair := graphql.NewObject(graphql.ObjectConfig{Name: "StreetFair", Fields: streetFairFields})
+
+	createInputFields := graphql.InputObjectConfigFieldMap{
+		"registry": {Type: graphql.NewNonNull(graphql.String)},
+	}
+	for name, f := range inputFields {
+		createInputFields[name] = f
+	}
+	createInput := graphql.NewInputObject(graphql.InputObjectConfig{Name: "CreateStreetFairInput", Fields: createInputFields})
+	updateInput := graphql.NewInputObject(graphql.InputObjectConfig{Name: "UpdateStreetFairInput", Fields: inputFields})
+
+	filter := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "FairFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"district":     {Type: graphql.String},
+			"region5":      {Type: graphql.String},
+			"name":         {Type: graphql.String},
+			"neighborhood": {Type: graphql.String},
+		},
+	})
+	page := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "Page",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"limit":  {Type: graphql.Int, DefaultValue: defaultPageSize},
+			"offset": {Type: graphql.Int, DefaultValue: 0},
+		},
+	})
+	sort := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "Sort",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field": {Type: graphql.NewNonNull(sortFields)},
+			"desc":  {Type: graphql.Boolean, DefaultValue: false},
+		},
+	})
+
+	r := &resolver{sf: sf}
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"fair": &graphql.Field{
+				Type:    streetFair,
+				Args:    graphql.FieldConfigArgument{"registry": {Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: r.fair,
+			},
+			"fairs": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(streetFair))),
+				Args: graphql.FieldConfigArgument{
+					"filter": {Type: filter},
+					"page":   {Type: page},
+					"sort":   {Type: sort},
+				},
+				Resolve: r.fairs,
+			},
+		},
+	})
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createFair": &graphql.Field{
+				Type:    streetFair,
+				Args:    graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(createInput)}},
+				Resolve: r.createFair,
+			},
+			"updateFair": &graphql.Field{
+				Type: streetFair,
+				Args: graphql.FieldConfigArgument{
+					"registry": {Type: graphql.NewNonNull(graphql.String)},
+					"version":  {Type: graphql.NewNonNull(graphql.Int), Description: "The required current version"},
+					"input":    {Type: graphql.NewNonNull(updateInput)},
+				},
+				Resolve: r.updateFair,
+			},
+			"deleteFair": &graphql.Field{
+				Type: graphql.Boolean,
+				Args: graphql.FieldConfigArgument{
+					"registry": {Type: graphql.NewNonNull(graphql.String)},
+					"version":  {Type: graphql.NewNonNull(graphql.Int), Description: "The required current version"},
+				},
+				Resolve: r.deleteFair,
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
@@ -0,0 +1,202 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+	maxKeyLength   = 255
+	maxBodySize    = 10 << 20
+)
+
+var (
+	ErrKeyTooLong   = errors.New("Idempotency key is too long")
+	ErrKeyReused    = errors.New("Idempotency key was used with a different request")
+	ErrKeyInProcess = errors.New("A request with the same idempotency key is in progress")
+)
+
+// replayedHeaders are the response headers stored to be replayed
+var replayedHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Location"}
+
+type Config struct {
+	TTL time.Duration `default:"24h"`
+	// Lease is how long a request in progress holds its key, a retry
+	// after it runs the request again (f.ex. when the instance crashed)
+	Lease time.Duration `default:"1m"`
+}
+
+// NewConfig returns the settings from the `FAIR_IDEMPOTENCY_*` env vars
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_idempotency", conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+type Idempotency struct {
+	store Store
+	ttl   time.Duration
+	lease time.Duration
+	log   *logrus.Logger
+}
+
+type errResp struct {
+	Msg string `json:"msg"`
+}
+
+func errorResponse(w http.ResponseWriter, err error, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&errResp{Msg: err.Error()})
+}
+
+// recorder writes the response through while keeping a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec *Record) {
+	for k, values := range rec.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// Handler makes next idempotent for requests with the `Idempotency-Key`
+// header: the first response is stored and replayed on retries with the
+// same request, reusing the key with a different request is rejected
+func (i *Idempotency) Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next(w, r)
+			return
+		} else if len(key) > maxKeyLength {
+			errorResponse(w, ErrKeyTooLong, http.StatusBadRequest)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			errorResponse(w, err, http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash := requestHash(r, body)
+
+		ctx := r.Context()
+		now := time.Now()
+		existing, err := i.store.Reserve(ctx, key, hash, now.Add(i.lease), now.Add(-i.ttl))
+		if err != nil {
+			i.log.WithField("key", key).Errorf("Reserving idempotency key: %+v", err)
+			errorResponse(w, errors.New("InternalServerError"), http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != hash:
+				errorResponse(w, ErrKeyReused, http.StatusUnprocessableEntity)
+			case existing.Status == 0:
+				errorResponse(w, ErrKeyInProcess, http.StatusConflict)
+			default:
+				replay(w, existing)
+			}
+			return
+		}
+
+		// the key must be released even when the request panics or the
+		// client disconnects
+		release := func() {
+			if err := i.store.Release(context.Background(), key); err != nil {
+				i.log.WithField("key", key).Errorf("Releasing idempotency key: %+v", err)
+			}
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				release()
+				panic(p)
+			}
+		}()
+
+		rec := &recorder{ResponseWriter: w}
+		next(rec, r)
+
+		ctx = context.Background()
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			release()
+			return
+		}
+
+		header := make(http.Header)
+		for _, h := range replayedHeaders {
+			for _, v := range rec.Header().Values(h) {
+				header.Add(h, v)
+			}
+		}
+		if err := i.store.Complete(ctx, key, rec.status, header, rec.body.Bytes()); err != nil {
+			i.log.WithField("key", key).Errorf("Storing idempotent response: %+v", err)
+		}
+	}
+}
+
+// Watch purges the expired keys periodically until ctx is done
+func (i *Idempotency) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.store.Purge(ctx, time.Now().Add(-i.ttl)); err != nil {
+				i.log.Errorf("Purging idempotency keys: %+v", err)
+			}
+		}
+	}
+}
+
+// New returns an Idempotency keeping the responses on store for ttl, the
+// keys of the requests in progress are held for lease
+func New(store Store, ttl, lease time.Duration, log *logrus.Logger) *Idempotency {
+	return &Idempotency{store: store, ttl: ttl, lease: lease, log: log}
+}
@@ -0,0 +1,191 @@
+package idempotency
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/migrations"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newStore(t *testing.T) Store {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "fair.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrations.New(db, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(db)
+}
+
+type countingHandler struct {
+	calls  int
+	status int
+}
+
+func (c *countingHandler) handle(w http.ResponseWriter, r *http.Request) {
+	c.calls++
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"1"`)
+	w.WriteHeader(c.status)
+	_, _ = w.Write(body)
+}
+
+func do(h http.HandlerFunc, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	return rr
+}
+
+func TestHandlerWithoutKey(t *testing.T) {
+	c := &countingHandler{status: http.StatusCreated}
+	h := New(newStore(t), time.Hour, time.Minute, logrus.New()).Handler(c.handle)
+
+	for i := 0; i < 2; i++ {
+		if rr := do(h, "", `{"registry":"4041-0"}`); rr.Code != http.StatusCreated {
+			t.Errorf("got %d; want %d", rr.Code, http.StatusCreated)
+		}
+	}
+	if c.calls != 2 {
+		t.Errorf("got %d calls; want 2", c.calls)
+	}
+}
+
+func TestHandlerReplay(t *testing.T) {
+	c := &countingHandler{status: http.StatusCreated}
+	h := New(newStore(t), time.Hour, time.Minute, logrus.New()).Handler(c.handle)
+
+	first := do(h, "abc", `{"registry":"4041-0"}`)
+	retry := do(h, "abc", `{"registry":"4041-0"}`)
+
+	if c.calls != 1 {
+		t.Errorf("got %d calls; want 1", c.calls)
+	}
+	if retry.Code != first.Code {
+		t.Errorf("got %d; want %d", retry.Code, first.Code)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("got %s; want %s", retry.Body.String(), first.Body.String())
+	}
+	if actual := retry.Header().Get("ETag"); actual != `"1"` {
+		t.Errorf("got %s; want \"1\"", actual)
+	}
+	if actual := retry.Header().Get(ReplayedHeader); actual != "true" {
+		t.Errorf("got %s; want true", actual)
+	}
+}
+
+func TestHandlerKeyReused(t *testing.T) {
+	c := &countingHandler{status: http.StatusCreated}
+	h := New(newStore(t), time.Hour, time.Minute, logrus.New()).Handler(c.handle)
+
+	do(h, "abc", `{"registry":"4041-0"}`)
+	if rr := do(h, "abc", `{"registry":"4045-2"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if c.calls != 1 {
+		t.Errorf("got %d calls; want 1", c.calls)
+	}
+}
+
+func TestHandlerInProgress(t *testing.T) {
+	store := newStore(t)
+	c := &countingHandler{status: http.StatusCreated}
+	h := New(store, time.Hour, time.Minute, logrus.New()).Handler(c.handle)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	if _, err := store.Reserve(context.Background(), "abc", requestHash(req, []byte(`{}`)), time.Now().Add(time.Minute), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := do(h, "abc", `{}`); rr.Code != http.StatusConflict {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestHandlerServerErrorReleasesKey(t *testing.T) {
+	c := &countingHandler{status: http.StatusInternalServerError}
+	h := New(newStore(t), time.Hour, time.Minute, logrus.New()).Handler(c.handle)
+
+	do(h, "abc", `{}`)
+	c.status = http.StatusCreated
+	if rr := do(h, "abc", `{}`); rr.Code != http.StatusCreated {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusCreated)
+	}
+	if c.calls != 2 {
+		t.Errorf("got %d calls; want 2", c.calls)
+	}
+}
+
+func TestHandlerExpiredKey(t *testing.T) {
+	c := &countingHandler{status: http.StatusCreated}
+	h := New(newStore(t), -time.Second, time.Minute, logrus.New()).Handler(c.handle)
+
+	do(h, "abc", `{}`)
+	if rr := do(h, "abc", `{"other":"body"}`); rr.Code != http.StatusCreated {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusCreated)
+	}
+	if c.calls != 2 {
+		t.Errorf("got %d calls; want 2", c.calls)
+	}
+}
+
+func TestHandlerExpiredLease(t *testing.T) {
+	store := newStore(t)
+	c := &countingHandler{status: http.StatusCreated}
+	h := New(store, time.Hour, time.Minute, logrus.New()).Handler(c.handle)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	if _, err := store.Reserve(context.Background(), "abc", requestHash(req, []byte(`{}`)), time.Now().Add(-time.Second), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := do(h, "abc", `{}`); rr.Code != http.StatusCreated {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusCreated)
+	}
+	if c.calls != 1 {
+		t.Errorf("got %d calls; want 1", c.calls)
+	}
+}
+
+func TestHandlerPanicReleasesKey(t *testing.T) {
+	c := &countingHandler{status: http.StatusCreated}
+	i := New(newStore(t), time.Hour, time.Minute, logrus.New())
+	panicking := i.Handler(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("got %v; want boom", p)
+			}
+		}()
+		do(panicking, "abc", `{}`)
+	}()
+
+	if rr := do(i.Handler(c.handle), "abc", `{}`); rr.Code != http.StatusCreated {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusCreated)
+	}
+	if c.calls != 1 {
+		t.Errorf("got %d calls; want 1", c.calls)
+	}
+}
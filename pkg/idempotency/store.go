@@ -0,0 +1,125 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Record is a request seen with an idempotency key, Status is zero
+// while the request is in progress and LockedUntil is when its
+// reservation can be reclaimed
+type Record struct {
+	Key         string
+	RequestHash string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	LockedUntil *time.Time
+}
+
+// Store keeps the records of idempotency keys
+type Store interface {
+	// Reserve stores an in progress record for key locked until
+	// lockedUntil, when key is already taken (not expired nor an in
+	// progress record past its lock) it returns the existing record
+	Reserve(ctx context.Context, key, requestHash string, lockedUntil, expiresBefore time.Time) (existing *Record, err error)
+	// Complete stores the response of the request of key
+	Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error
+	// Release removes key so the request can be retried
+	Release(ctx context.Context, key string) error
+	// Purge removes the records created before t
+	Purge(ctx context.Context, t time.Time) error
+}
+
+type row struct {
+	IdempotencyKey string `gorm:"primaryKey"`
+	RequestHash    string
+	Status         int
+	Header         string
+	Body           []byte
+	CreatedAt      time.Time
+	LockedUntil    *time.Time
+}
+
+func (row) TableName() string {
+	return "idempotency_keys"
+}
+
+type dbStore struct {
+	db *gorm.DB
+}
+
+func (s *dbStore) Reserve(ctx context.Context, key, requestHash string, lockedUntil, expiresBefore time.Time) (*Record, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+	r := db.Where("idempotency_key = ? AND (created_at < ? OR (status = 0 AND (locked_until IS NULL OR locked_until < ?)))", key, expiresBefore, now).
+		Delete(&row{})
+	if r.Error != nil {
+		return nil, r.Error
+	}
+
+	r = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row{
+		IdempotencyKey: key,
+		RequestHash:    requestHash,
+		CreatedAt:      now,
+		LockedUntil:    &lockedUntil,
+	})
+	if r.Error != nil {
+		return nil, r.Error
+	} else if r.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	var existing row
+	if err := db.Where("idempotency_key = ?", key).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.Reserve(ctx, key, requestHash, lockedUntil, expiresBefore)
+		}
+		return nil, err
+	}
+
+	rec := &Record{
+		Key:         existing.IdempotencyKey,
+		RequestHash: existing.RequestHash,
+		Status:      existing.Status,
+		Body:        existing.Body,
+		CreatedAt:   existing.CreatedAt,
+		LockedUntil: existing.LockedUntil,
+	}
+	if existing.Header != "" {
+		if err := json.Unmarshal([]byte(existing.Header), &rec.Header); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+func (s *dbStore) Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Model(&row{}).
+		Where("idempotency_key = ?", key).
+		Updates(map[string]interface{}{"status": status, "header": string(h), "body": body}).Error
+}
+
+func (s *dbStore) Release(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("idempotency_key = ?", key).Delete(&row{}).Error
+}
+
+func (s *dbStore) Purge(ctx context.Context, t time.Time) error {
+	return s.db.WithContext(ctx).Where("created_at < ?", t).Delete(&row{}).Error
+}
+
+// NewStore returns a Store on the table `idempotency_keys` of db
+func NewStore(db *gorm.DB) Store {
+	return &dbStore{db: db}
+}
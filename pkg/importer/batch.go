@@ -0,0 +1,63 @@
+package importer
+
+import (
+	"errors"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+var (
+	ErrAtomicUnsupported = errors.New("The street fairs can't be imported atomically")
+	ErrModeUnsupported   = errors.New("The street fairs can only be created")
+)
+
+// rowBatch creates the street fairs one by one, for the creators that
+// aren't a fair.Batcher (f.ex. the API client)
+type rowBatch struct {
+	sf streetFairCreator
+}
+
+func (b *rowBatch) Create(models []*fair.Model) []error {
+	var errs []error
+	for i, m := range models {
+		if _, err := b.sf.Create(m); err != nil {
+			if errs == nil {
+				errs = make([]error, len(models))
+			}
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+func (b *rowBatch) Upsert(models []*fair.Model) []fair.UpsertResult {
+	results := make([]fair.UpsertResult, len(models))
+	for i := range results {
+		results[i].Err = ErrModeUnsupported
+	}
+	return results
+}
+
+func (b *rowBatch) DeleteMissing(keep map[string]bool) (int, error) {
+	return 0, ErrModeUnsupported
+}
+
+func (b *rowBatch) Commit() error {
+	return nil
+}
+
+func (b *rowBatch) Rollback() error {
+	return nil
+}
+
+// batch returns the fair.Batch of the import
+func (imp *Importer) batch() (fair.Batch, error) {
+	if batcher, ok := imp.sf.(fair.Batcher); ok {
+		return batcher.Batch(imp.conf.Atomic)
+	} else if imp.conf.Atomic {
+		return nil, ErrAtomicUnsupported
+	} else if imp.conf.Mode != ModeCreate {
+		return nil, ErrModeUnsupported
+	}
+	return &rowBatch{sf: imp.sf}, nil
+}
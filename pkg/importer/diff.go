@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+var ErrDryRunUnsupported = errors.New("The street fairs can't be compared")
+
+// Diff is what the import of a file would change on the stored street fairs
+type Diff struct {
+	Mode      string           `json:"mode"`
+	Rows      int              `json:"rows"`
+	New       []*fair.Model    `json:"new"`
+	Changed   []fair.ModelDiff `json:"changed"`
+	Unchanged int              `json:"unchanged"`
+	// Missing are the stored street fairs absent from the file, only
+	// deleted by a sync
+	Missing []string `json:"missing"`
+	// Invalid are the errors of the invalid rows, left out of the diff
+	Invalid []RowError `json:"invalid"`
+}
+
+// HasChanges tells whether the import would change the stored street
+// fairs, by its mode
+func (d *Diff) HasChanges() bool {
+	switch d.Mode {
+	case ModeSync:
+		return len(d.New) > 0 || len(d.Changed) > 0 || len(d.Missing) > 0
+	case ModeUpsert:
+		return len(d.New) > 0 || len(d.Changed) > 0
+	}
+	return len(d.New) > 0
+}
+
+func (d *Diff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// WriteText writes the diff for humans, as a list of the changes by registry
+func (d *Diff) WriteText(w io.Writer) error {
+	invalid := make(map[int]bool)
+	for _, e := range d.Invalid {
+		invalid[e.Line] = true
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d rows: %d new, %d changed, %d unchanged, %d missing, %d invalid (mode %s)\n",
+		d.Rows, len(d.New), len(d.Changed), d.Unchanged, len(d.Missing), len(invalid), d.Mode)
+	for _, m := range d.New {
+		fmt.Fprintf(&b, "+ %s %s\n", m.Registry, m.Name)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", c.Registry)
+		for _, f := range c.Fields {
+			fmt.Fprintf(&b, "    %s: %s -> %s\n", f.Field, formatValue(f.Old), formatValue(f.New))
+		}
+	}
+	for _, registry := range d.Missing {
+		fmt.Fprintf(&b, "- %s\n", registry)
+	}
+	for i := range d.Invalid {
+		fmt.Fprintf(&b, "! line %d %s: %s\n", d.Invalid[i].Line, d.Invalid[i].Registry, d.Invalid[i].Error())
+	}
+	if !d.HasChanges() {
+		b.WriteString("No changes\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// DryRun compares the file of filePath to the stored street fairs,
+// without writing
+func (imp *Importer) DryRun(filePath string) (*Diff, error) {
+	differ, ok := imp.sf.(fair.Differ)
+	if !ok {
+		return nil, ErrDryRunUnsupported
+	}
+
+	d := &Diff{
+		Mode:    imp.conf.Mode,
+		New:     []*fair.Model{},
+		Changed: []fair.ModelDiff{},
+		Missing: []string{},
+		Invalid: []RowError{},
+	}
+	// the invalid rows are only collected, not written
+	rej := &rejects{report: &Report{}}
+	seen := make(map[string]bool)
+	p, err := imp.read(filePath, rej, seen, func(s *Summary, batch []record) error {
+		valid := make([]*fair.Model, len(batch))
+		for i := range batch {
+			valid[i] = batch[i].model
+		}
+
+		diffs, err := differ.Diff(valid)
+		if err != nil {
+			return err
+		}
+		for i, diff := range diffs {
+			switch diff.Change {
+			case fair.Created:
+				d.New = append(d.New, valid[i])
+				s.Created++
+			case fair.Updated:
+				d.Changed = append(d.Changed, diff)
+				s.Updated++
+			default:
+				d.Unchanged++
+				s.Unchanged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Missing, err = differ.Missing(seen); err != nil {
+		return nil, err
+	} else if d.Missing == nil {
+		d.Missing = []string{}
+	}
+	d.Rows = p.Rows
+	d.Invalid = append(d.Invalid, rej.report.Errors...)
+	imp.log.WithFields(p.fields()).
+		WithField("missing", len(d.Missing)).
+		WithField("duration", time.Since(p.start).Round(time.Millisecond).String()).
+		Info("Compared")
+	return d, nil
+}
@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var (
+	ErrInvalidEncoding  = errors.New("Invalid encoding")
+	ErrInvalidDelimiter = errors.New("Invalid delimiter")
+)
+
+const (
+	// EncodingAuto detects the encoding by the BOM, falling back to
+	// Windows-1252 when the start of the file isn't valid UTF-8
+	EncodingAuto = "auto"
+	// DelimiterAuto detects the delimiter by the header
+	DelimiterAuto = "auto"
+)
+
+// sniffSize is how much of the file is read to detect its encoding
+const sniffSize = 64 * 1024
+
+// encodings are the encodings by name, nil is UTF-8
+var encodings = map[string]encoding.Encoding{
+	"utf-8":        nil,
+	"utf8":         nil,
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"iso-8859-1":   charmap.ISO8859_1,
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+}
+
+// delimiters are the delimiters detected by DelimiterAuto
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// ValidEncoding tells whether name is a known encoding or EncodingAuto
+func ValidEncoding(name string) bool {
+	if name == "" || name == EncodingAuto {
+		return true
+	}
+	_, ok := encodings[strings.ToLower(name)]
+	return ok
+}
+
+// parseDelimiter returns the delimiter of name (a single character or
+// `tab`), 0 for DelimiterAuto
+func parseDelimiter(name string) (rune, error) {
+	switch name {
+	case "", DelimiterAuto:
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	d, size := utf8.DecodeRuneInString(name)
+	if size != len(name) || d == '"' || d == '\r' || d == '\n' || d == utf8.RuneError {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidDelimiter, name)
+	}
+	return d, nil
+}
+
+// validUTF8 tells whether b is UTF-8, ignoring a rune cut at its end
+func validUTF8(b []byte) bool {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				b = b[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(b)
+}
+
+// validRow tells whether the fields of row are UTF-8, a file detected as
+// UTF-8 by its start may have other encoding after it
+func validRow(row []string) bool {
+	for _, field := range row {
+		if !utf8.ValidString(field) {
+			return false
+		}
+	}
+	return true
+}
+
+// decode returns r transcoded to UTF-8 from the encoding of name, or the
+// detected one on EncodingAuto, and the name of the encoding. The BOM is
+// dropped
+func decode(r io.Reader, name string) (io.Reader, string, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		name = EncodingAuto
+	}
+	br := bufio.NewReaderSize(r, sniffSize)
+	start, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	if name == EncodingAuto {
+		switch {
+		case bytes.HasPrefix(start, []byte{0xef, 0xbb, 0xbf}):
+			name = "utf-8"
+		case bytes.HasPrefix(start, []byte{0xff, 0xfe}):
+			name = "utf-16le"
+		case bytes.HasPrefix(start, []byte{0xfe, 0xff}):
+			name = "utf-16be"
+		case validUTF8(start):
+			name = "utf-8"
+		default:
+			name = "windows-1252"
+		}
+	}
+	enc, ok := encodings[name]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %q", ErrInvalidEncoding, name)
+	}
+	if enc == nil {
+		if bytes.HasPrefix(start, []byte{0xef, 0xbb, 0xbf}) {
+			_, _ = br.Discard(3)
+		}
+		return br, name, nil
+	}
+	return transform.NewReader(br, enc.NewDecoder()), name, nil
+}
+
+// detectDelimiter returns the most frequent of the delimiters on the
+// first line of r, the comma when there is none
+func detectDelimiter(r *bufio.Reader) rune {
+	line, _ := r.Peek(r.Size())
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	delimiter, max := ',', 0
+	for _, d := range delimiters {
+		if n := bytes.Count(line, []byte(string(d))); n > max {
+			delimiter, max = d, n
+		}
+	}
+	return delimiter
+}
@@ -1,107 +1,386 @@
 package importer
 
 import (
-	"encoding/csv"
 	"errors"
-	"os"
+	"fmt"
+	"io"
 	"strconv"
+	"time"
 
 	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/kelseyhightower/envconfig"
 	"github.com/sirupsen/logrus"
 )
 
+// The modes of import
 const (
-	LONG = iota + 1
-	LAT
-	SETCENS
-	AREAP
-	CODDIST
-	DISTRITO
-	CODSUBPREF
-	SUBPREFE
-	REGIAO5
-	REGIAO8
-	NOME_FEIRA
-	REGISTRO
-	LOGRADOURO
-	NUMERO
-	BAIRRO
-	REFERENCIA
+	// ModeCreate only creates the street fairs, skipping the existing ones
+	ModeCreate = "create"
+	// ModeUpsert also updates the existing street fairs that changed
+	ModeUpsert = "upsert"
+	// ModeSync also deletes the street fairs missing from the file
+	ModeSync = "sync"
 )
 
+var (
+	ErrInvalidFile = errors.New("Invalid import file")
+	ErrInvalidMode = errors.New("Invalid import mode")
+	// ErrSyncIncomplete is a sync that didn't delete the missing street
+	// fairs, as some rejected record had no registry
+	ErrSyncIncomplete = errors.New("The missing street fairs weren't deleted")
+)
+
+// ValidMode tells whether mode is a mode of import
+func ValidMode(mode string) bool {
+	return mode == ModeCreate || mode == ModeUpsert || mode == ModeSync
+}
+
+type Config struct {
+	// BatchSize is the number of rows read before they are created
+	BatchSize int `split_words:"true" default:"500"`
+	// Progress is how often the progress is logged
+	Progress time.Duration `default:"10s"`
+	// Mapping is the path of a JSON or YAML file mapping the columns,
+	// DefaultMapping when empty
+	Mapping string
+	// Atomic imports the whole file in a single transaction, nothing is
+	// imported when some row fails. Otherwise each batch is committed
+	Atomic bool
+	// Mode is how the existing street fairs are handled, see ModeCreate
+	Mode string `default:"create"`
+	// DryRun only compares the file to the stored street fairs, see DryRun
+	DryRun bool `split_words:"true"`
+	// Report is the path of the JSON report of the import, if any
+	Report string
+	// Rejects is the path of a CSV file with the rejected rows and their
+	// errors (on the added `error` column), if any
+	Rejects string
+	// Encoding is the encoding of the file (f.ex. `iso-8859-1`), detected
+	// on EncodingAuto
+	Encoding string `default:"auto"`
+	// Delimiter is the delimiter of the fields (a character or `tab`),
+	// detected by the header on DelimiterAuto
+	Delimiter string `default:"auto"`
+	// LazyQuotes accepts quotes inside the unquoted fields and the
+	// unescaped ones inside the quoted fields
+	LazyQuotes bool `split_words:"true"`
+	// Ragged accepts rows with other number of fields than the header,
+	// the missing fields are empty. Otherwise they're rejected
+	Ragged bool
+	// Format is the format of the file (f.ex. `xlsx`), by its extension
+	// on FormatAuto
+	Format string `default:"auto"`
+	// Sheet is the name or the number of the sheet of a XLSX file, the
+	// first one when empty
+	Sheet string
+}
+
+// NewConfig returns the settings from the `FAIR_IMPORT_*` env vars
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_import", conf); err != nil {
+		return nil, err
+	}
+	if conf.BatchSize < 1 {
+		return nil, errors.New("FAIR_IMPORT_BATCH_SIZE must be positive")
+	}
+	if !ValidMode(conf.Mode) {
+		return nil, ErrInvalidMode
+	}
+	if !ValidEncoding(conf.Encoding) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidEncoding, conf.Encoding)
+	}
+	if _, err := parseDelimiter(conf.Delimiter); err != nil {
+		return nil, err
+	}
+	if !ValidFormat(conf.Format) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidFormat, conf.Format)
+	}
+	return conf, nil
+}
+
 type streetFairCreator interface {
 	Create(m *fair.Model) (*fair.Model, error)
 }
 
 type Importer struct {
-	log *logrus.Logger
-	sf  streetFairCreator
+	log  *logrus.Logger
+	sf   streetFairCreator
+	conf *Config
+}
+
+// record is a valid row of the file with its street fair
+type record struct {
+	line  int
+	row   []string
+	model *fair.Model
 }
 
-func readFile(filePath string) ([][]string, error) {
-	csvFile, err := os.Open(filePath)
+// model returns the street fair of a row, or why it's invalid
+func (imp *Importer) model(b *binding, line []string) (*fair.Model, []RowError) {
+	m := new(fair.Model)
+	var errs []RowError
+	registry := b.registry.value(line)
+	if registry == "" {
+		errs = append(errs, RowError{Field: "registry", Reason: "empty"})
+	}
+	for i := range b.columns {
+		c := &b.columns[i]
+		v := c.value(line)
+		if f := fields[c.Field]; f.float == nil {
+			f.text(m, v)
+		} else if v != "" {
+			n, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				errs = append(errs, RowError{Registry: registry, Field: c.Field, Reason: fmt.Sprintf("invalid number %q", v)})
+				continue
+			}
+			f.float(m, n)
+		}
+	}
+	return m, errs
+}
+
+// mapping returns the mapping of the config
+func (imp *Importer) mapping() (*Mapping, error) {
+	if imp.conf.Mapping == "" {
+		return DefaultMapping(), nil
+	}
+	return LoadMapping(imp.conf.Mapping)
+}
+
+// create creates (or upserts, by the mode) the street fairs of a batch,
+// counting them on s and rejecting the failed ones
+func (imp *Importer) create(b fair.Batch, batch []record, s *Summary, rej *rejects) error {
+	models := make([]*fair.Model, len(batch))
+	for i := range batch {
+		models[i] = batch[i].model
+	}
+	failed := func(i int, err error) error {
+		imp.log.WithField("registry", models[i].Registry).Warningf("Skipped: %+v", err)
+		s.Failed++
+		return rej.reject(batch[i].row, []RowError{{Line: batch[i].line, Registry: models[i].Registry, Reason: err.Error()}})
+	}
+
+	if imp.conf.Mode == ModeCreate {
+		errs := b.Create(models)
+		for i := range models {
+			if errs != nil && errs[i] != nil {
+				if err := failed(i, errs[i]); err != nil {
+					return err
+				}
+				continue
+			}
+			s.Created++
+		}
+		return nil
+	}
+
+	for i, r := range b.Upsert(models) {
+		switch {
+		case r.Err != nil:
+			if err := failed(i, r.Err); err != nil {
+				return err
+			}
+		case r.Change == fair.Created:
+			s.Created++
+		case r.Change == fair.Updated:
+			s.Updated++
+		default:
+			s.Unchanged++
+		}
+	}
+	return nil
+}
+
+// read streams the valid rows of the file of filePath to flush in
+// batches, rejecting the invalid ones. The registries of the file are
+// added to seen, when not nil. The columns are found by the header,
+// failing before reading the rows when some is missing
+func (imp *Importer) read(filePath string, rej *rejects, seen map[string]bool, flush func(s *Summary, batch []record) error) (*progress, error) {
+	mapping, err := imp.mapping()
 	if err != nil {
 		return nil, err
 	}
+	src, err := openSource(filePath, imp.conf, mapping)
+	if err != nil {
+		return nil, err
+	}
+	defer src.close()
 
-	defer csvFile.Close()
-	lines, err := csv.NewReader(csvFile).ReadAll()
+	b, err := mapping.bind(src.header())
 	if err != nil {
 		return nil, err
 	}
-	if len(lines) == 0 {
-		return nil, errors.New("Invalid CSV file")
+	if imp.conf.Rejects != "" && !imp.conf.DryRun {
+		if err := rej.open(imp.conf.Rejects, src.header()); err != nil {
+			return nil, err
+		}
+	}
+	counter, size := src.progress()
+	p := newProgress(size, counter, time.Now())
+	imp.log.WithFields(src.fields()).WithFields(logrus.Fields{
+		"size":    size,
+		"mode":    imp.conf.Mode,
+		"atomic":  imp.conf.Atomic,
+		"dry_run": imp.conf.DryRun,
+	}).Info("Starting")
+
+	batch := make([]record, 0, imp.conf.BatchSize)
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := flush(&p.Summary, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		if now := time.Now(); now.Sub(p.reported) >= imp.conf.Progress {
+			p.report(imp.log, now)
+		}
+		return nil
+	}
+	for {
+		line, err := src.next()
+		if err == io.EOF {
+			break
+		} else if err == nil && !validRow(line) {
+			// the encoding was detected by the start of the file
+			err = &recordError{reason: "invalid UTF-8, set the encoding of the file (f.ex. -encoding iso-8859-1)"}
+		}
+		var invalid *recordError
+		if errors.As(err, &invalid) {
+			p.Rows++
+			p.Failed++
+			e := RowError{Line: src.line(), Registry: b.registry.value(line), Reason: invalid.reason}
+			// the street fair of a rejected record isn't missing from the file
+			if e.Registry == "" {
+				p.unidentified++
+			} else if seen != nil {
+				seen[e.Registry] = true
+			}
+			// the records that can't be rows are kept as read
+			if invalid.raw != nil {
+				line = []string{string(invalid.raw)}
+			}
+			if err := rej.reject(line, []RowError{e}); err != nil {
+				return p, err
+			}
+			continue
+		} else if err != nil {
+			return p, err
+		}
+		p.Rows++
+		m, errs := imp.model(b, line)
+		if seen != nil && m.Registry != "" {
+			seen[m.Registry] = true
+		}
+		if len(errs) > 0 {
+			for i := range errs {
+				errs[i].Line = src.line()
+			}
+			p.Failed++
+			if err := rej.reject(line, errs); err != nil {
+				return p, err
+			}
+			continue
+		}
+
+		// the row is reused by the next read
+		batch = append(batch, record{line: src.line(), row: append([]string(nil), line...), model: m})
+		if len(batch) == imp.conf.BatchSize {
+			if err := send(); err != nil {
+				return p, err
+			}
+		}
 	}
-	return lines[1:], nil
+	return p, send()
 }
 
-func (imp *Importer) parseFloat(number, fieldName, registry string) float64 {
-	n, err := strconv.ParseFloat(number, 32)
+// Run imports the file of filePath by its format, streaming its rows in
+// batches so the memory doesn't grow with the size of the file. The
+// report and the rejected rows are written to the files of the config,
+// if any
+func (imp *Importer) Run(filePath string) error {
+	report := &Report{
+		File:      filePath,
+		Mode:      imp.conf.Mode,
+		Atomic:    imp.conf.Atomic,
+		StartedAt: time.Now().UTC(),
+		Errors:    []RowError{},
+	}
+	rej := &rejects{report: report}
+	err := imp.run(filePath, report, rej)
+	if cerr := rej.close(); err == nil {
+		err = cerr
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	report.Duration = report.FinishedAt.Sub(report.StartedAt).Seconds()
 	if err != nil {
-		imp.log.WithField(
-			"registry", registry,
-		).Warningf("Invalid %s: %+v", fieldName, err)
-		return 0
+		report.Error = err.Error()
+	}
+	if imp.conf.Report != "" {
+		if werr := writeReport(imp.conf.Report, report); werr != nil && err == nil {
+			err = werr
+		}
 	}
-	return n
+	return err
 }
 
-func (imp *Importer) Run(filePath string) error {
-	lines, err := readFile(filePath)
+func (imp *Importer) run(filePath string, report *Report, rej *rejects) error {
+	fb, err := imp.batch()
 	if err != nil {
 		return err
 	}
-
-	imp.log.WithField("count", len(lines)).Info("Starting")
-	for _, line := range lines {
-		m := &fair.Model{
-			Longitude:      imp.parseFloat(line[LONG], "longitude", line[REGISTRO]),
-			Latitude:       imp.parseFloat(line[LAT], "latitude", line[REGISTRO]),
-			Setcens:        line[SETCENS],
-			Areap:          line[AREAP],
-			CodDistrict:    line[CODDIST],
-			District:       line[DISTRITO],
-			CodSubCityHall: line[CODSUBPREF],
-			SubCityHall:    line[SUBPREFE],
-			Region5:        line[REGIAO5],
-			Region8:        line[REGIAO8],
-			Name:           line[NOME_FEIRA],
-			Registry:       line[REGISTRO],
-			Address:        line[LOGRADOURO],
-			AddressNumber:  line[NUMERO],
-			Neighborhood:   line[BAIRRO],
-			Landmark:       line[REFERENCIA],
+	committed := false
+	defer func() {
+		if !committed {
+			_ = fb.Rollback()
 		}
-		if _, err = imp.sf.Create(m); err != nil {
-			imp.log.WithField("registry", line[REGISTRO]).Warning("Skipped")
+	}()
+
+	// seen are the registries of the file, kept by a sync
+	var seen map[string]bool
+	if imp.conf.Mode == ModeSync {
+		seen = make(map[string]bool)
+	}
+	p, err := imp.read(filePath, rej, seen, func(s *Summary, batch []record) error {
+		return imp.create(fb, batch, s, rej)
+	})
+	if p != nil {
+		defer func() { report.Summary = p.Summary }()
+	}
+	if err != nil {
+		return err
+	}
+
+	// the file was read to the end, so the missing street fairs are gone,
+	// unless a rejected record could be one of them
+	if imp.conf.Mode == ModeSync && p.unidentified > 0 {
+		return fmt.Errorf("%w: %d rejected records without registry", ErrSyncIncomplete, p.unidentified)
+	} else if imp.conf.Mode == ModeSync {
+		if p.Deleted, err = fb.DeleteMissing(seen); err != nil {
+			return err
 		}
 	}
+
+	committed = true
+	if err := fb.Commit(); errors.Is(err, fair.ErrAborted) {
+		return fmt.Errorf("%w: %d of %d rows failed", err, p.Failed, p.Rows)
+	} else if err != nil {
+		return err
+	}
+	imp.log.WithFields(p.fields()).
+		WithField("duration", time.Since(p.start).Round(time.Millisecond).String()).
+		Info("Imported")
 	return nil
 }
 
-func New(log *logrus.Logger, sf streetFairCreator) *Importer {
+func New(log *logrus.Logger, sf streetFairCreator, conf *Config) *Importer {
 	return &Importer{
-		log: log,
-		sf:  sf,
+		log:  log,
+		sf:   sf,
+		conf: conf,
 	}
 }
@@ -1,10 +1,27 @@
 package importer
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/drgarcia1986/street-fair/pkg/fair"
 	"github.com/drgarcia1986/street-fair/pkg/logs"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
 )
 
 type fakeStreetFair struct {
@@ -16,55 +33,276 @@ func (f *fakeStreetFair) Create(m *fair.Model) (*fair.Model, error) {
 	return m, nil
 }
 
-func TestReadFile(t *testing.T) {
-	lines, err := readFile("./testdata/sample.csv")
+func TestRowReader(t *testing.T) {
+	f, err := os.Open("./testdata/sample.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := newRowReader(f, &Config{})
 	if err != nil {
 		t.Fatalf("want <nil>; got %+v", err)
 	}
+	var districts []string
+	for {
+		line, err := rows.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("want <nil>; got %+v", err)
+		}
+		districts = append(districts, line[6])
+	}
 
-	if actual := len(lines); actual != 3 {
+	if actual := len(districts); actual != 3 {
 		t.Errorf("want 3; got %d", actual)
 	}
-
 	expectedDistrict := "VILA FORMOSA"
-	if actual := lines[0][6]; actual != expectedDistrict {
+	if actual := districts[0]; actual != expectedDistrict {
 		t.Errorf("want %s; got %s", expectedDistrict, actual)
 	}
 }
 
-func TestParseFloat(t *testing.T) {
+func TestRowReaderInvalid(t *testing.T) {
 	var testCases = []struct {
-		num      string
-		expected float64
+		content  string
+		expected error
 	}{
-		{"1", 1},
-		{"20.0", 20.0},
-		{"a", 0},
+		{"", ErrInvalidFile},
+		{"ID,LONG,LAT\n1,2\n", csv.ErrFieldCount},
+	}
+	for _, tt := range testCases {
+		rows, err := newRowReader(strings.NewReader(tt.content), &Config{})
+		if err == nil {
+			_, err = rows.next()
+		}
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("want %+v; got %+v", tt.expected, err)
+		}
 	}
+}
 
-	log, loggerFinalizer, err := logs.New()
+func TestRowReaderOptions(t *testing.T) {
+	latin1 := func(s string) string {
+		b, err := charmap.ISO8859_1.NewEncoder().String(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	utf16 := func(s string) string {
+		b, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	var testCases = []struct {
+		content   string
+		conf      Config
+		encoding  string
+		delimiter rune
+		expected  []string
+	}{
+		{"NOME,BAIRRO\nCONCEIÇÃO,SÉ\n", Config{}, "utf-8", ',', []string{"CONCEIÇÃO", "SÉ"}},
+		{"\ufeffNOME;BAIRRO\nCONCEIÇÃO;SÉ\n", Config{}, "utf-8", ';', []string{"CONCEIÇÃO", "SÉ"}},
+		{latin1("NOME;BAIRRO\nCONCEIÇÃO;SÉ\n"), Config{}, "windows-1252", ';', []string{"CONCEIÇÃO", "SÉ"}},
+		{latin1("NOME|BAIRRO\nCONCEIÇÃO|SÉ\n"), Config{Encoding: "ISO-8859-1", Delimiter: "|"}, "iso-8859-1", '|', []string{"CONCEIÇÃO", "SÉ"}},
+		{utf16("NOME\tBAIRRO\nCONCEIÇÃO\tSÉ\n"), Config{}, "utf-16le", '\t', []string{"CONCEIÇÃO", "SÉ"}},
+		{"NOME,BAIRRO\nPRACA \"SAO\" PAULO,SÉ\n", Config{LazyQuotes: true}, "utf-8", ',', []string{`PRACA "SAO" PAULO`, "SÉ"}},
+		{"NOME,BAIRRO\nCONCEIÇÃO\n", Config{Ragged: true}, "utf-8", ',', []string{"CONCEIÇÃO"}},
+	}
+	for _, tt := range testCases {
+		rows, err := newRowReader(strings.NewReader(tt.content), &tt.conf)
+		if err != nil {
+			t.Fatalf("want <nil>; got %+v", err)
+		}
+		if rows.encoding != tt.encoding || rows.delimiter != tt.delimiter || rows.header()[0] != "NOME" {
+			t.Errorf("want %s %q NOME; got %s %q %s", tt.encoding, tt.delimiter, rows.encoding, rows.delimiter, rows.header()[0])
+		}
+		if row, err := rows.next(); err != nil || !reflect.DeepEqual(row, tt.expected) {
+			t.Errorf("want %q <nil>; got %q %+v", tt.expected, row, err)
+		}
+	}
+
+	for _, conf := range []Config{{Encoding: "ebcdic"}, {Delimiter: ";;"}, {Delimiter: `"`}} {
+		if _, err := newRowReader(strings.NewReader("NOME\n"), &conf); !errors.Is(err, ErrInvalidEncoding) && !errors.Is(err, ErrInvalidDelimiter) {
+			t.Errorf("%+v: want an invalid encoding or delimiter; got %+v", conf, err)
+		}
+	}
+}
+
+// writeXLSX writes a XLSX file of two sheets, `Notes` and `Feiras`
+func writeXLSX(t *testing.T, path string) {
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Feiras" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>REGISTRO</t></si><si><t>NOME_FEIRA</t></si><si><r><t>VILA </t></r><r><t>FORMOSA</t></r></si><si><t>Leste</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>not the street fairs</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>DISTRITO</t></is></c>` +
+			`<c r="D1" t="inlineStr"><is><t>REGIAO5</t></is></c><c r="E1" t="inlineStr"><is><t>LAT</t></is></c>` +
+			`<c r="F1" t="inlineStr"><is><t>LONG</t></is></c><c r="G1" t="inlineStr"><is><t>LOGRADOURO</t></is></c></row>` +
+			`<row r="2"><c r="A2" t="inlineStr"><is><t>4041-0</t></is></c><c r="B2" t="s"><v>2</v></c><c r="C2" t="s"><v>2</v></c>` +
+			`<c r="D2" t="s"><v>3</v></c><c r="E2"><v>-23.558733</v></c><c r="F2"><v>-46.550164</v></c><c r="G2" t="inlineStr"><is><t>RUA MARAGOJIPE</t></is></c></row>` +
+			`<row r="3"/>` +
+			`<row r="4"><c r="A4" t="inlineStr"><is><t>4045-2</t></is></c><c r="E4" t="inlineStr"><is><t>x</t></is></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	f, err := os.Create(path)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer loggerFinalizer()
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
 
-	imp := New(log, &fakeStreetFair{createdModels: []*fair.Model{}})
+func TestRunFormats(t *testing.T) {
+	xlsx := filepath.Join(t.TempDir(), "feiras.xlsx")
+	writeXLSX(t, xlsx)
+	var testCases = []struct {
+		path     string
+		conf     Config
+		created  []string
+		expected []RowError
+	}{
+		{"./testdata/sample.json", Config{}, []string{"4041-0", "4045-2"}, []RowError{{Line: 3, Reason: "not a JSON object"}}},
+		{"./testdata/sample.ndjson", Config{}, []string{"4041-0", "4045-2"}, []RowError{{Line: 4, Reason: "invalid JSON: unexpected EOF"}}},
+		{"./testdata/sample.geojson", Config{}, []string{"4041-0", "4003-7"}, []RowError{{Line: 2, Registry: "4045-2", Reason: "geometry LineString, want Point"}}},
+		{xlsx, Config{Sheet: "feiras"}, []string{"4041-0"}, []RowError{{Line: 4, Registry: "4045-2", Field: "latitude", Reason: `invalid number "x"`}}},
+		{xlsx, Config{Sheet: "2", Format: FormatXLSX}, []string{"4041-0"}, []RowError{{Line: 4, Registry: "4045-2", Field: "latitude", Reason: `invalid number "x"`}}},
+	}
 	for _, tt := range testCases {
-		if actual := imp.parseFloat(tt.num, "foo", "bar"); actual != tt.expected {
-			t.Errorf("want %f; got %f", tt.expected, actual)
+		dir := t.TempDir()
+		tt.conf.BatchSize, tt.conf.Mode = 10, ModeCreate
+		tt.conf.Report = filepath.Join(dir, "report.json")
+		fsf := &fakeStreetFair{}
+		if err := New(logrus.New(), fsf, &tt.conf).Run(tt.path); err != nil {
+			t.Fatalf("%s: want <nil>; got %+v", tt.path, err)
+		}
+
+		var created []string
+		for _, m := range fsf.createdModels {
+			if m.Latitude == 0 || m.Longitude == 0 || m.Region5 != "Leste" {
+				t.Errorf("%s: want the coordinates and the region; got %+v", tt.path, *m)
+			}
+			created = append(created, m.Registry)
+		}
+		if !reflect.DeepEqual(created, tt.created) {
+			t.Errorf("%s: want %v created; got %v", tt.path, tt.created, created)
+		}
+		if fsf.createdModels[0].Name != "VILA FORMOSA" {
+			t.Errorf("%s: want VILA FORMOSA; got %s", tt.path, fsf.createdModels[0].Name)
+		}
+		// the keys missing from the first record are read from the others
+		if tt.path == "./testdata/sample.ndjson" {
+			if m := fsf.createdModels[1]; m.Neighborhood != "VL ZELINA" || m.Address != "RUA JOSE DOS REIS" {
+				t.Errorf("%s: want the neighborhood and the address of 4045-2; got %+v", tt.path, *m)
+			}
+		}
+
+		data, err := ioutil.ReadFile(tt.conf.Report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(report.Errors, tt.expected) {
+			t.Errorf("%s: want %+v; got %+v", tt.path, tt.expected, report.Errors)
+		}
+	}
+
+	var errorCases = []struct {
+		path     string
+		conf     Config
+		expected error
+	}{
+		{xlsx, Config{Sheet: "Other"}, ErrSheetNotFound},
+		{"./testdata/sample.csv", Config{Format: FormatXLSX}, ErrInvalidFile},
+		{"./testdata/sample.csv", Config{Format: FormatJSON}, ErrInvalidFile},
+		{"./testdata/sample.json", Config{Format: FormatGeoJSON}, ErrInvalidFile},
+	}
+	for _, tt := range errorCases {
+		tt.conf.BatchSize, tt.conf.Mode = 10, ModeCreate
+		if err := New(logrus.New(), &fakeStreetFair{}, &tt.conf).Run(tt.path); !errors.Is(err, tt.expected) {
+			t.Errorf("%s %+v: want %+v; got %+v", tt.path, tt.conf, tt.expected, err)
 		}
 	}
 }
 
-func TestRun(t *testing.T) {
+func TestProgressETA(t *testing.T) {
+	start := time.Now()
+	read := &countingReader{}
+	p := newProgress(1000, read, start)
+
+	if actual := p.eta(start.Add(time.Second)); actual != 0 {
+		t.Errorf("want 0 before reading; got %s", actual)
+	}
+	read.n = 250
+	if actual := p.eta(start.Add(time.Second)); actual != 3*time.Second {
+		t.Errorf("want 3s; got %s", actual)
+	}
+}
+
+func TestModel(t *testing.T) {
+	b, err := DefaultMapping().bind([]string{"REGISTRO", "LAT", "LONG", "NOME_FEIRA", "DISTRITO", "REGIAO5", "LOGRADOURO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var testCases = []struct {
+		line     []string
+		expected []RowError
+	}{
+		{[]string{"4041-0", "-23558733", "-46550164"}, nil},
+		{[]string{"4041-0", "", "-46550164"}, nil},
+		{[]string{"4041-0", "a", "-46550164"}, []RowError{{Registry: "4041-0", Field: "latitude", Reason: `invalid number "a"`}}},
+		{[]string{"", "-23558733", "b"}, []RowError{{Field: "registry", Reason: "empty"}, {Field: "longitude", Reason: `invalid number "b"`}}},
+	}
+
+	imp := New(logrus.New(), nil, &Config{})
+	for _, tt := range testCases {
+		if _, actual := imp.model(b, tt.line); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%v: want %+v; got %+v", tt.line, tt.expected, actual)
+		}
+	}
+}
+
+// newTestLog returns the logger of logs.New writing to the temporary dir of
+// t, so the tests don't leave the log behind
+func newTestLog(t *testing.T) (*logrus.Logger, func() error) {
+	os.Setenv("FAIR_LOG_FILE_PATH", filepath.Join(t.TempDir(), "fair.log"))
+	defer os.Unsetenv("FAIR_LOG_FILE_PATH")
 	log, loggerFinalizer, err := logs.New()
 	if err != nil {
 		t.Fatal(err)
 	}
+	return log, loggerFinalizer
+}
+
+func TestRun(t *testing.T) {
+	log, loggerFinalizer := newTestLog(t)
 	defer loggerFinalizer()
 
 	fsf := &fakeStreetFair{createdModels: []*fair.Model{}}
-	imp := New(log, fsf)
+	imp := New(log, fsf, &Config{BatchSize: 2, Progress: time.Nanosecond, Mode: ModeCreate})
 	if err := imp.Run("./testdata/sample.csv"); err != nil {
 		t.Fatalf("want <nil>; got %+v", err)
 	}
@@ -77,3 +315,461 @@ func TestRun(t *testing.T) {
 		t.Errorf("want %s; got %s", expected, actual)
 	}
 }
+
+func TestRunMapping(t *testing.T) {
+	log, loggerFinalizer := newTestLog(t)
+	defer loggerFinalizer()
+
+	var testCases = []struct {
+		file     string
+		mapping  string
+		expected error
+	}{
+		{"./testdata/reordered.csv", "", nil},
+		{"./testdata/reordered.csv", "./testdata/mapping.yaml", nil},
+		{"./testdata/reordered.csv", "./testdata/mapping.json", nil},
+		{"./testdata/sample.csv", "./testdata/mapping.json", ErrMissingColumns},
+		{"./testdata/sample.csv", "./testdata/invalid_mapping.json", ErrInvalidMapping},
+	}
+	for _, tt := range testCases {
+		fsf := &fakeStreetFair{createdModels: []*fair.Model{}}
+		imp := New(log, fsf, &Config{BatchSize: 10, Mapping: tt.mapping, Mode: ModeCreate})
+		if err := imp.Run(tt.file); !errors.Is(err, tt.expected) {
+			t.Errorf("want %+v; got %+v", tt.expected, err)
+			continue
+		}
+		if tt.expected != nil {
+			if actual := len(fsf.createdModels); actual != 0 {
+				t.Errorf("want no street fair imported; got %d", actual)
+			}
+			continue
+		}
+
+		if actual := len(fsf.createdModels); actual != 2 {
+			t.Fatalf("want 2; got %d", actual)
+		}
+		m := fsf.createdModels[0]
+		if m.Registry != "4041-0" || m.District != "VILA FORMOSA" || m.Latitude == 0 {
+			t.Errorf("want 4041-0 of VILA FORMOSA with its latitude; got %s of %s at %f", m.Registry, m.District, m.Latitude)
+		}
+	}
+}
+
+func TestBinding(t *testing.T) {
+	mapping := &Mapping{Columns: []Column{
+		{Field: "registry", Headers: []string{"registro"}, Required: true, Transforms: []string{"trim", "upper"}},
+		{Field: "name", Headers: []string{"nome"}, Transforms: []string{"collapse"}},
+		{Field: "region_5", Headers: []string{"regiao"}, Default: "Leste"},
+		{Field: "latitude", Headers: []string{"lat"}, Transforms: []string{"decimal_comma"}},
+	}}
+	if _, err := mapping.bind([]string{"nome"}); !errors.Is(err, ErrMissingColumns) {
+		t.Fatalf("want %+v; got %+v", ErrMissingColumns, err)
+	}
+	b, err := mapping.bind([]string{"\ufeffNome", " REGISTRO ", "lat"})
+	if err != nil {
+		t.Fatalf("want <nil>; got %+v", err)
+	}
+
+	imp := New(logrus.New(), nil, &Config{})
+	m, _ := imp.model(b, []string{"VILA   FORMOSA ", " 4041-0x", "-23,55"})
+	expected := fair.Model{Registry: "4041-0X", Name: "VILA FORMOSA", Region5: "Leste", Latitude: -23.55}
+	if m.Registry != expected.Registry || m.Name != expected.Name || m.Region5 != expected.Region5 || float32(m.Latitude) != float32(expected.Latitude) {
+		t.Errorf("want %+v; got %+v", expected, *m)
+	}
+}
+
+// fakeBatcher is a fair.Batcher failing the registries of fail, the
+// upserts change the stored street fairs
+type fakeBatcher struct {
+	fakeStreetFair
+	fail      map[string]bool
+	stored    map[string]string
+	batches   []int
+	atomic    bool
+	committed bool
+}
+
+func (f *fakeBatcher) Batch(atomic bool) (fair.Batch, error) {
+	f.atomic = atomic
+	return &fakeBatch{f}, nil
+}
+
+type fakeBatch struct {
+	f *fakeBatcher
+}
+
+func (b *fakeBatch) Create(models []*fair.Model) []error {
+	f := b.f
+	f.batches = append(f.batches, len(models))
+	var errs []error
+	for i, m := range models {
+		if f.fail[m.Registry] {
+			if errs == nil {
+				errs = make([]error, len(models))
+			}
+			errs[i] = fair.ErrInvalidStreetFair
+			continue
+		}
+		f.createdModels = append(f.createdModels, m)
+	}
+	return errs
+}
+
+func (b *fakeBatch) Upsert(models []*fair.Model) []fair.UpsertResult {
+	f := b.f
+	f.batches = append(f.batches, len(models))
+	results := make([]fair.UpsertResult, len(models))
+	for i, m := range models {
+		name, ok := f.stored[m.Registry]
+		switch {
+		case f.fail[m.Registry]:
+			results[i].Err = fair.ErrInvalidStreetFair
+		case !ok:
+			results[i].Change = fair.Created
+		case name != m.Name:
+			results[i].Change = fair.Updated
+		}
+		if results[i].Err == nil {
+			f.stored[m.Registry] = m.Name
+		}
+	}
+	return results
+}
+
+func (b *fakeBatch) DeleteMissing(keep map[string]bool) (int, error) {
+	var deleted int
+	for registry := range b.f.stored {
+		if !keep[registry] {
+			delete(b.f.stored, registry)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (b *fakeBatch) Commit() error {
+	f := b.f
+	if f.atomic && len(f.createdModels) < 3 {
+		return fair.ErrAborted
+	}
+	f.committed = true
+	return nil
+}
+
+func (b *fakeBatch) Rollback() error {
+	return nil
+}
+
+func TestRunBatches(t *testing.T) {
+	var testCases = []struct {
+		atomic   bool
+		fail     map[string]bool
+		expected error
+	}{
+		{false, nil, nil},
+		{false, map[string]bool{"4045-2": true}, nil},
+		{true, nil, nil},
+		{true, map[string]bool{"4045-2": true}, fair.ErrAborted},
+	}
+	for _, tt := range testCases {
+		fb := &fakeBatcher{fail: tt.fail}
+		imp := New(logrus.New(), fb, &Config{BatchSize: 2, Atomic: tt.atomic, Mode: ModeCreate})
+		if err := imp.Run("./testdata/sample.csv"); !errors.Is(err, tt.expected) {
+			t.Errorf("want %+v; got %+v", tt.expected, err)
+		}
+		if expected := []int{2, 1}; !reflect.DeepEqual(fb.batches, expected) {
+			t.Errorf("want batches %v; got %v", expected, fb.batches)
+		}
+		if fb.atomic != tt.atomic || fb.committed != (tt.expected == nil) {
+			t.Errorf("want atomic %t committed %t; got %t %t", tt.atomic, tt.expected == nil, fb.atomic, fb.committed)
+		}
+	}
+
+	imp := New(logrus.New(), &fakeStreetFair{}, &Config{BatchSize: 2, Atomic: true, Mode: ModeCreate})
+	if err := imp.Run("./testdata/sample.csv"); err != ErrAtomicUnsupported {
+		t.Errorf("want %+v; got %+v", ErrAtomicUnsupported, err)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rejects.csv")
+	content := "REGISTRO,NOME_FEIRA,DISTRITO,REGIAO5,LAT,LONG,LOGRADOURO\n" +
+		"4041-0,VILA FORMOSA,VILA FORMOSA,Leste,-23558733,-46550164,RUA MARAGOJIPE\n" +
+		"4045-2,\"PRACA\nSANTA HELENA\",VILA PRUDENTE,Leste,x,-46574716,RUA JOSE DOS REIS\n" +
+		"4003-7,CONCORDIA,BRAS,Leste,-23536131,-46610332,RUA SAMPSON C MENDES JUNIOR\n" +
+		"4050-1,SHORT\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{
+		BatchSize: 2,
+		Mode:      ModeCreate,
+		Report:    filepath.Join(dir, "report.json"),
+		Rejects:   filepath.Join(dir, "rejected.csv"),
+	}
+	fb := &fakeBatcher{fail: map[string]bool{"4003-7": true}}
+	if err := New(logrus.New(), fb, conf).Run(path); err != nil {
+		t.Fatalf("want <nil>; got %+v", err)
+	}
+
+	data, err := ioutil.ReadFile(conf.Report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Summary{Rows: 4, Created: 1, Failed: 3}); report.Summary != expected {
+		t.Errorf("want %+v; got %+v", expected, report.Summary)
+	}
+	expected := []RowError{
+		{Line: 3, Registry: "4045-2", Field: "latitude", Reason: `invalid number "x"`},
+		{Line: 5, Registry: "4003-7", Reason: fair.ErrInvalidStreetFair.Error()},
+		{Line: 6, Registry: "4050-1", Reason: "2 fields, want 7"},
+	}
+	if !reflect.DeepEqual(report.Errors, expected) {
+		t.Errorf("want %+v; got %+v", expected, report.Errors)
+	}
+	if report.File != path || report.Error != "" || report.FinishedAt.Before(report.StartedAt) {
+		t.Errorf("want the report of %s; got %+v", path, report)
+	}
+
+	f, err := os.Open(conf.Rejects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0][7] != "error" || rows[1][1] != "PRACA\nSANTA HELENA" || rows[1][7] != `latitude: invalid number "x"` || rows[2][0] != "4003-7" || rows[3][7] != "2 fields, want 7" {
+		t.Errorf("want the header and the rejected rows with their errors; got %q", rows)
+	}
+
+	// the report is written on failures too
+	conf.Rejects, conf.Mapping = "", "./testdata/invalid_mapping.json"
+	if err := New(logrus.New(), fb, conf).Run(path); !errors.Is(err, ErrInvalidMapping) {
+		t.Fatalf("want %+v; got %+v", ErrInvalidMapping, err)
+	}
+	if data, err = ioutil.ReadFile(conf.Report); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil || !strings.Contains(report.Error, ErrInvalidMapping.Error()) {
+		t.Errorf("want the report with %+v; got %+v %+v", ErrInvalidMapping, report, err)
+	}
+}
+
+func TestRunInvalidUTF8(t *testing.T) {
+	// the start of the file is ASCII, longer than the sniffed by decode
+	var b strings.Builder
+	b.WriteString("REGISTRO,NOME_FEIRA,DISTRITO,REGIAO5,LAT,LONG,LOGRADOURO\n")
+	for b.Len() <= sniffSize {
+		b.WriteString("4041-0,VILA FORMOSA,VILA FORMOSA,Leste,-23558733,-46550164,RUA MARAGOJIPE\n")
+	}
+	rows := strings.Count(b.String(), "\n")
+	b.WriteString("4050-1,CONCEI\xc7\xc3O,BRAS,Leste,-23536131,-46610332,RUA DA CONCEI\xc7\xc3O\n")
+	path := filepath.Join(t.TempDir(), "latin1.csv")
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{BatchSize: 500, Mode: ModeCreate, Report: filepath.Join(t.TempDir(), "report.json")}
+	fsf := &fakeStreetFair{}
+	if err := New(logrus.New(), fsf, conf).Run(path); err != nil {
+		t.Fatalf("want <nil>; got %+v", err)
+	}
+	if len(fsf.createdModels) != rows-1 {
+		t.Errorf("want %d created; got %d", rows-1, len(fsf.createdModels))
+	}
+	data, err := ioutil.ReadFile(conf.Report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Line != rows+1 || !strings.Contains(report.Errors[0].Reason, "-encoding") {
+		t.Errorf("want line %d rejected as invalid UTF-8; got %+v", rows+1, report.Errors)
+	}
+}
+
+func TestRunModes(t *testing.T) {
+	var testCases = []struct {
+		mode     string
+		expected Summary
+	}{
+		{ModeCreate, Summary{Rows: 3, Created: 1, Failed: 2}},
+		{ModeUpsert, Summary{Rows: 3, Created: 1, Updated: 1, Unchanged: 1}},
+		{ModeSync, Summary{Rows: 3, Created: 1, Updated: 1, Unchanged: 1, Deleted: 1}},
+	}
+	for _, tt := range testCases {
+		fb := &fakeBatcher{
+			// the existing ones fail on create, 4046-0 is missing from the file
+			fail:   map[string]bool{"4041-0": tt.mode == ModeCreate, "4045-2": tt.mode == ModeCreate},
+			stored: map[string]string{"4041-0": "VILA FORMOSA", "4045-2": "OLD NAME", "4046-0": "GONE"},
+		}
+		log, hook := test.NewNullLogger()
+		imp := New(log, fb, &Config{BatchSize: 10, Mode: tt.mode})
+		if err := imp.Run("./testdata/sample.csv"); err != nil {
+			t.Fatalf("want <nil>; got %+v", err)
+		}
+
+		entry := hook.LastEntry()
+		if entry == nil || entry.Message != "Imported" {
+			t.Fatalf("want the summary logged; got %+v", entry)
+		}
+		for k, expected := range tt.expected.fields() {
+			if actual := entry.Data[k]; actual != expected {
+				t.Errorf("%s: want %s %v; got %v", tt.mode, k, expected, actual)
+			}
+		}
+		if _, kept := fb.stored["4046-0"]; kept == (tt.mode == ModeSync) {
+			t.Errorf("%s: want 4046-0 kept %t; got %t", tt.mode, tt.mode != ModeSync, kept)
+		}
+	}
+
+	imp := New(logrus.New(), &fakeStreetFair{}, &Config{BatchSize: 2, Mode: ModeSync})
+	if err := imp.Run("./testdata/sample.csv"); err != ErrModeUnsupported {
+		t.Errorf("want %+v; got %+v", ErrModeUnsupported, err)
+	}
+}
+
+func TestRunSyncRejected(t *testing.T) {
+	header := "REGISTRO,NOME_FEIRA,DISTRITO,REGIAO5,LAT,LONG,LOGRADOURO\n"
+	var testCases = []struct {
+		content  string
+		kept     []string
+		expected error
+	}{
+		// the rejected 4045-2 isn't missing from the file
+		{header +
+			"4041-0,VILA FORMOSA,VILA FORMOSA,Leste,-23558733,-46550164,RUA MARAGOJIPE\n" +
+			"4045-2,PRACA SANTA HELENA,VILA PRUDENTE,Leste,-23584852,-46574716,RUA JOSE DOS REIS,EXTRA\n",
+			[]string{"4041-0", "4045-2"}, nil},
+		// a rejected record without registry could be any of them
+		{header +
+			"4041-0,VILA FORMOSA,VILA FORMOSA,Leste,-23558733,-46550164,RUA MARAGOJIPE\n" +
+			",PRACA SANTA HELENA\n",
+			[]string{"4041-0", "4045-2", "4046-0"}, ErrSyncIncomplete},
+	}
+	for _, tt := range testCases {
+		path := filepath.Join(t.TempDir(), "sync.csv")
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fb := &fakeBatcher{stored: map[string]string{"4041-0": "VILA FORMOSA", "4045-2": "PRACA SANTA HELENA", "4046-0": "GONE"}}
+		imp := New(logrus.New(), fb, &Config{BatchSize: 10, Mode: ModeSync})
+		if err := imp.Run(path); !errors.Is(err, tt.expected) {
+			t.Errorf("want %+v; got %+v", tt.expected, err)
+		}
+		var kept []string
+		for registry := range fb.stored {
+			kept = append(kept, registry)
+		}
+		sort.Strings(kept)
+		if !reflect.DeepEqual(kept, tt.kept) {
+			t.Errorf("want %v kept; got %v", tt.kept, kept)
+		}
+	}
+}
+
+// fakeDiffer is a fair.Differ of the stored names
+type fakeDiffer struct {
+	fakeStreetFair
+	stored map[string]string
+}
+
+func (f *fakeDiffer) Diff(models []*fair.Model) ([]fair.ModelDiff, error) {
+	diffs := make([]fair.ModelDiff, len(models))
+	for i, m := range models {
+		diffs[i].Registry = m.Registry
+		if name, ok := f.stored[m.Registry]; !ok {
+			diffs[i].Change = fair.Created
+		} else if name != m.Name {
+			diffs[i].Change = fair.Updated
+			diffs[i].Fields = []fair.FieldChange{{Field: "name", Old: name, New: m.Name}}
+		}
+	}
+	return diffs, nil
+}
+
+func (f *fakeDiffer) Missing(keep map[string]bool) ([]string, error) {
+	var missing []string
+	for registry := range f.stored {
+		if !keep[registry] {
+			missing = append(missing, registry)
+		}
+	}
+	return missing, nil
+}
+
+func TestDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.csv")
+	content := "REGISTRO,NOME_FEIRA,DISTRITO,REGIAO5,LAT,LONG,LOGRADOURO\n" +
+		"4041-0,VILA FORMOSA,VILA FORMOSA,Leste,-23558733,-46550164,RUA MARAGOJIPE\n" +
+		"4045-2,PRACA SANTA HELENA,VILA PRUDENTE,Leste,-23584852,-46574716,RUA JOSE DOS REIS\n" +
+		",NO REGISTRY,VILA PRUDENTE,Leste,-23584852,-46574716,RUA JOSE DOS REIS\n" +
+		"4003-7,CONCORDIA,BRAS,Leste,-23536131,-46610332,RUA SAMPSON C MENDES JUNIOR\n" +
+		"4050-1,BAD LATITUDE,BRAS,Leste,x,-46610332,RUA SAMPSON C MENDES JUNIOR\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fd := &fakeDiffer{stored: map[string]string{"4041-0": "VILA FORMOSA", "4045-2": "OLD NAME", "4046-0": "GONE"}}
+	imp := New(logrus.New(), fd, &Config{BatchSize: 2, Mode: ModeCreate, DryRun: true})
+	d, err := imp.DryRun(path)
+	if err != nil {
+		t.Fatalf("want <nil>; got %+v", err)
+	}
+	if len(fd.createdModels) != 0 {
+		t.Errorf("want nothing created; got %d", len(fd.createdModels))
+	}
+
+	if d.Rows != 5 || len(d.New) != 1 || d.New[0].Registry != "4003-7" || d.Unchanged != 1 {
+		t.Errorf("want 5 rows with 4003-7 new and 1 unchanged; got %+v", d)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Registry != "4045-2" {
+		t.Errorf("want 4045-2 changed; got %+v", d.Changed)
+	}
+	if expected := []string{"4046-0"}; !reflect.DeepEqual(d.Missing, expected) {
+		t.Errorf("want %v missing; got %v", expected, d.Missing)
+	}
+	if len(d.Invalid) != 2 || d.Invalid[0].Line != 4 || d.Invalid[1].Line != 6 {
+		t.Errorf("want the lines 4 and 6 invalid; got %+v", d.Invalid)
+	}
+
+	var testCases = []struct {
+		diff     Diff
+		expected bool
+	}{
+		{Diff{Mode: ModeCreate, Changed: d.Changed, Missing: d.Missing}, false},
+		{Diff{Mode: ModeCreate, New: d.New}, true},
+		{Diff{Mode: ModeUpsert, Changed: d.Changed, Missing: d.Missing}, true},
+		{Diff{Mode: ModeUpsert, Missing: d.Missing}, false},
+		{Diff{Mode: ModeSync, Missing: d.Missing}, true},
+	}
+	for _, tt := range testCases {
+		if actual := tt.diff.HasChanges(); actual != tt.expected {
+			t.Errorf("want %t; got %t", tt.expected, actual)
+		}
+	}
+
+	var text bytes.Buffer
+	if err := d.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"+ 4003-7 CONCORDIA", "    name: \"OLD NAME\" -> \"PRACA SANTA HELENA\"", "- 4046-0", "! line 6 4050-1: latitude: invalid number \"x\""} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("want %q on the diff; got %s", expected, text.String())
+		}
+	}
+
+	if _, err := New(logrus.New(), &fakeStreetFair{}, &Config{BatchSize: 2}).DryRun(path); err != ErrDryRunUnsupported {
+		t.Errorf("want %+v; got %+v", ErrDryRunUnsupported, err)
+	}
+}
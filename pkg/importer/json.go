@@ -0,0 +1,311 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// jsonRecord is a record of a JSON file, raw as read
+type jsonRecord struct {
+	obj map[string]interface{}
+	// point are the coordinates of a GeoJSON feature
+	point []json.Number
+	raw   []byte
+	line  int
+}
+
+// objectReader reads the JSON objects of a file as rows, the header are
+// the columns of the mapping and the keys are matched to their headers.
+// The nested values are kept as JSON
+type objectReader struct {
+	counter  *countingReader
+	size     int64
+	closer   io.Closer
+	format   string
+	encoding string
+	names    []string
+	index    map[string]int
+	// longitude and latitude are the columns of the coordinates of the
+	// GeoJSON features, -1 when not mapped
+	longitude int
+	latitude  int
+	row       []string
+	last      int
+	// object returns the next record, with a *recordError when invalid
+	object func() (*jsonRecord, error)
+}
+
+func (r *objectReader) header() []string {
+	return r.names
+}
+
+func (r *objectReader) next() ([]string, error) {
+	rec, err := r.object()
+	var invalid *recordError
+	if err != nil && !errors.As(err, &invalid) {
+		return nil, err
+	}
+
+	r.last = rec.line
+	for i := range r.row {
+		r.row[i] = ""
+	}
+	for k, v := range rec.obj {
+		if i, ok := r.index[normalizeHeader(k)]; ok {
+			r.row[i] = jsonText(v)
+		}
+	}
+	if len(rec.point) >= 2 {
+		if r.longitude >= 0 {
+			r.row[r.longitude] = rec.point[0].String()
+		}
+		if r.latitude >= 0 {
+			r.row[r.latitude] = rec.point[1].String()
+		}
+	}
+	if invalid != nil {
+		invalid.raw = rec.raw
+		return r.row, err
+	}
+	return r.row, nil
+}
+
+func (r *objectReader) line() int {
+	return r.last
+}
+
+func (r *objectReader) progress() (*countingReader, int64) {
+	return r.counter, r.size
+}
+
+func (r *objectReader) fields() logrus.Fields {
+	return logrus.Fields{"format": r.format, "encoding": r.encoding}
+}
+
+func (r *objectReader) close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// jsonText returns a JSON value as a field
+func jsonText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// parseObject parses a JSON object, keeping the numbers as read
+func parseObject(raw []byte) (map[string]interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var obj map[string]interface{}
+	err := d.Decode(&obj)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) || (err == nil && obj == nil) {
+		return nil, &recordError{err: err, reason: "not a JSON object"}
+	} else if err != nil {
+		return nil, &recordError{err: err, reason: "invalid JSON: " + err.Error()}
+	}
+	return obj, nil
+}
+
+// expectDelim reads the delimiter d, failing with ErrInvalidFile on other
+// token
+func expectDelim(dec *json.Decoder, d json.Delim, want string) error {
+	t, err := dec.Token()
+	if err == io.EOF {
+		return ErrInvalidFile
+	} else if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidFile, err)
+	}
+	if t != d {
+		return fmt.Errorf("%w: want %s", ErrInvalidFile, want)
+	}
+	return nil
+}
+
+// arrayObjects reads the objects of a JSON array, like a list of the
+// street fairs of the API
+func arrayObjects(r io.Reader) (func() (*jsonRecord, error), error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '[', "an array"); err != nil {
+		return nil, err
+	}
+	n := 0
+	return func() (*jsonRecord, error) {
+		if !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		n++
+		obj, err := parseObject(raw)
+		return &jsonRecord{obj: obj, raw: raw, line: n}, err
+	}, nil
+}
+
+// lineObjects reads the objects of a NDJSON file, one by line. The blank
+// lines are skipped
+func lineObjects(r io.Reader) func() (*jsonRecord, error) {
+	br := bufio.NewReader(r)
+	n := 0
+	return func() (*jsonRecord, error) {
+		for {
+			b, err := br.ReadBytes('\n')
+			if len(b) == 0 {
+				return nil, err
+			} else if err != nil && err != io.EOF {
+				return nil, err
+			}
+			n++
+			if b = bytes.TrimSpace(b); len(b) > 0 {
+				obj, err := parseObject(b)
+				return &jsonRecord{obj: obj, raw: b, line: n}, err
+			}
+		}
+	}
+}
+
+// feature is a GeoJSON feature, its coordinates are parsed by its type
+type feature struct {
+	Geometry *struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// featureRecord returns the properties of a feature with the coordinates
+// of its point. The invalid geometries are returned with their
+// properties, to know their registry
+func featureRecord(raw []byte) (*jsonRecord, error) {
+	rec := &jsonRecord{raw: raw}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var f feature
+	if err := d.Decode(&f); err != nil {
+		return rec, &recordError{err: err, reason: "invalid feature: " + err.Error()}
+	}
+	rec.obj = f.Properties
+	if f.Geometry == nil {
+		return rec, &recordError{reason: "geometry is null, want Point"}
+	} else if f.Geometry.Type != "Point" {
+		return rec, &recordError{reason: fmt.Sprintf("geometry %s, want Point", f.Geometry.Type)}
+	}
+	if err := json.Unmarshal(f.Geometry.Coordinates, &rec.point); err != nil || len(rec.point) < 2 {
+		return rec, &recordError{err: err, reason: "invalid coordinates"}
+	}
+	return rec, nil
+}
+
+// featureObjects reads the features of a GeoJSON FeatureCollection, the
+// other members of the collection are skipped
+func featureObjects(r io.Reader) (func() (*jsonRecord, error), error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{', "a FeatureCollection"); err != nil {
+		return nil, err
+	}
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if t == json.Delim('}') {
+			return nil, fmt.Errorf("%w: want the features of a FeatureCollection", ErrInvalidFile)
+		} else if t == "features" {
+			break
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '[', "an array of features"); err != nil {
+		return nil, err
+	}
+
+	n := 0
+	return func() (*jsonRecord, error) {
+		if !dec.More() {
+			return nil, io.EOF
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		n++
+		rec, err := featureRecord(raw)
+		rec.line = n
+		return rec, err
+	}, nil
+}
+
+// newObjectReader reads a JSON, NDJSON or GeoJSON file of r, its header
+// are the first headers of the columns of mapping
+func newObjectReader(r io.Reader, format, encoding string, mapping *Mapping) (*objectReader, error) {
+	counter := &countingReader{r: r}
+	decoded, encoding, err := decode(counter, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &objectReader{
+		counter:   counter,
+		format:    format,
+		encoding:  encoding,
+		index:     make(map[string]int),
+		longitude: -1,
+		latitude:  -1,
+	}
+	switch format {
+	case FormatJSON:
+		reader.object, err = arrayObjects(decoded)
+	case FormatGeoJSON:
+		reader.object, err = featureObjects(decoded)
+	default:
+		reader.object = lineObjects(decoded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range mapping.Columns {
+		reader.names = append(reader.names, c.Headers[0])
+		for _, h := range c.Headers {
+			if _, ok := reader.index[normalizeHeader(h)]; !ok {
+				reader.index[normalizeHeader(h)] = i
+			}
+		}
+		switch c.Field {
+		case "longitude":
+			reader.longitude = i
+		case "latitude":
+			reader.latitude = i
+		}
+	}
+	reader.row = make([]string, len(reader.names))
+	return reader, nil
+}
@@ -0,0 +1,205 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidMapping = errors.New("Invalid column mapping")
+	ErrMissingColumns = errors.New("Missing required columns")
+)
+
+// Column maps the CSV columns named by Headers (the first one is its name,
+// the others are aliases) to a field of the street fair, by its JSON name
+type Column struct {
+	Field    string   `json:"field" yaml:"field"`
+	Headers  []string `json:"headers" yaml:"headers"`
+	Required bool     `json:"required" yaml:"required"`
+	// Default is the value of the missing column or the empty cells
+	Default    string   `json:"default" yaml:"default"`
+	Transforms []string `json:"transforms" yaml:"transforms"`
+}
+
+// Mapping is how the columns of a CSV file fill the street fairs
+type Mapping struct {
+	Columns []Column `json:"columns" yaml:"columns"`
+}
+
+// field sets a field of the street fair, the floats are parsed by the
+// Importer to log the invalid ones
+type field struct {
+	text  func(m *fair.Model, v string)
+	float func(m *fair.Model, v float64)
+}
+
+var fields = map[string]field{
+	"longitude":         {float: func(m *fair.Model, v float64) { m.Longitude = v }},
+	"latitude":          {float: func(m *fair.Model, v float64) { m.Latitude = v }},
+	"setcens":           {text: func(m *fair.Model, v string) { m.Setcens = v }},
+	"areap":             {text: func(m *fair.Model, v string) { m.Areap = v }},
+	"cod_district":      {text: func(m *fair.Model, v string) { m.CodDistrict = v }},
+	"district":          {text: func(m *fair.Model, v string) { m.District = v }},
+	"cod_sub_city_hall": {text: func(m *fair.Model, v string) { m.CodSubCityHall = v }},
+	"sub_city_hall":     {text: func(m *fair.Model, v string) { m.SubCityHall = v }},
+	"region_5":          {text: func(m *fair.Model, v string) { m.Region5 = v }},
+	"region_8":          {text: func(m *fair.Model, v string) { m.Region8 = v }},
+	"name":              {text: func(m *fair.Model, v string) { m.Name = v }},
+	"registry":          {text: func(m *fair.Model, v string) { m.Registry = v }},
+	"address":           {text: func(m *fair.Model, v string) { m.Address = v }},
+	"address_number":    {text: func(m *fair.Model, v string) { m.AddressNumber = v }},
+	"neighborhood":      {text: func(m *fair.Model, v string) { m.Neighborhood = v }},
+	"landmark":          {text: func(m *fair.Model, v string) { m.Landmark = v }},
+}
+
+var transforms = map[string]func(string) string{
+	"trim":     strings.TrimSpace,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"collapse": func(v string) string { return strings.Join(strings.Fields(v), " ") },
+	// decimal_comma reads the pt-BR numbers, like `-23,558733`
+	"decimal_comma": func(v string) string { return strings.Replace(v, ",", ".", 1) },
+}
+
+// DefaultMapping returns the mapping of the DEINFO_AB_FEIRASLIVRES_2014
+// file, accepting the street fair field names as aliases
+func DefaultMapping() *Mapping {
+	column := func(field string, required bool, headers ...string) Column {
+		return Column{Field: field, Headers: append(headers, field), Required: required}
+	}
+	return &Mapping{Columns: []Column{
+		column("longitude", true, "LONG"),
+		column("latitude", true, "LAT"),
+		column("setcens", false, "SETCENS"),
+		column("areap", false, "AREAP"),
+		column("cod_district", false, "CODDIST"),
+		column("district", true, "DISTRITO"),
+		column("cod_sub_city_hall", false, "CODSUBPREF"),
+		column("sub_city_hall", false, "SUBPREFE"),
+		column("region_5", true, "REGIAO5"),
+		column("region_8", false, "REGIAO8"),
+		column("name", true, "NOME_FEIRA"),
+		column("registry", true, "REGISTRO"),
+		column("address", true, "LOGRADOURO"),
+		column("address_number", false, "NUMERO"),
+		column("neighborhood", false, "BAIRRO"),
+		column("landmark", false, "REFERENCIA"),
+	}}
+}
+
+func (m *Mapping) validate() error {
+	seen := make(map[string]bool)
+	var hasRegistry bool
+	for _, c := range m.Columns {
+		if _, ok := fields[c.Field]; !ok {
+			return fmt.Errorf("%w: unknown field `%s`", ErrInvalidMapping, c.Field)
+		} else if seen[c.Field] {
+			return fmt.Errorf("%w: field `%s` mapped twice", ErrInvalidMapping, c.Field)
+		} else if len(c.Headers) == 0 {
+			return fmt.Errorf("%w: field `%s` without headers", ErrInvalidMapping, c.Field)
+		}
+		for _, t := range c.Transforms {
+			if _, ok := transforms[t]; !ok {
+				return fmt.Errorf("%w: unknown transform `%s` of field `%s`", ErrInvalidMapping, t, c.Field)
+			}
+		}
+		seen[c.Field] = true
+		hasRegistry = hasRegistry || c.Field == "registry"
+	}
+	if !hasRegistry {
+		return fmt.Errorf("%w: field `registry` is not mapped", ErrInvalidMapping)
+	}
+	return nil
+}
+
+// LoadMapping reads a mapping from a JSON (`.json`) or YAML file
+func LoadMapping(path string) (*Mapping, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(Mapping)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(content, m)
+	} else {
+		err = yaml.Unmarshal(content, m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMapping, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// normalizeHeader compares the headers by case, ignoring the spaces and
+// the byte order mark of the first one
+func normalizeHeader(h string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+}
+
+// boundColumn is a column of the mapping with its index on the file,
+// -1 when missing
+type boundColumn struct {
+	Column
+	index int
+}
+
+func (c *boundColumn) value(line []string) string {
+	v := c.Default
+	if c.index >= 0 && c.index < len(line) && line[c.index] != "" {
+		v = line[c.index]
+	}
+	for _, t := range c.Transforms {
+		v = transforms[t](v)
+	}
+	return v
+}
+
+// binding is a mapping bound to the header of a file
+type binding struct {
+	columns  []boundColumn
+	registry *boundColumn
+}
+
+// bind finds the columns of the mapping on header, failing with the
+// required columns missing
+func (m *Mapping) bind(header []string) (*binding, error) {
+	indexes := make(map[string]int, len(header))
+	for i, h := range header {
+		if _, ok := indexes[normalizeHeader(h)]; !ok {
+			indexes[normalizeHeader(h)] = i
+		}
+	}
+
+	b := &binding{columns: make([]boundColumn, len(m.Columns))}
+	var missing []string
+	for i, c := range m.Columns {
+		b.columns[i] = boundColumn{Column: c, index: -1}
+		for _, h := range c.Headers {
+			if index, ok := indexes[normalizeHeader(h)]; ok {
+				b.columns[i].index = index
+				break
+			}
+		}
+		if b.columns[i].index < 0 && c.Required {
+			missing = append(missing, c.Headers[0])
+		}
+		if c.Field == "registry" {
+			b.registry = &b.columns[i]
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingColumns, strings.Join(missing, ", "))
+	}
+	return b, nil
+}
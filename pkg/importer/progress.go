@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Summary counts the rows of an import by their outcome, Deleted are the
+// street fairs missing from the file of a sync
+type Summary struct {
+	Rows      int `json:"rows"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Deleted   int `json:"deleted"`
+	Failed    int `json:"failed"`
+}
+
+func (s *Summary) fields() logrus.Fields {
+	return logrus.Fields{
+		"rows":      s.Rows,
+		"created":   s.Created,
+		"updated":   s.Updated,
+		"unchanged": s.Unchanged,
+		"deleted":   s.Deleted,
+		"failed":    s.Failed,
+	}
+}
+
+// progress tracks the rows imported, estimating the time left by the
+// bytes read of the file
+type progress struct {
+	Summary
+	size     int64
+	read     *countingReader
+	start    time.Time
+	reported time.Time
+	// unidentified are the rejected records without registry
+	unidentified int
+}
+
+// eta returns the estimated time to read the rest of the file at the
+// current rate, zero when unknown
+func (p *progress) eta(now time.Time) time.Duration {
+	elapsed := now.Sub(p.start)
+	if p.read.n == 0 || p.size <= p.read.n || elapsed <= 0 {
+		return 0
+	}
+	rate := float64(p.read.n) / elapsed.Seconds()
+	return time.Duration(float64(p.size-p.read.n) / rate * float64(time.Second))
+}
+
+func (p *progress) report(log *logrus.Logger, now time.Time) {
+	p.reported = now
+	var rate float64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.Rows) / elapsed
+	}
+	log.WithFields(p.fields()).WithFields(logrus.Fields{
+		"rows_sec": int(rate),
+		"percent":  int(float64(p.read.n) / float64(p.size) * 100),
+		"eta":      p.eta(now).Round(time.Second).String(),
+	}).Info("Progress")
+}
+
+func newProgress(size int64, read *countingReader, now time.Time) *progress {
+	return &progress{size: size, read: read, start: now, reported: now}
+}
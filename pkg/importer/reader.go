@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// countingReader counts the bytes read, to estimate the progress
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// rowReader streams the rows of a CSV file after its header, transcoded
+// to UTF-8. Unless ragged, every row has the fields of the header
+type rowReader struct {
+	csv       *csv.Reader
+	counter   *countingReader
+	size      int64
+	closer    io.Closer
+	names     []string
+	encoding  string
+	delimiter rune
+	// last is the line of the last row, nextLine of the next one
+	last     int
+	nextLine int
+}
+
+// lines returns the number of lines of a row, its quoted fields may
+// have line breaks
+func lines(row []string) int {
+	n := 1
+	for _, field := range row {
+		n += strings.Count(field, "\n")
+	}
+	return n
+}
+
+func (r *rowReader) header() []string {
+	return r.names
+}
+
+// next returns the next row, or io.EOF at the end of the file. A row with
+// other number of fields than the header is returned with a *recordError
+// of csv.ErrFieldCount. The row is only valid until the next call
+func (r *rowReader) next() ([]string, error) {
+	row, err := r.csv.Read()
+	if row == nil {
+		return nil, err
+	}
+	r.last = r.nextLine
+	r.nextLine += lines(row)
+	if err != nil {
+		return row, &recordError{err: err, reason: fmt.Sprintf("%d fields, want %d", len(row), len(r.names))}
+	}
+	return row, nil
+}
+
+func (r *rowReader) line() int {
+	return r.last
+}
+
+func (r *rowReader) progress() (*countingReader, int64) {
+	return r.counter, r.size
+}
+
+func (r *rowReader) fields() logrus.Fields {
+	return logrus.Fields{"encoding": r.encoding, "delimiter": string(r.delimiter)}
+}
+
+func (r *rowReader) close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// newRowReader reads the header of r by the encoding, delimiter, quotes
+// and ragged rows of conf
+func newRowReader(r io.Reader, conf *Config) (*rowReader, error) {
+	delimiter, err := parseDelimiter(conf.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{r: r}
+	decoded, encoding, err := decode(counter, conf.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(decoded)
+	if delimiter == 0 {
+		delimiter = detectDelimiter(br)
+	}
+
+	reader := csv.NewReader(br)
+	reader.ReuseRecord = true
+	reader.Comma = delimiter
+	reader.LazyQuotes = conf.LazyQuotes
+	if conf.Ragged {
+		reader.FieldsPerRecord = -1
+	}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrInvalidFile
+	} else if err != nil {
+		return nil, err
+	}
+	// the record is reused by the next reads
+	header = append([]string(nil), header...)
+	return &rowReader{
+		csv:       reader,
+		counter:   counter,
+		names:     header,
+		encoding:  encoding,
+		delimiter: delimiter,
+		nextLine:  1 + lines(header),
+	}, nil
+}
@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// maxReportErrors bounds the errors of a Report, the rejected rows file
+// has all of them
+const maxReportErrors = 10000
+
+// RowError is why a row of the file was rejected, Line is its line on the
+// file (the header is the line 1), its number on the JSON arrays and its
+// row on the spreadsheets
+type RowError struct {
+	Line     int    `json:"line"`
+	Registry string `json:"registry,omitempty"`
+	// Field is the street fair field of the error, empty when the whole
+	// row failed
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e *RowError) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return e.Field + ": " + e.Reason
+}
+
+// Report is the outcome of an import
+type Report struct {
+	File       string    `json:"file"`
+	Mode       string    `json:"mode"`
+	Atomic     bool      `json:"atomic"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	Summary
+	Errors []RowError `json:"errors"`
+	// ErrorsTruncated tells whether some errors were left out of Errors
+	ErrorsTruncated bool `json:"errors_truncated"`
+	// Error is the failure of the import, if any
+	Error string `json:"error,omitempty"`
+}
+
+// rejects collects the rejected rows on the report and, when the rejected
+// rows file is open, writes them with their errors
+type rejects struct {
+	report *Report
+	f      *os.File
+	w      *csv.Writer
+	// width is the number of fields of the header
+	width int
+}
+
+// open creates the rejected rows file of path, with the columns of header
+// and the `error` column
+func (r *rejects) open(path string, header []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	r.f, r.w, r.width = f, csv.NewWriter(f), len(header)
+	return r.w.Write(append(append([]string(nil), header...), "error"))
+}
+
+// reject records the errors of a row, row is the row as read
+func (r *rejects) reject(row []string, errs []RowError) error {
+	for _, e := range errs {
+		if len(r.report.Errors) == maxReportErrors {
+			r.report.ErrorsTruncated = true
+			break
+		}
+		r.report.Errors = append(r.report.Errors, e)
+	}
+	if r.w == nil {
+		return nil
+	}
+	var reason string
+	for i := range errs {
+		if i > 0 {
+			reason += "; "
+		}
+		reason += errs[i].Error()
+	}
+	// the short rows are padded to keep the error on its column
+	fields := append([]string(nil), row...)
+	for len(fields) < r.width {
+		fields = append(fields, "")
+	}
+	return r.w.Write(append(fields, reason))
+}
+
+func (r *rejects) close() error {
+	if r.f == nil {
+		return nil
+	}
+	r.w.Flush()
+	if err := r.w.Error(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// writeReport writes the report as JSON to path
+func writeReport(path string, report *Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		f.Close()
+		return fmt.Errorf("writing the report: %w", err)
+	}
+	return f.Close()
+}
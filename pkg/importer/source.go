@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidFormat = errors.New("Invalid format")
+
+// The formats of the import files
+const (
+	FormatAuto    = "auto"
+	FormatCSV     = "csv"
+	FormatJSON    = "json"
+	FormatNDJSON  = "ndjson"
+	FormatGeoJSON = "geojson"
+	FormatXLSX    = "xlsx"
+)
+
+// extensions are the formats by the extension of the file, the others
+// are read as CSV
+var extensions = map[string]string{
+	".json":    FormatJSON,
+	".ndjson":  FormatNDJSON,
+	".jsonl":   FormatNDJSON,
+	".geojson": FormatGeoJSON,
+	".xlsx":    FormatXLSX,
+}
+
+// ValidFormat tells whether name is a known format or FormatAuto
+func ValidFormat(name string) bool {
+	switch name {
+	case "", FormatAuto, FormatCSV, FormatJSON, FormatNDJSON, FormatGeoJSON, FormatXLSX:
+		return true
+	}
+	return false
+}
+
+// formatOf returns the format of the file of path, by its extension on
+// FormatAuto
+func formatOf(path, format string) string {
+	if format != "" && format != FormatAuto {
+		return format
+	}
+	if f, ok := extensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return f
+	}
+	return FormatCSV
+}
+
+// source streams the records of an import file as rows of fields, named
+// by its header
+type source interface {
+	header() []string
+	// next returns the next row, or io.EOF at the end of the file. An
+	// invalid record is returned with a *recordError, the row has what
+	// could be read of it. The row is only valid until the next call
+	next() ([]string, error)
+	// line is where the last row is on the file: its line on the text
+	// files, its number on the JSON arrays and its row on the spreadsheets
+	line() int
+	// progress returns the counter of the bytes read and their total
+	progress() (*countingReader, int64)
+	// fields describe the source on the logs
+	fields() logrus.Fields
+	close() error
+}
+
+// recordError is an invalid record of the file, it's rejected without
+// stopping the import
+type recordError struct {
+	err    error
+	reason string
+	// raw is the record as read, when it can't be a row
+	raw []byte
+}
+
+func (e *recordError) Error() string {
+	return e.reason
+}
+
+func (e *recordError) Unwrap() error {
+	return e.err
+}
+
+// openSource opens the file of path by its format, see Config. The
+// headers of the formats without them are the ones of mapping
+func openSource(path string, conf *Config, mapping *Mapping) (source, error) {
+	format := formatOf(path, conf.Format)
+	if format == FormatXLSX {
+		return openSheet(path, conf.Sheet)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var src source
+	switch format {
+	case FormatCSV:
+		var r *rowReader
+		if r, err = newRowReader(f, conf); err == nil {
+			r.size, r.closer = info.Size(), f
+			src = r
+		}
+	case FormatJSON, FormatNDJSON, FormatGeoJSON:
+		var r *objectReader
+		if r, err = newObjectReader(f, format, conf.Encoding, mapping); err == nil {
+			r.size, r.closer = info.Size(), f
+			src = r
+		}
+	default:
+		err = fmt.Errorf("%w: %q", ErrInvalidFormat, format)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return src, nil
+}
@@ -0,0 +1,309 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrSheetNotFound = errors.New("Sheet not found")
+
+// xlsxText is a rich text of a spreadsheet, its runs are joined
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t *xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxCell struct {
+	Ref    string    `xml:"r,attr"`
+	Type   string    `xml:"t,attr"`
+	Value  string    `xml:"v"`
+	Inline *xlsxText `xml:"is"`
+}
+
+type xlsxRow struct {
+	Number int        `xml:"r,attr"`
+	Cells  []xlsxCell `xml:"c"`
+}
+
+// sheetReader streams the rows of a sheet of a XLSX file, its first row
+// is the header. The empty rows are skipped
+type sheetReader struct {
+	zip     *zip.ReadCloser
+	sheet   io.ReadCloser
+	xml     *xml.Decoder
+	counter *countingReader
+	size    int64
+	name    string
+	shared  []string
+	names   []string
+	row     []string
+	last    int
+}
+
+func (r *sheetReader) header() []string {
+	return r.names
+}
+
+// column returns the index of the column of a cell reference, like `B2`
+func column(ref string) int {
+	n := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A') + 1
+	}
+	return n - 1
+}
+
+func (r *sheetReader) value(c *xlsxCell) (string, error) {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(r.shared) {
+			return "", fmt.Errorf("%w: shared string %q of %s", ErrInvalidFile, c.Value, c.Ref)
+		}
+		return r.shared[i], nil
+	case "inlineStr":
+		if c.Inline == nil {
+			return "", nil
+		}
+		return c.Inline.String(), nil
+	}
+	return c.Value, nil
+}
+
+// read reads the next non-empty row to r.row, resized to width when
+// positive
+func (r *sheetReader) read(width int) error {
+	for {
+		t, err := r.xml.Token()
+		if err != nil {
+			return err
+		}
+		start, ok := t.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := r.xml.DecodeElement(&row, &start); err != nil {
+			return err
+		}
+		if row.Number == 0 {
+			row.Number = r.last + 1
+		}
+		r.last = row.Number
+
+		r.row = r.row[:0]
+		empty := true
+		for i := range row.Cells {
+			c := &row.Cells[i]
+			index := len(r.row)
+			if c.Ref != "" {
+				index = column(c.Ref)
+			}
+			if index < 0 || (width > 0 && index >= width) {
+				continue
+			}
+			v, err := r.value(c)
+			if err != nil {
+				return err
+			}
+			for len(r.row) <= index {
+				r.row = append(r.row, "")
+			}
+			r.row[index] = v
+			empty = empty && v == ""
+		}
+		if empty {
+			continue
+		}
+		for len(r.row) < width {
+			r.row = append(r.row, "")
+		}
+		return nil
+	}
+}
+
+func (r *sheetReader) next() ([]string, error) {
+	if err := r.read(len(r.names)); err != nil {
+		return nil, err
+	}
+	return r.row, nil
+}
+
+func (r *sheetReader) line() int {
+	return r.last
+}
+
+func (r *sheetReader) progress() (*countingReader, int64) {
+	return r.counter, r.size
+}
+
+func (r *sheetReader) fields() logrus.Fields {
+	return logrus.Fields{"format": FormatXLSX, "sheet": r.name}
+}
+
+func (r *sheetReader) close() error {
+	r.sheet.Close()
+	return r.zip.Close()
+}
+
+// decodeXML decodes the XML file of name on the zip to v, it's false when
+// the file is missing
+func decodeXML(z *zip.ReadCloser, name string, v interface{}) (bool, error) {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return true, err
+		}
+		defer rc.Close()
+		return true, xml.NewDecoder(rc).Decode(v)
+	}
+	return false, nil
+}
+
+// sharedStrings reads the strings shared by the cells of the sheets
+func sharedStrings(z *zip.ReadCloser) ([]string, error) {
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, err := decodeXML(z, "xl/sharedStrings.xml", &sst); err != nil {
+		return nil, err
+	}
+	shared := make([]string, len(sst.Items))
+	for i := range sst.Items {
+		shared[i] = sst.Items[i].String()
+	}
+	return shared, nil
+}
+
+// sheetPath returns the name and the path on the zip of the sheet named by
+// sheet (its name or number), the first one when empty
+func sheetPath(z *zip.ReadCloser, sheet string) (string, string, error) {
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if found, err := decodeXML(z, "xl/workbook.xml", &workbook); err != nil {
+		return "", "", err
+	} else if !found || len(workbook.Sheets) == 0 {
+		return "", "", fmt.Errorf("%w: not a XLSX file", ErrInvalidFile)
+	}
+	if _, err := decodeXML(z, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", "", err
+	}
+
+	index := -1
+	if sheet == "" {
+		index = 0
+	}
+	for i, s := range workbook.Sheets {
+		if index < 0 && strings.EqualFold(s.Name, sheet) {
+			index = i
+		}
+	}
+	if n, err := strconv.Atoi(sheet); index < 0 && err == nil && n >= 1 && n <= len(workbook.Sheets) {
+		index = n - 1
+	}
+	if index < 0 {
+		return "", "", fmt.Errorf("%w: %q", ErrSheetNotFound, sheet)
+	}
+
+	s := workbook.Sheets[index]
+	for _, rel := range rels.Relationships {
+		if rel.ID != s.ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return s.Name, strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return s.Name, path.Join("xl", rel.Target), nil
+	}
+	return "", "", fmt.Errorf("%w: sheet %q without file", ErrInvalidFile, s.Name)
+}
+
+// openSheet reads the header of a sheet of the XLSX file of filePath, by
+// its name or number (the first one when empty)
+func openSheet(filePath, sheet string) (*sheetReader, error) {
+	z, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFile, err)
+	}
+	r, err := newSheetReader(z, sheet)
+	if err != nil {
+		z.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newSheetReader(z *zip.ReadCloser, sheet string) (*sheetReader, error) {
+	name, sheetFile, err := sheetPath(z, sheet)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := sharedStrings(z)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &sheetReader{zip: z, name: name, shared: shared}
+	for _, f := range z.File {
+		if f.Name != sheetFile {
+			continue
+		}
+		if r.sheet, err = f.Open(); err != nil {
+			return nil, err
+		}
+		r.size = int64(f.UncompressedSize64)
+		break
+	}
+	if r.sheet == nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidFile, sheetFile)
+	}
+	r.counter = &countingReader{r: r.sheet}
+	r.xml = xml.NewDecoder(r.counter)
+
+	if err := r.read(0); err == io.EOF {
+		r.sheet.Close()
+		return nil, ErrInvalidFile
+	} else if err != nil {
+		r.sheet.Close()
+		return nil, err
+	}
+	r.names = append([]string(nil), r.row...)
+	return r, nil
+}
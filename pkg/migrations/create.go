@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Dialects are the databases with migration scripts
+var Dialects = []string{"postgres", "sqlite"}
+
+var nonWordRE = regexp.MustCompile(`\W+`)
+
+// Create writes empty up and down scripts of a new migration for every
+// dialect on dir (f.ex. `pkg/migrations/sql`) and returns the created files
+func Create(dir, name string) ([]string, error) {
+	name = strings.Trim(nonWordRE.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, fmt.Errorf("%w: empty name", ErrInvalidMigration)
+	}
+
+	var next int64
+	for _, dialect := range Dialects {
+		migrations, err := Load(os.DirFS(filepath.Join(dir, dialect)))
+		if err != nil {
+			return nil, err
+		}
+		if n := len(migrations); n > 0 && migrations[n-1].Version > next {
+			next = migrations[n-1].Version
+		}
+	}
+	next++
+
+	var created []string
+	for _, dialect := range Dialects {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			content := fmt.Sprintf("-- %s migration %04d_%s (%s)\n", direction, next, name, dialect)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				return created, err
+			}
+			created = append(created, path)
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+)
+
+// lockID is an arbitrary key for the postgres advisory lock of migrations
+const lockID = 7311983
+
+// lock prevents concurrent instances from migrating at the same time.
+// On postgres it holds a session advisory lock on conn, SQLite is meant
+// for single instance deployments and relies on the primary key of
+// `schema_migrations` to reject a concurrent apply
+func lock(ctx context.Context, conn *sql.Conn, dialect string) (func(), error) {
+	if dialect != "postgres" {
+		return func() {}, nil
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return nil, err
+	}
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	}, nil
+}
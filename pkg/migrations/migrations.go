@@ -0,0 +1,319 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//go:embed sql
+var files embed.FS
+
+var (
+	ErrUnknownDialect     = errors.New("Unknown database dialect")
+	ErrInvalidMigration   = errors.New("Invalid migration file")
+	ErrNoAppliedMigration = errors.New("There is no applied migration")
+	fileNameRE            = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+)
+
+// Migration is a numbered schema change with its up and down scripts
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of a migration in the database
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	log        *logrus.Logger
+	migrations []Migration
+}
+
+func parseFileName(name string) (int64, string, string, error) {
+	parts := fileNameRE.FindStringSubmatch(name)
+	if parts == nil {
+		return 0, "", "", fmt.Errorf("%w: %s", ErrInvalidMigration, name)
+	}
+	version, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("%w: %s", ErrInvalidMigration, name)
+	}
+	return version, parts[2], parts[3], nil
+}
+
+// Load reads the migrations of a directory sorted by version
+func Load(dir fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	hasUp := make(map[int64]bool)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		version, name, direction, err := parseFileName(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(dir, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("%w: duplicated version %d", ErrInvalidMigration, version)
+		}
+		if direction == "up" {
+			hasUp[version] = true
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !hasUp[m.Version] {
+			return nil, fmt.Errorf("%w: missing up script of version %d", ErrInvalidMigration, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (m *Migrator) placeholder(n int) string {
+	if m.dialect == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp NOT NULL
+	)`)
+	return err
+}
+
+// hasTable tells whether the table of the applied migrations exists,
+// without creating it
+func (m *Migrator) hasTable(ctx context.Context, conn *sql.Conn) (bool, error) {
+	query := "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	if m.dialect == "postgres" {
+		query = "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	}
+	var exists bool
+	err := conn.QueryRowContext(ctx, query).Scan(&exists)
+	return exists, err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// withLock runs fn on a single connection holding the migrations lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := lock(ctx, conn, m.dialect)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	script, stmt := mig.Up, fmt.Sprintf(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)",
+		m.placeholder(1), m.placeholder(2), m.placeholder(3),
+	)
+	args := []interface{}{mig.Version, mig.Name, time.Now().UTC()}
+	if !up {
+		script = mig.Down
+		stmt = fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %s", m.placeholder(1))
+		args = args[:1]
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			m.log.WithField("version", mig.Version).Infof("Applied migration %s", mig.Name)
+		}
+		return nil
+	})
+}
+
+// Down reverts the last `steps` applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return ErrNoAppliedMigration
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			m.log.WithField("version", mig.Version).Infof("Reverted migration %s", mig.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status returns every known migration and when it was applied. It's read
+// only, every migration is pending while there isn't the table of the
+// applied ones
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	exists, err := m.hasTable(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]time.Time)
+	if exists {
+		if applied, err = m.applied(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	status := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		status[i] = Status{Migration: mig}
+		if appliedAt, ok := applied[mig.Version]; ok {
+			status[i].AppliedAt = &appliedAt
+		}
+	}
+	return status, nil
+}
+
+// Check fails when there are pending migrations
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			return fmt.Errorf("pending migration %d_%s", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// New returns a Migrator with the embedded migrations of the database dialect
+func New(db *gorm.DB, log *logrus.Logger) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+	dir, err := fs.Sub(files, "sql/"+dialect)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(dir, "."); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDialect, dialect)
+	}
+
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: sqlDB, dialect: dialect, log: log, migrations: migrations}, nil
+}
@@ -0,0 +1,168 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newMigrator(t *testing.T) (*Migrator, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "fair.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, db
+}
+
+func TestLoad(t *testing.T) {
+	var testCases = []struct {
+		title         string
+		files         fstest.MapFS
+		expectedCount int
+		expectedErr   error
+	}{
+		{
+			"Everything Ok",
+			fstest.MapFS{
+				"0002_second.up.sql":   {Data: []byte("SELECT 2")},
+				"0001_first.up.sql":    {Data: []byte("SELECT 1")},
+				"0001_first.down.sql":  {Data: []byte("SELECT 1")},
+				"0002_second.down.sql": {Data: []byte("SELECT 2")},
+			},
+			2,
+			nil,
+		},
+		{
+			"Invalid File Name",
+			fstest.MapFS{"first.up.sql": {Data: []byte("SELECT 1")}},
+			0,
+			ErrInvalidMigration,
+		},
+		{
+			"Missing Up Script",
+			fstest.MapFS{"0001_first.down.sql": {Data: []byte("SELECT 1")}},
+			0,
+			ErrInvalidMigration,
+		},
+		{
+			"Duplicated Version",
+			fstest.MapFS{
+				"0001_first.up.sql":  {Data: []byte("SELECT 1")},
+				"0001_second.up.sql": {Data: []byte("SELECT 1")},
+			},
+			0,
+			ErrInvalidMigration,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.title, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("got %+v; want %+v", err, tt.expectedErr)
+			}
+			if actual := len(migrations); actual != tt.expectedCount {
+				t.Errorf("got %d; want %d", actual, tt.expectedCount)
+			}
+			if tt.expectedCount > 0 && migrations[0].Version != 1 {
+				t.Errorf("got %d; want 1", migrations[0].Version)
+			}
+		})
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	m, db := newMigrator(t)
+
+	if err := m.Check(ctx); err == nil {
+		t.Error("got <nil>; want pending migrations error")
+	}
+	if db.Migrator().HasTable("schema_migrations") {
+		t.Error("schema_migrations table created by the check")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("got %+v; want <nil>", err)
+		}
+	}
+	if !db.Migrator().HasTable("streetfair") {
+		t.Error("streetfair table not created")
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Errorf("got %+v; want <nil>", err)
+	}
+
+	if err := m.Down(ctx, len(m.migrations)); err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if db.Migrator().HasTable("streetfair") {
+		t.Error("streetfair table not dropped")
+	}
+	if err := m.Down(ctx, 1); err != ErrNoAppliedMigration {
+		t.Errorf("got %+v; want ErrNoAppliedMigration", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newMigrator(t)
+
+	applied := m.migrations[0]
+	m.migrations = m.migrations[:1]
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m.migrations = append(m.migrations, Migration{Version: 9999, Name: "pending", Up: "SELECT 1"})
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if actual := len(status); actual != 2 {
+		t.Fatalf("got %d; want 2", actual)
+	}
+	if status[0].Version != applied.Version || status[0].AppliedAt == nil {
+		t.Errorf("got %+v; want applied version %d", status[0], applied.Version)
+	}
+	if status[1].AppliedAt != nil {
+		t.Errorf("got %+v; want pending", status[1])
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for _, dialect := range Dialects {
+		if err := os.MkdirAll(filepath.Join(dir, dialect), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sqlite", "0003_old.up.sql"), []byte(""), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Create(dir, "Add Schedule")
+	if err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	if actual := len(files); actual != 2*len(Dialects) {
+		t.Errorf("got %d; want %d", actual, 2*len(Dialects))
+	}
+
+	expected := filepath.Join(dir, "postgres", "0004_add_schedule.up.sql")
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("got %+v; want %s created", err, expected)
+	}
+}
@@ -0,0 +1,4 @@
+ALTER TABLE streetfair
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at,
+    DROP COLUMN version;
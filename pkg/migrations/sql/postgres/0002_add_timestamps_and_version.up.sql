@@ -0,0 +1,4 @@
+ALTER TABLE streetfair
+    ADD COLUMN created_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys (
+    idempotency_key text PRIMARY KEY,
+    request_hash text NOT NULL,
+    status integer NOT NULL DEFAULT 0,
+    header text,
+    body bytea,
+    created_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,9 @@
+CREATE TABLE street_fair_events (
+    id bigserial PRIMARY KEY,
+    type text NOT NULL,
+    registry text NOT NULL,
+    model text,
+    created_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_street_fair_events_created_at ON street_fair_events (created_at);
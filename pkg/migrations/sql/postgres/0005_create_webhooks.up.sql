@@ -0,0 +1,38 @@
+CREATE TABLE webhook_subscriptions (
+    id text PRIMARY KEY,
+    url text NOT NULL,
+    events text NOT NULL DEFAULT '',
+    district text NOT NULL DEFAULT '',
+    region5 text NOT NULL DEFAULT '',
+    secret text NOT NULL,
+    created_at timestamptz NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    subscription_id text NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id bigint NOT NULL DEFAULT 0,
+    event_type text NOT NULL,
+    registry text NOT NULL,
+    payload text NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    last_error text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, status);
+
+CREATE TABLE webhook_attempts (
+    id bigserial PRIMARY KEY,
+    delivery_id bigint NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+    status_code integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    duration_ms integer NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_webhook_attempts_delivery ON webhook_attempts (delivery_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_street_fair_events_registry;
+DROP INDEX IF EXISTS idx_street_fair_events_pending;
+ALTER TABLE street_fair_events
+    DROP COLUMN claimed_until,
+    DROP COLUMN delivered_at;
@@ -0,0 +1,9 @@
+ALTER TABLE street_fair_events
+    ADD COLUMN delivered_at timestamptz,
+    ADD COLUMN claimed_until timestamptz;
+
+-- the events before the outbox were already published
+UPDATE street_fair_events SET delivered_at = created_at;
+
+CREATE INDEX idx_street_fair_events_pending ON street_fair_events (id) WHERE delivered_at IS NULL;
+CREATE INDEX idx_street_fair_events_registry ON street_fair_events (registry, id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_streetfair_deleted_at;
+
+-- the street fairs deleted by a sync are gone for good
+DELETE FROM streetfair WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE streetfair DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE streetfair ADD COLUMN deleted_at timestamptz;
+
+CREATE INDEX idx_streetfair_deleted_at ON streetfair (deleted_at);
@@ -0,0 +1,4 @@
+-- the sequence of the ids takes over from the counter
+SELECT setval('street_fair_events_id_seq', GREATEST(last_id, 1)) FROM street_fair_event_ids;
+
+DROP TABLE street_fair_event_ids;
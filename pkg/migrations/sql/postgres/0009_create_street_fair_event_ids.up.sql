@@ -0,0 +1,9 @@
+-- the ids of the events are taken from this counter in the transaction of
+-- their change, its row lock makes them visible in the order of the ids
+CREATE TABLE street_fair_event_ids (
+    last_id bigint NOT NULL
+);
+
+INSERT INTO street_fair_event_ids (last_id)
+SELECT GREATEST(COALESCE(MAX(id), 0), (SELECT last_value FROM street_fair_events_id_seq))
+FROM street_fair_events;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS streetfair (
+    longitude real,
+    latitude real,
+    setcens text,
+    areap text,
+    cod_district text,
+    district text,
+    cod_sub_city_hall text,
+    sub_city_hall text,
+    region5 text,
+    region8 text,
+    name text,
+    registry text,
+    address text,
+    address_number text,
+    neighborhood text,
+    landmark text
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_streetfair_registry ON streetfair (registry);
+CREATE INDEX IF NOT EXISTS idx_streetfair_district ON streetfair (district);
+CREATE INDEX IF NOT EXISTS idx_streetfair_region5 ON streetfair (region5);
+CREATE INDEX IF NOT EXISTS idx_streetfair_name ON streetfair (name);
+CREATE INDEX IF NOT EXISTS idx_streetfair_neighborhood ON streetfair (neighborhood);
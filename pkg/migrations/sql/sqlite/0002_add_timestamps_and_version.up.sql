@@ -0,0 +1,5 @@
+ALTER TABLE streetfair ADD COLUMN created_at datetime;
+ALTER TABLE streetfair ADD COLUMN updated_at datetime;
+ALTER TABLE streetfair ADD COLUMN version integer NOT NULL DEFAULT 1;
+
+UPDATE streetfair SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
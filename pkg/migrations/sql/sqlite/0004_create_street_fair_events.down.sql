@@ -0,0 +1 @@
+DROP TABLE IF EXISTS street_fair_events;
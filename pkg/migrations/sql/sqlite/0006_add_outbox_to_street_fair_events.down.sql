@@ -0,0 +1,16 @@
+CREATE TABLE street_fair_events_old (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    type text NOT NULL,
+    registry text NOT NULL,
+    model text,
+    created_at datetime NOT NULL
+);
+
+INSERT INTO street_fair_events_old
+SELECT id, type, registry, model, created_at
+FROM street_fair_events;
+
+DROP TABLE street_fair_events;
+ALTER TABLE street_fair_events_old RENAME TO street_fair_events;
+
+CREATE INDEX idx_street_fair_events_created_at ON street_fair_events (created_at);
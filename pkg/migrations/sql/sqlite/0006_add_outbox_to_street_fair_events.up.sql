@@ -0,0 +1,8 @@
+ALTER TABLE street_fair_events ADD COLUMN delivered_at datetime;
+ALTER TABLE street_fair_events ADD COLUMN claimed_until datetime;
+
+-- the events before the outbox were already published
+UPDATE street_fair_events SET delivered_at = created_at;
+
+CREATE INDEX idx_street_fair_events_pending ON street_fair_events (delivered_at, id);
+CREATE INDEX idx_street_fair_events_registry ON street_fair_events (registry, id);
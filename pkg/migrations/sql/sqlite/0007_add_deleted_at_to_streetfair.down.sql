@@ -0,0 +1,38 @@
+CREATE TABLE streetfair_old (
+    longitude real,
+    latitude real,
+    setcens text,
+    areap text,
+    cod_district text,
+    district text,
+    cod_sub_city_hall text,
+    sub_city_hall text,
+    region5 text,
+    region8 text,
+    name text,
+    registry text,
+    address text,
+    address_number text,
+    neighborhood text,
+    landmark text,
+    created_at datetime,
+    updated_at datetime,
+    version integer NOT NULL DEFAULT 1
+);
+
+-- the street fairs deleted by a sync are gone for good
+INSERT INTO streetfair_old
+SELECT longitude, latitude, setcens, areap, cod_district, district, cod_sub_city_hall, sub_city_hall,
+       region5, region8, name, registry, address, address_number, neighborhood, landmark,
+       created_at, updated_at, version
+FROM streetfair
+WHERE deleted_at IS NULL;
+
+DROP TABLE streetfair;
+ALTER TABLE streetfair_old RENAME TO streetfair;
+
+CREATE UNIQUE INDEX idx_streetfair_registry ON streetfair (registry);
+CREATE INDEX idx_streetfair_district ON streetfair (district);
+CREATE INDEX idx_streetfair_region5 ON streetfair (region5);
+CREATE INDEX idx_streetfair_name ON streetfair (name);
+CREATE INDEX idx_streetfair_neighborhood ON streetfair (neighborhood);
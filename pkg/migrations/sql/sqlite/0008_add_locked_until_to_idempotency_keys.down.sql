@@ -0,0 +1,17 @@
+CREATE TABLE idempotency_keys_old (
+    idempotency_key text PRIMARY KEY,
+    request_hash text NOT NULL,
+    status integer NOT NULL DEFAULT 0,
+    header text,
+    body blob,
+    created_at datetime NOT NULL
+);
+
+INSERT INTO idempotency_keys_old
+SELECT idempotency_key, request_hash, status, header, body, created_at
+FROM idempotency_keys;
+
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_old RENAME TO idempotency_keys;
+
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,3 @@
+-- the in progress keys are reclaimable after locked_until, f.ex. when the
+-- instance crashed while running their request
+ALTER TABLE idempotency_keys ADD COLUMN locked_until datetime;
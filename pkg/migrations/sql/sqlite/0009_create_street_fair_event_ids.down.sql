@@ -0,0 +1 @@
+DROP TABLE street_fair_event_ids;
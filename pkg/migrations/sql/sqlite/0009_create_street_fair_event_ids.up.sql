@@ -0,0 +1,11 @@
+-- the ids of the events are taken from this counter in the transaction of
+-- their change, its row lock makes them visible in the order of the ids
+CREATE TABLE street_fair_event_ids (
+    last_id integer NOT NULL
+);
+
+INSERT INTO street_fair_event_ids (last_id)
+SELECT MAX(
+    COALESCE((SELECT MAX(id) FROM street_fair_events), 0),
+    COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'street_fair_events'), 0)
+);
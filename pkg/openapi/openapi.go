@@ -0,0 +1,171 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// redoc is the Redoc bundle of the docs, the build fails without it, see
+// `make redoc`
+//
+//go:embed redoc/redoc.standalone.js
+var redoc []byte
+
+const docsPage = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>Street Fair API</title>
+    <meta charset="utf-8"/>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+  </head>
+  <body>
+    <redoc spec-url="openapi.json"></redoc>
+    <script src="docs/redoc.standalone.js"></script>
+  </body>
+</html>
+`
+
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*Schema `json:"properties"`
+	Items      *Schema            `json:"items"`
+	Enum       []interface{}      `json:"enum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	// AdditionalProperties is only enforced when `false`
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type PathItem struct {
+	Servers    []Server    `json:"servers"`
+	Parameters []Parameter `json:"parameters"`
+	Get        *Operation  `json:"get"`
+	Post       *Operation  `json:"post"`
+	Put        *Operation  `json:"put"`
+	Patch      *Operation  `json:"patch"`
+	Delete     *Operation  `json:"delete"`
+}
+
+// Operation returns the operation of the HTTP method, nil if not described
+func (p *PathItem) Operation(method string) *Operation {
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		return p.Get
+	case http.MethodPost:
+		return p.Post
+	case http.MethodPut:
+		return p.Put
+	case http.MethodPatch:
+		return p.Patch
+	case http.MethodDelete:
+		return p.Delete
+	}
+	return nil
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+}
+
+// Document is the subset of an OpenAPI 3 document used for validation
+type Document struct {
+	Servers    []Server             `json:"servers"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Path returns the item of a route path template, the paths are relative
+// to the servers (f.ex. `/v1`) unless they override them, so both the
+// template with the server prefix and the one without it are found
+func (d *Document) Path(tpl string) *PathItem {
+	if item, ok := d.Paths[tpl]; ok {
+		return item
+	}
+	for _, server := range d.Servers {
+		prefix := strings.TrimSuffix(server.URL, "/")
+		if prefix == "" || !strings.HasPrefix(tpl, prefix+"/") {
+			continue
+		}
+		if item, ok := d.Paths[strings.TrimPrefix(tpl, prefix)]; ok && len(item.Servers) == 0 {
+			return item
+		}
+	}
+	return nil
+}
+
+// Load parses the embedded OpenAPI document
+func Load() (*Document, error) {
+	doc := new(Document)
+	if err := json.Unmarshal(spec, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// SpecHandler serves the OpenAPI document
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(spec)
+}
+
+// DocsHandler serves a Redoc page of the OpenAPI document
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(docsPage))
+}
+
+// RedocHandler serves the embedded Redoc bundle of the docs
+func RedocHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(redoc)
+}
+
+// RegisterHandlers serves the document on `/openapi.json` and its docs on `/docs`
+func RegisterHandlers(r *mux.Router) {
+	r.HandleFunc("/openapi.json", SpecHandler).Methods("GET")
+	r.HandleFunc("/docs", DocsHandler).Methods("GET")
+	r.HandleFunc("/docs/redoc.standalone.js", RedocHandler).Methods("GET")
+}
@@ -0,0 +1,147 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drgarcia1986/street-fair/pkg/api"
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/feed"
+	"github.com/drgarcia1986/street-fair/pkg/gql"
+	"github.com/drgarcia1986/street-fair/pkg/webhook"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSpecMatchesRoutes(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := api.NewServer(8000, logrus.New())
+	graphql, err := gql.New(nil, &gql.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Register(graphql.RegisterHandlers)
+	server.Register(feed.New(fair.NewBus(), &feed.Config{}, logrus.New()).RegisterHandlers)
+	server.Register(webhook.NewHTTPService(nil, &webhook.Config{}, logrus.New()).RegisterHandlers)
+	server.AddVersion(api.APIVersion{Name: "v1", Register: fair.NewHTTPService(nil).RegisterHandlers})
+	if err := server.AliasRoot("v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = server.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// the subrouters of the versions
+			return nil
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		item := doc.Path(tpl)
+		if item == nil {
+			t.Errorf("got no path %s on the spec; want it documented", tpl)
+			return nil
+		}
+		for _, m := range methods {
+			if item.Operation(m) == nil {
+				t.Errorf("got no operation %s %s on the spec; want it documented", m, tpl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpecHandlers(t *testing.T) {
+	r := mux.NewRouter()
+	RegisterHandlers(r)
+
+	var tt = []struct {
+		path        string
+		contentType string
+	}{
+		{"/openapi.json", "application/json"},
+		{"/docs", "text/html; charset=utf-8"},
+		{"/docs/redoc.standalone.js", "application/javascript"},
+	}
+	for _, tc := range tt {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", tc.path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got %d; want %d", tc.path, rr.Code, http.StatusOK)
+		}
+		if actual := rr.Header().Get("Content-Type"); actual != tc.contentType {
+			t.Errorf("%s: got %s; want %s", tc.path, actual, tc.contentType)
+		}
+		if rr.Body.Len() == 0 {
+			t.Errorf("%s: got an empty body; want the content", tc.path)
+		}
+	}
+}
+
+func TestDocsPageIsSelfContained(t *testing.T) {
+	if strings.Contains(docsPage, "://") {
+		t.Errorf("got an external URL on the docs page; want only relative ones:\n%s", docsPage)
+	}
+}
+
+func TestValidatorMiddleware(t *testing.T) {
+	v, err := NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	r.Use(v.Middleware)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.HandleFunc("/_bulk", ok).Methods("POST")
+	r.HandleFunc("/", ok).Methods("GET", "POST")
+	r.HandleFunc("/{registry}/", ok).Methods("PUT")
+	r.PathPrefix("/v1").Subrouter().HandleFunc("/", ok).Methods("POST")
+
+	var tt = []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		expected    int
+	}{
+		{"list", "GET", "/?district=VILA", "", "", http.StatusOK},
+		{"create", "POST", "/", "application/json", `{"registry":"4041-0","latitude":-23.5}`, http.StatusOK},
+		{"create without body", "POST", "/", "application/json", ``, http.StatusBadRequest},
+		{"create without registry", "POST", "/", "application/json", `{"name":"VILA"}`, http.StatusBadRequest},
+		{"create empty registry", "POST", "/", "application/json", `{"registry":""}`, http.StatusBadRequest},
+		{"create wrong type", "POST", "/", "application/json", `{"registry":"4041-0","latitude":"south"}`, http.StatusBadRequest},
+		{"create malformed", "POST", "/", "application/json", `{"registry":`, http.StatusBadRequest},
+		{"create v1 without registry", "POST", "/v1/", "application/json", `{"name":"VILA"}`, http.StatusBadRequest},
+		{"update", "PUT", "/4041-0/", "application/json", `{"registry":"4041-0"}`, http.StatusOK},
+		{"bulk", "POST", "/_bulk?mode=best-effort", "application/json", `[{"op":"delete","registry":"4041-0"}]`, http.StatusOK},
+		{"bulk invalid mode", "POST", "/_bulk?mode=all", "application/json", `[{"op":"delete","registry":"4041-0"}]`, http.StatusBadRequest},
+		{"bulk invalid op", "POST", "/_bulk", "application/json", `[{"op":"upsert"}]`, http.StatusBadRequest},
+		{"bulk empty", "POST", "/_bulk", "application/json", `[]`, http.StatusBadRequest},
+		{"bulk ndjson", "POST", "/_bulk", "application/x-ndjson", "{\"op\":\"delete\",\"registry\":\"1\"}\n{\"op\":\"delete\",\"registry\":\"2\"}\n", http.StatusOK},
+		{"bulk ndjson invalid op", "POST", "/_bulk", "application/x-ndjson", "{\"op\":\"delete\",\"registry\":\"1\"}\n{\"op\":\"upsert\"}\n", http.StatusBadRequest},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tc.expected {
+				t.Errorf("got %d; want %d (%s)", rr.Code, tc.expected, rr.Body.String())
+			}
+		})
+	}
+}
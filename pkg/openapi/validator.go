@@ -0,0 +1,277 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const refPrefix = "#/components/"
+
+type errResp struct {
+	Msg string `json:"msg"`
+}
+
+// Validator checks the requests against the OpenAPI document, the path and
+// query parameters and the body are validated, the headers are left to the
+// handlers (f.ex. a missing `If-Match` must be a `428` not a `400`)
+type Validator struct {
+	doc *Document
+}
+
+func (v *Validator) schema(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = v.doc.Components.Schemas[strings.TrimPrefix(s.Ref, refPrefix+"schemas/")]
+	}
+	return s
+}
+
+func (v *Validator) parameter(p Parameter) *Parameter {
+	if p.Ref == "" {
+		return &p
+	}
+	return v.doc.Components.Parameters[strings.TrimPrefix(p.Ref, refPrefix+"parameters/")]
+}
+
+func typeError(path, expected string) error {
+	return fmt.Errorf("%s: must be %s", path, expected)
+}
+
+func (v *Validator) validate(s *Schema, value interface{}, path string) error {
+	s = v.schema(s)
+	if s == nil {
+		return nil
+	}
+
+	if len(s.Enum) > 0 {
+		var found bool
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: must be one of %v", path, s.Enum)
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError(path, "an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s.%s: is required", path, name)
+			}
+		}
+		for name, prop := range obj {
+			propSchema, ok := s.Properties[name]
+			if !ok {
+				if string(s.AdditionalProperties) == "false" {
+					return fmt.Errorf("%s.%s: is not allowed", path, name)
+				}
+				continue
+			}
+			if err := v.validate(propSchema, prop, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return typeError(path, "an array")
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			return fmt.Errorf("%s: must have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			return fmt.Errorf("%s: must have at most %d items", path, *s.MaxItems)
+		}
+		for i, item := range arr {
+			if err := v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return typeError(path, "a string")
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			return fmt.Errorf("%s: must have at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && len(str) > *s.MaxLength {
+			return fmt.Errorf("%s: must have at most %d characters", path, *s.MaxLength)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return typeError(path, "a number")
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			return typeError(path, "an integer")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return typeError(path, "a boolean")
+		}
+	}
+	return nil
+}
+
+// parseParam converts a raw parameter to the JSON type of its schema
+func (v *Validator) parseParam(s *Schema, raw string) interface{} {
+	switch s = v.schema(s); {
+	case s == nil:
+		return raw
+	case s.Type == "integer" || s.Type == "number":
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			return n
+		}
+	case s.Type == "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+func (v *Validator) validateParams(r *http.Request, params []Parameter) error {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	for _, p := range params {
+		param := v.parameter(p)
+		if param == nil {
+			continue
+		}
+
+		var (
+			raw     string
+			present bool
+		)
+		switch param.In {
+		case "query":
+			_, present = query[param.Name]
+			raw = query.Get(param.Name)
+		case "path":
+			raw, present = vars[param.Name]
+		default:
+			continue
+		}
+
+		path := param.In + "." + param.Name
+		if !present {
+			if param.Required {
+				return fmt.Errorf("%s: is required", path)
+			}
+			continue
+		}
+		if err := v.validate(param.Schema, v.parseParam(param.Schema, raw), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validateBody(r *http.Request, rb *RequestBody) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if rb.Required {
+			return fmt.Errorf("body: is required")
+		}
+		return nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	media, ok := rb.Content[contentType]
+	if !ok {
+		if media, ok = rb.Content["application/json"]; !ok {
+			return fmt.Errorf("body: unsupported content type %s", contentType)
+		}
+		contentType = "application/json"
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for i := 0; dec.More(); i++ {
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+		path := "body"
+		if contentType == "application/x-ndjson" {
+			path = fmt.Sprintf("body[%d]", i)
+		}
+		if err := v.validate(media.Schema, value, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks r against the operation of its route, requests
+// of routes not described by the document are accepted
+func (v *Validator) Validate(r *http.Request) error {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	item := v.doc.Path(tpl)
+	if item == nil {
+		return nil
+	}
+	op := item.Operation(r.Method)
+	if op == nil {
+		return nil
+	}
+
+	if err := v.validateParams(r, append(append([]Parameter{}, item.Parameters...), op.Parameters...)); err != nil {
+		return err
+	}
+	if op.RequestBody != nil {
+		return v.validateBody(r, op.RequestBody)
+	}
+	return nil
+}
+
+// Middleware rejects with `400 Bad Request` the invalid requests,
+// it must be used on a mux.Router (see Router.Use)
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.Validate(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(&errResp{Msg: "Invalid request: " + err.Error()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewValidator returns a Validator of the embedded OpenAPI document
+func NewValidator() (*Validator, error) {
+	doc, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{doc: doc}, nil
+}
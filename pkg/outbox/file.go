@@ -0,0 +1,42 @@
+package outbox
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+)
+
+// FileSink appends the events to a NDJSON file
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Send writes e as a line, synced to the disk before returning
+func (s *FileSink) Send(e *fair.Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// NewFileSink returns a FileSink appending to the file of path
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+)
+
+// batchSize is the number of events claimed at once by the Relay
+const batchSize = 100
+
+type Config struct {
+	// Interval is how often the outbox is polled (the local changes
+	// wake the relay right away)
+	Interval time.Duration `default:"1s"`
+	// Lease is how long the claimed events are hidden from the other relays
+	Lease time.Duration `default:"30s"`
+	// File is the path of a NDJSON file the events are appended to, if any
+	File string
+}
+
+// NewConfig returns the settings from the `FAIR_OUTBOX_*` env vars
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_outbox", conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// Sink receives the events relayed from the outbox, an event is sent
+// again (to every sink) when some sink fails
+type Sink interface {
+	Send(e *fair.Event) error
+}
+
+// Relay delivers the events of the outbox to the sinks at-least-once, in
+// order by registry: when an event fails, the later events of its registry
+// wait for it
+type Relay struct {
+	outbox fair.Outbox
+	sinks  []Sink
+	conf   *Config
+	log    *logrus.Logger
+	now    func() time.Time
+	wake   chan struct{}
+}
+
+func (r *Relay) send(e *fair.Event) error {
+	for _, sink := range r.sinks {
+		if err := sink.Send(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relay delivers a batch of events, returning how many were claimed
+// and whether some failed
+func (r *Relay) relay() (int, bool, error) {
+	events, err := r.outbox.Claim(r.now(), r.conf.Lease, batchSize)
+	if err != nil {
+		return 0, false, err
+	}
+
+	blocked := make(map[string]bool)
+	var delivered, released []int64
+	for i := range events {
+		e := &events[i]
+		if blocked[e.Registry] {
+			released = append(released, e.ID)
+			continue
+		}
+		if err := r.send(e); err != nil {
+			r.log.WithField("event", e.ID).WithField("registry", e.Registry).
+				Errorf("Relaying street fair event: %+v", err)
+			blocked[e.Registry] = true
+			released = append(released, e.ID)
+			continue
+		}
+		delivered = append(delivered, e.ID)
+	}
+
+	if err := r.outbox.MarkDelivered(delivered, r.now()); err != nil {
+		return len(events), true, err
+	}
+	if err := r.outbox.Release(released); err != nil {
+		return len(events), true, err
+	}
+	return len(events), len(released) > 0, nil
+}
+
+// Notify wakes the relay without blocking
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays the events until ctx is done, on every interval or when
+// notified. After a failure it waits the interval to retry
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.conf.Interval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			n, failed, err := r.relay()
+			if err != nil {
+				r.log.Errorf("Relaying the outbox: %+v", err)
+			}
+			if err != nil || failed || n < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// NewRelay returns a Relay of the events of outbox to sinks
+func NewRelay(outbox fair.Outbox, conf *Config, log *logrus.Logger, sinks ...Sink) *Relay {
+	return &Relay{
+		outbox: outbox,
+		sinks:  sinks,
+		conf:   conf,
+		log:    log,
+		now:    func() time.Time { return time.Now().UTC() },
+		wake:   make(chan struct{}, 1),
+	}
+}
@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/sirupsen/logrus"
+)
+
+// memOutbox is an in-memory fair.Outbox, it doesn't mind the leases
+type memOutbox struct {
+	events    []fair.Event
+	claimed   map[int64]bool
+	delivered map[int64]bool
+}
+
+func newMemOutbox(registries ...string) *memOutbox {
+	o := &memOutbox{claimed: make(map[int64]bool), delivered: make(map[int64]bool)}
+	for i, registry := range registries {
+		o.events = append(o.events, fair.Event{ID: int64(i + 1), Type: fair.EventUpdated, Registry: registry})
+	}
+	return o
+}
+
+func (o *memOutbox) Since(id int64, limit int) ([]fair.Event, error) {
+	return nil, nil
+}
+
+func (o *memOutbox) Last() (int64, error) {
+	return int64(len(o.events)), nil
+}
+
+func (o *memOutbox) Purge(t time.Time) error {
+	return nil
+}
+
+func (o *memOutbox) Claim(now time.Time, lease time.Duration, limit int) ([]fair.Event, error) {
+	var events []fair.Event
+	for _, e := range o.events {
+		if !o.delivered[e.ID] && !o.claimed[e.ID] && len(events) < limit {
+			o.claimed[e.ID] = true
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (o *memOutbox) Release(ids []int64) error {
+	for _, id := range ids {
+		delete(o.claimed, id)
+	}
+	return nil
+}
+
+func (o *memOutbox) MarkDelivered(ids []int64, at time.Time) error {
+	for _, id := range ids {
+		o.delivered[id] = true
+		delete(o.claimed, id)
+	}
+	return nil
+}
+
+// memSink records the ids of the events sent, failing the ids of fail
+type memSink struct {
+	sent []int64
+	fail map[int64]bool
+}
+
+func (s *memSink) Send(e *fair.Event) error {
+	if s.fail[e.ID] {
+		return errors.New("sink unavailable")
+	}
+	s.sent = append(s.sent, e.ID)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	outbox := newMemOutbox("4041-0", "4045-2", "4041-0", "4045-2")
+	sink := &memSink{fail: map[int64]bool{1: true}}
+	r := NewRelay(outbox, &Config{Lease: time.Minute}, logrus.New(), sink)
+
+	n, failed, err := r.relay()
+	if n != 4 || !failed || err != nil {
+		t.Fatalf("got %d, %t, %+v; want 4, true, <nil>", n, failed, err)
+	}
+	// the events of 4041-0 wait for the failed one
+	if expected := []int64{2, 4}; !reflect.DeepEqual(sink.sent, expected) {
+		t.Errorf("got %v; want %v", sink.sent, expected)
+	}
+	if len(outbox.claimed) != 0 {
+		t.Errorf("got %v; want the failed events released", outbox.claimed)
+	}
+
+	delete(sink.fail, 1)
+	if n, failed, _ := r.relay(); n != 2 || failed {
+		t.Errorf("got %d, %t; want 2, false", n, failed)
+	}
+	if expected := []int64{2, 4, 1, 3}; !reflect.DeepEqual(sink.sent, expected) {
+		t.Errorf("got %v; want %v", sink.sent, expected)
+	}
+	if n, _, _ := r.relay(); n != 0 {
+		t.Errorf("got %d; want nothing left to relay", n)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range newMemOutbox("4041-0", "4045-2").events {
+		e := e
+		if err := sink.Send(&e); err != nil {
+			t.Fatalf("got %+v; want <nil>", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var registries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e fair.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		registries = append(registries, e.Registry)
+	}
+	if expected := []string{"4041-0", "4045-2"}; !reflect.DeepEqual(registries, expected) {
+		t.Errorf("got %v; want %v", registries, expected)
+	}
+}
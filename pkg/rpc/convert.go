@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/rpc/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var eventTypes = map[string]pb.Event_Type{
+	fair.EventCreated: pb.Event_CREATED,
+	fair.EventUpdated: pb.Event_UPDATED,
+	fair.EventDeleted: pb.Event_DELETED,
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func toProto(m *fair.Model) *pb.StreetFair {
+	return &pb.StreetFair{
+		Longitude:      m.Longitude,
+		Latitude:       m.Latitude,
+		Setcens:        m.Setcens,
+		Areap:          m.Areap,
+		CodDistrict:    m.CodDistrict,
+		District:       m.District,
+		CodSubCityHall: m.CodSubCityHall,
+		SubCityHall:    m.SubCityHall,
+		Region_5:       m.Region5,
+		Region_8:       m.Region8,
+		Name:           m.Name,
+		Registry:       m.Registry,
+		Address:        m.Address,
+		AddressNumber:  m.AddressNumber,
+		Neighborhood:   m.Neighborhood,
+		Landmark:       m.Landmark,
+		Version:        m.Version,
+		CreatedAt:      timestamp(m.CreatedAt),
+		UpdatedAt:      timestamp(m.UpdatedAt),
+	}
+}
+
+// fromProto converts the writable fields of p
+func fromProto(p *pb.StreetFair) *fair.Model {
+	return &fair.Model{
+		Longitude:      p.Longitude,
+		Latitude:       p.Latitude,
+		Setcens:        p.Setcens,
+		Areap:          p.Areap,
+		CodDistrict:    p.CodDistrict,
+		District:       p.District,
+		CodSubCityHall: p.CodSubCityHall,
+		SubCityHall:    p.SubCityHall,
+		Region5:        p.Region_5,
+		Region8:        p.Region_8,
+		Name:           p.Name,
+		Registry:       p.Registry,
+		Address:        p.Address,
+		AddressNumber:  p.AddressNumber,
+		Neighborhood:   p.Neighborhood,
+		Landmark:       p.Landmark,
+		Version:        p.Version,
+	}
+}
+
+func eventToProto(e *fair.Event) *pb.Event {
+	event := &pb.Event{
+		Type:     eventTypes[e.Type],
+		Registry: e.Registry,
+		Time:     timestamp(e.Time),
+	}
+	if e.Model != nil {
+		event.StreetFair = toProto(e.Model)
+	}
+	return event
+}
@@ -0,0 +1,5 @@
+// Package pb is the code generated from streetfair.proto, regenerate it with
+// `go generate` (requires protoc, protoc-gen-go v1.27 and protoc-gen-go-grpc v1.1)
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative streetfair.proto
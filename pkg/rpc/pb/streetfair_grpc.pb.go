@@ -0,0 +1,311 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// StreetFairServiceClient is the client API for StreetFairService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type StreetFairServiceClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*StreetFair, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*StreetFair, error)
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*StreetFair, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Watch streams the changes of the street fairs from the call on
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (StreetFairService_WatchClient, error)
+}
+
+type streetFairServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewStreetFairServiceClient(cc grpc.ClientConnInterface) StreetFairServiceClient {
+	return &streetFairServiceClient{cc}
+}
+
+func (c *streetFairServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*StreetFair, error) {
+	out := new(StreetFair)
+	err := c.cc.Invoke(ctx, "/streetfair.v1.StreetFairService/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streetFairServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/streetfair.v1.StreetFairService/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streetFairServiceClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*StreetFair, error) {
+	out := new(StreetFair)
+	err := c.cc.Invoke(ctx, "/streetfair.v1.StreetFairService/Create", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streetFairServiceClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*StreetFair, error) {
+	out := new(StreetFair)
+	err := c.cc.Invoke(ctx, "/streetfair.v1.StreetFairService/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streetFairServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/streetfair.v1.StreetFairService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streetFairServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (StreetFairService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &StreetFairService_ServiceDesc.Streams[0], "/streetfair.v1.StreetFairService/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &streetFairServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type StreetFairService_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type streetFairServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *streetFairServiceWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// StreetFairServiceServer is the server API for StreetFairService service.
+// All implementations must embed UnimplementedStreetFairServiceServer
+// for forward compatibility
+type StreetFairServiceServer interface {
+	Get(context.Context, *GetRequest) (*StreetFair, error)
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	Create(context.Context, *CreateRequest) (*StreetFair, error)
+	Update(context.Context, *UpdateRequest) (*StreetFair, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Watch streams the changes of the street fairs from the call on
+	Watch(*WatchRequest, StreetFairService_WatchServer) error
+	mustEmbedUnimplementedStreetFairServiceServer()
+}
+
+// UnimplementedStreetFairServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedStreetFairServiceServer struct {
+}
+
+func (UnimplementedStreetFairServiceServer) Get(context.Context, *GetRequest) (*StreetFair, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedStreetFairServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedStreetFairServiceServer) Create(context.Context, *CreateRequest) (*StreetFair, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedStreetFairServiceServer) Update(context.Context, *UpdateRequest) (*StreetFair, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedStreetFairServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedStreetFairServiceServer) Watch(*WatchRequest, StreetFairService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedStreetFairServiceServer) mustEmbedUnimplementedStreetFairServiceServer() {}
+
+// UnsafeStreetFairServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to StreetFairServiceServer will
+// result in compilation errors.
+type UnsafeStreetFairServiceServer interface {
+	mustEmbedUnimplementedStreetFairServiceServer()
+}
+
+func RegisterStreetFairServiceServer(s grpc.ServiceRegistrar, srv StreetFairServiceServer) {
+	s.RegisterService(&StreetFairService_ServiceDesc, srv)
+}
+
+func _StreetFairService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreetFairServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streetfair.v1.StreetFairService/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreetFairServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreetFairService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreetFairServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streetfair.v1.StreetFairService/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreetFairServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreetFairService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreetFairServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streetfair.v1.StreetFairService/Create",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreetFairServiceServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreetFairService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreetFairServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streetfair.v1.StreetFairService/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreetFairServiceServer).Update(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreetFairService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreetFairServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streetfair.v1.StreetFairService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreetFairServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreetFairService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StreetFairServiceServer).Watch(m, &streetFairServiceWatchServer{stream})
+}
+
+type StreetFairService_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type streetFairServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *streetFairServiceWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// StreetFairService_ServiceDesc is the grpc.ServiceDesc for StreetFairService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var StreetFairService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "streetfair.v1.StreetFairService",
+	HandlerType: (*StreetFairServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _StreetFairService_Get_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _StreetFairService_List_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _StreetFairService_Create_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _StreetFairService_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _StreetFairService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _StreetFairService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "streetfair.proto",
+}
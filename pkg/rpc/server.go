@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/rpc/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errLagging         = status.Error(codes.ResourceExhausted, "Watch is lagging behind the changes, call it again")
+	errVersionRequired = status.Error(codes.InvalidArgument, "The current version is required")
+)
+
+// Service implements the gRPC StreetFairService on a fair.StreetFair
+type Service struct {
+	pb.UnimplementedStreetFairServiceServer
+	sf  fair.StreetFair
+	bus *fair.Bus
+	log *logrus.Logger
+	// done ends the Watch streams on shutdown
+	done chan struct{}
+}
+
+func (s *Service) statusByErr(err error) error {
+	switch {
+	case errors.Is(err, fair.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, fair.ErrVersionMismatch):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, fair.ErrInvalidStreetFair):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.log.Errorf("gRPC call failed: %+v", err)
+	return status.Error(codes.Internal, fair.ErrInternal.Error())
+}
+
+func (s *Service) Get(ctx context.Context, req *pb.GetRequest) (*pb.StreetFair, error) {
+	m, err := s.sf.Get(req.Registry)
+	if err != nil {
+		return nil, s.statusByErr(err)
+	}
+	return toProto(m), nil
+}
+
+// List pages over the street fairs sorted by registry, the page token
+// is the offset of the page. The paging runs on the database when the
+// StreetFair is a fair.Querier
+func (s *Service) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	var offset int
+	if req.PageToken != "" {
+		var err error
+		if offset, err = strconv.Atoi(req.PageToken); err != nil || offset < 0 {
+			return nil, status.Error(codes.InvalidArgument, "Invalid page token")
+		}
+	}
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid page size")
+	}
+
+	// one more street fair than the page tells whether there's a next one
+	q := &fair.Query{
+		Filters: map[string]string{
+			"district":     req.District,
+			"region5":      req.Region5,
+			"name":         req.Name,
+			"neighborhood": req.Neighborhood,
+		},
+		Offset: offset,
+	}
+	if req.PageSize > 0 {
+		q.Limit = int(req.PageSize) + 1
+	}
+	models, err := fair.RunQuery(s.sf, q)
+	if err != nil {
+		return nil, s.statusByErr(err)
+	}
+
+	resp := &pb.ListResponse{}
+	if req.PageSize > 0 && len(models) > int(req.PageSize) {
+		models = models[:req.PageSize]
+		resp.NextPageToken = strconv.Itoa(offset + len(models))
+	}
+	resp.StreetFairs = make([]*pb.StreetFair, 0, len(models))
+	for i := range models {
+		resp.StreetFairs = append(resp.StreetFairs, toProto(&models[i]))
+	}
+	return resp, nil
+}
+
+func (s *Service) Create(ctx context.Context, req *pb.CreateRequest) (*pb.StreetFair, error) {
+	if req.StreetFair == nil || req.StreetFair.Registry == "" {
+		return nil, status.Error(codes.InvalidArgument, fair.ErrInvalidStreetFair.Error())
+	}
+	m, err := s.sf.Create(fromProto(req.StreetFair))
+	if err != nil {
+		return nil, s.statusByErr(err)
+	}
+	return toProto(m), nil
+}
+
+// Update replaces a street fair at its current version, like the `If-Match`
+// required by the REST API
+func (s *Service) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.StreetFair, error) {
+	if req.StreetFair == nil || req.StreetFair.Registry == "" {
+		return nil, status.Error(codes.InvalidArgument, fair.ErrInvalidStreetFair.Error())
+	} else if req.StreetFair.Version <= 0 {
+		return nil, errVersionRequired
+	}
+	m := fromProto(req.StreetFair)
+	if err := s.sf.Update(m); err != nil {
+		return nil, s.statusByErr(err)
+	}
+	return toProto(m), nil
+}
+
+// Delete removes a street fair at its current version
+func (s *Service) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if req.Version <= 0 {
+		return nil, errVersionRequired
+	}
+	if err := s.sf.Delete(req.Registry, req.Version); err != nil {
+		return nil, s.statusByErr(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+// Watch streams the events of the bus matching the request filters, a
+// client falling behind has the stream ended with `ResourceExhausted`
+func (s *Service) Watch(req *pb.WatchRequest, stream pb.StreetFairService_WatchServer) error {
+	events, unsubscribe := s.bus.Subscribe()
+	defer unsubscribe()
+	// the headers tell the client that the changes are being watched
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return status.Error(codes.Unavailable, "Server is shutting down")
+		case e, ok := <-events:
+			if !ok {
+				return errLagging
+			}
+			if !matches(req, &e) {
+				continue
+			}
+			if err := stream.Send(eventToProto(&e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// matches reports whether e matches the filters of req, the
+// deletes carry no street fair so they always match
+func matches(req *pb.WatchRequest, e *fair.Event) bool {
+	if e.Model == nil {
+		return true
+	}
+	return (req.District == "" || req.District == e.Model.District) &&
+		(req.Region5 == "" || req.Region5 == e.Model.Region5)
+}
+
+type Server struct {
+	*grpc.Server
+	health  *health.Server
+	service *Service
+}
+
+// GracefulStop reports the server as not serving on the health service,
+// ends the Watch streams and waits for the pending calls
+func (s *Server) GracefulStop() {
+	s.health.Shutdown()
+	close(s.service.done)
+	s.Server.GracefulStop()
+}
+
+// New returns a gRPC server with the StreetFairService on sf (watching
+// the changes published on bus), the health service and reflection
+func New(sf fair.StreetFair, bus *fair.Bus, log *logrus.Logger) *Server {
+	s := &Server{
+		Server:  grpc.NewServer(),
+		health:  health.NewServer(),
+		service: &Service{sf: sf, bus: bus, log: log, done: make(chan struct{})},
+	}
+	pb.RegisterStreetFairServiceServer(s.Server, s.service)
+	healthpb.RegisterHealthServer(s.Server, s.health)
+	reflection.Register(s.Server)
+	return s
+}
@@ -0,0 +1,196 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/fair/fairtest"
+	"github.com/drgarcia1986/street-fair/pkg/rpc/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// querierStreetFair records the queries run on it
+type querierStreetFair struct {
+	*fairtest.StreetFair
+	queries []fair.Query
+}
+
+func (q *querierStreetFair) Query(query *fair.Query) ([]fair.Model, error) {
+	q.queries = append(q.queries, *query)
+	return fair.RunQuery(q.StreetFair, query)
+}
+
+func newTestConn(t *testing.T) *grpc.ClientConn {
+	bus := fair.NewBus()
+	sf := fairtest.New()
+	sf.Bus = bus
+	return newTestConnWith(t, sf, bus)
+}
+
+func newTestConnWith(t *testing.T, sf fair.StreetFair, bus *fair.Bus) *grpc.ClientConn {
+	server := New(sf, bus, logrus.New())
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.GracefulStop)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	c := pb.NewStreetFairServiceClient(newTestConn(t))
+
+	for _, registry := range []string{"4045-2", "4041-0", "1234-5"} {
+		if _, err := c.Create(ctx, &pb.CreateRequest{StreetFair: &pb.StreetFair{Registry: registry}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := c.Get(ctx, &pb.GetRequest{Registry: "4041-0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 1 {
+		t.Errorf("got version %d; want 1", got.Version)
+	}
+
+	var registries []string
+	req := &pb.ListRequest{PageSize: 2}
+	for pages := 0; ; pages++ {
+		resp, err := c.List(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sf := range resp.StreetFairs {
+			registries = append(registries, sf.Registry)
+		}
+		if resp.NextPageToken == "" {
+			if pages != 1 {
+				t.Errorf("got %d pages; want 2", pages+1)
+			}
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if len(registries) != 3 || registries[0] != "1234-5" || registries[2] != "4045-2" {
+		t.Errorf("got %v; want [1234-5 4041-0 4045-2]", registries)
+	}
+
+	_, err = c.Update(ctx, &pb.UpdateRequest{StreetFair: &pb.StreetFair{Registry: "4041-0", Version: 3}})
+	if code := status.Code(err); code != codes.FailedPrecondition {
+		t.Errorf("got %s; want %s", code, codes.FailedPrecondition)
+	}
+	_, err = c.Update(ctx, &pb.UpdateRequest{StreetFair: &pb.StreetFair{Registry: "4041-0"}})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("got %s; want %s", code, codes.InvalidArgument)
+	}
+	_, err = c.Delete(ctx, &pb.DeleteRequest{Registry: "4041-0"})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("got %s; want %s", code, codes.InvalidArgument)
+	}
+	if _, err := c.Delete(ctx, &pb.DeleteRequest{Registry: "4041-0", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Get(ctx, &pb.GetRequest{Registry: "4041-0"})
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("got %s; want %s", code, codes.NotFound)
+	}
+	_, err = c.Create(ctx, &pb.CreateRequest{StreetFair: &pb.StreetFair{}})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("got %s; want %s", code, codes.InvalidArgument)
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	sf := &querierStreetFair{StreetFair: fairtest.New(
+		fair.Model{Registry: "4045-2", District: "VILA PRUDENTE"},
+		fair.Model{Registry: "4041-0", District: "VILA FORMOSA"},
+		fair.Model{Registry: "1012-8", District: "VILA FORMOSA"},
+	)}
+	c := pb.NewStreetFairServiceClient(newTestConnWith(t, sf, fair.NewBus()))
+
+	resp, err := c.List(context.Background(), &pb.ListRequest{District: "VILA FORMOSA", PageSize: 1, PageToken: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.StreetFairs) != 1 || resp.StreetFairs[0].Registry != "4041-0" || resp.NextPageToken != "" {
+		t.Errorf("got %+v; want only 4041-0 on the last page", resp)
+	}
+	if len(sf.queries) != 1 {
+		t.Fatalf("got %d queries; want 1", len(sf.queries))
+	}
+	q := sf.queries[0]
+	if q.Limit != 2 || q.Offset != 1 || q.Filters["district"] != "VILA FORMOSA" {
+		t.Errorf("got %+v; want the page on the query", q)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := newTestConn(t)
+	c := pb.NewStreetFairServiceClient(conn)
+
+	stream, err := c.Watch(ctx, &pb.WatchRequest{District: "VILA FORMOSA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sf := range []*pb.StreetFair{
+		{Registry: "4045-2", District: "VILA PRUDENTE"},
+		{Registry: "4041-0", District: "VILA FORMOSA"},
+	} {
+		if _, err := c.Create(ctx, &pb.CreateRequest{StreetFair: sf}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Delete(ctx, &pb.DeleteRequest{Registry: "4041-0", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		eventType pb.Event_Type
+		registry  string
+	}{
+		{pb.Event_CREATED, "4041-0"},
+		{pb.Event_DELETED, "4041-0"},
+	}
+	for _, tt := range testCases {
+		e, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != tt.eventType || e.Registry != tt.registry {
+			t.Errorf("got %s %s; want %s %s", e.Type, e.Registry, tt.eventType, tt.registry)
+		}
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("got %s; want %s", resp.Status, healthpb.HealthCheckResponse_SERVING)
+	}
+}
@@ -3,6 +3,8 @@ package tests
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"testing"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -11,13 +13,14 @@ import (
 
 // NewDB returns a *gorm.DB instance point to a postgres or a sqlite
 // depends on the envvar `POSTGRES_HOST`
-// it's usefull for unittest in both, local and CI
-func NewDB() (*gorm.DB, error) {
+// it's usefull for unittest in both, local and CI, the sqlite lives on the
+// temporary dir of t so the tests don't leave it behind
+func NewDB(t testing.TB) (*gorm.DB, error) {
 	hostName := os.Getenv("POSTGRES_HOST")
 	if hostName != "" {
 		return newPostgres(hostName)
 	}
-	return gorm.Open(sqlite.Open("fair.db"), &gorm.Config{})
+	return gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "fair.db")), &gorm.Config{})
 }
 
 func newPostgres(hostName string) (*gorm.DB, error) {
@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/sirupsen/logrus"
+)
+
+// claimBatch is the number of deliveries sent at once by the Dispatcher
+const claimBatch = 20
+
+// Dispatcher enqueues a delivery of the events to every matching
+// subscription and sends the pending deliveries
+type Dispatcher struct {
+	store  Store
+	conf   *Config
+	client *http.Client
+	log    *logrus.Logger
+	now    func() time.Time
+	// wake tells the delivery loop that there are new deliveries
+	wake chan struct{}
+}
+
+// backoff is the delay before the attempt after the attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.conf.MinBackoff
+	for i := 1; i < attempts && delay < d.conf.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.conf.MaxBackoff {
+		delay = d.conf.MaxBackoff
+	}
+	return delay
+}
+
+// enqueue stores a delivery of e to each matching subscription
+func (d *Dispatcher) enqueue(e *fair.Event) error {
+	subs, err := d.store.Subscriptions()
+	if err != nil {
+		return err
+	}
+	var payload []byte
+	for i := range subs {
+		if !subs[i].matches(e) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(e); err != nil {
+				return err
+			}
+		}
+		now := d.now()
+		err := d.store.Enqueue(&Delivery{
+			SubscriptionID: subs[i].ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Registry:       e.Registry,
+			Payload:        string(payload),
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send makes an attempt of delivery, returning the status code of the
+// response (zero when the request failed)
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery, sub *Subscription) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.conf.Timeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "street-fair-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, d.now().Unix(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// attempt sends delivery and records the attempt, scheduling a retry on
+// failures or moving it to the dead-letter when out of attempts
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	log := d.log.WithField("delivery", delivery.ID)
+	sub, err := d.store.Subscription(delivery.SubscriptionID)
+	if err != nil {
+		log.Errorf("Loading webhook subscription: %+v", err)
+		return
+	}
+
+	start := d.now()
+	status, err := d.send(ctx, delivery, sub)
+	a := &Attempt{
+		DeliveryID: delivery.ID,
+		StatusCode: status,
+		DurationMs: d.now().Sub(start).Milliseconds(),
+		CreatedAt:  start,
+	}
+	delivery.Attempts++
+	delivery.UpdatedAt = d.now()
+	switch {
+	case err == nil:
+		delivery.Status, delivery.LastError = StatusSucceeded, ""
+	case delivery.Attempts >= d.conf.MaxAttempts:
+		a.Error, delivery.LastError = err.Error(), err.Error()
+		delivery.Status = StatusDead
+		log.Warnf("Webhook delivery out of attempts: %v", err)
+	default:
+		a.Error, delivery.LastError = err.Error(), err.Error()
+		delivery.NextAttemptAt = d.now().Add(d.backoff(delivery.Attempts))
+	}
+	if err := d.store.Record(delivery, a); err != nil {
+		log.Errorf("Recording webhook attempt: %+v", err)
+	}
+}
+
+// deliver sends the due deliveries, returning how many were sent
+func (d *Dispatcher) deliver(ctx context.Context) (int, error) {
+	// the lease outlasts the attempts of the batch sent in parallel
+	deliveries, err := d.store.Claim(d.now(), 2*d.conf.Timeout, claimBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *Delivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// notify wakes the delivery loop without blocking
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Send enqueues the deliveries of e, the Dispatcher is a sink of the
+// outbox relay
+func (d *Dispatcher) Send(e *fair.Event) error {
+	if err := d.enqueue(e); err != nil {
+		return err
+	}
+	d.notify()
+	return nil
+}
+
+// Run sends the pending deliveries until ctx is done, on every poll interval
+// or as soon as new deliveries are enqueued
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.conf.PollInterval)
+	defer ticker.Stop()
+	for {
+		// draining the due deliveries before waiting
+		for {
+			n, err := d.deliver(ctx)
+			if err != nil {
+				d.log.Errorf("Claiming webhook deliveries: %+v", err)
+			}
+			if n < claimBatch || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// NewDispatcher returns a Dispatcher of the subscriptions of store
+func NewDispatcher(store Store, conf *Config, log *logrus.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		conf:   conf,
+		client: newClient(conf.AllowPrivateTargets),
+		log:    log,
+		now:    func() time.Time { return time.Now().UTC() },
+		wake:   make(chan struct{}, 1),
+	}
+}
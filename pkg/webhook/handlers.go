@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const maxBodySize = 1 << 20
+
+type errResp struct {
+	Msg string `json:"msg"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func errorResponse(w http.ResponseWriter, err error, status int) {
+	writeJSON(w, status, &errResp{Msg: err.Error()})
+}
+
+func statusByErr(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidSubscription):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// deliveryResp is a delivery with its attempts
+type deliveryResp struct {
+	*Delivery
+	AttemptsLog []Attempt `json:"attempts_log"`
+}
+
+// HTTPService manages the subscriptions and their deliveries
+type HTTPService struct {
+	store Store
+	conf  *Config
+	log   *logrus.Logger
+	now   func() time.Time
+}
+
+// fail answers err, logging the unexpected errors
+func (h *HTTPService) fail(w http.ResponseWriter, err error, msg string) {
+	status := statusByErr(err)
+	if status == http.StatusInternalServerError {
+		h.log.Errorf("%s: %+v", msg, err)
+		err = errors.New("Internal error")
+	}
+	errorResponse(w, err, status)
+}
+
+func (h *HTTPService) Create(w http.ResponseWriter, r *http.Request) {
+	var sub Subscription
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&sub); err != nil {
+		errorResponse(w, ErrInvalidSubscription, http.StatusBadRequest)
+		return
+	}
+	if err := sub.validate(h.conf.AllowPrivateTargets); err != nil {
+		errorResponse(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if sub.ID, err = newID(); err != nil {
+		h.fail(w, err, "Creating webhook id")
+		return
+	}
+	if sub.Secret == "" {
+		if sub.Secret, err = newSecret(); err != nil {
+			h.fail(w, err, "Creating webhook secret")
+			return
+		}
+	}
+	if sub.Events == nil {
+		sub.Events = []string{}
+	}
+	sub.CreatedAt = h.now()
+	if err := h.store.CreateSubscription(&sub); err != nil {
+		h.fail(w, err, "Creating webhook subscription")
+		return
+	}
+	w.Header().Set("Location", "/webhooks/"+sub.ID+"/")
+	writeJSON(w, http.StatusCreated, &sub)
+}
+
+func (h *HTTPService) All(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.store.Subscriptions()
+	if err != nil {
+		h.fail(w, err, "Listing webhook subscriptions")
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (h *HTTPService) Get(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.store.Subscription(mux.Vars(r)["id"])
+	if err != nil {
+		h.fail(w, err, "Getting webhook subscription")
+		return
+	}
+	sub.Secret = ""
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *HTTPService) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.DeleteSubscription(mux.Vars(r)["id"]); err != nil {
+		h.fail(w, err, "Deleting webhook subscription")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries lists the deliveries of a subscription, filtered by the
+// `status` parameter (`dead` for the dead-letter)
+func (h *HTTPService) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := h.store.Subscription(id); err != nil {
+		h.fail(w, err, "Getting webhook subscription")
+		return
+	}
+	deliveries, err := h.store.Deliveries(id, r.URL.Query().Get("status"))
+	if err != nil {
+		h.fail(w, err, "Listing webhook deliveries")
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// delivery returns the delivery of the route, of its subscription
+func (h *HTTPService) delivery(r *http.Request) (*Delivery, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["delivery"], 10, 64)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	d, err := h.store.Delivery(id)
+	if err != nil {
+		return nil, err
+	} else if d.SubscriptionID != vars["id"] {
+		return nil, ErrNotFound
+	}
+	return d, nil
+}
+
+func (h *HTTPService) Delivery(w http.ResponseWriter, r *http.Request) {
+	d, err := h.delivery(r)
+	if err != nil {
+		h.fail(w, err, "Getting webhook delivery")
+		return
+	}
+	attempts, err := h.store.Attempts(d.ID)
+	if err != nil {
+		h.fail(w, err, "Listing webhook attempts")
+		return
+	}
+	writeJSON(w, http.StatusOK, &deliveryResp{Delivery: d, AttemptsLog: attempts})
+}
+
+// Redeliver puts a delivery (usually from the dead-letter) back to pending
+func (h *HTTPService) Redeliver(w http.ResponseWriter, r *http.Request) {
+	d, err := h.delivery(r)
+	if err != nil {
+		h.fail(w, err, "Getting webhook delivery")
+		return
+	}
+	if err := h.store.Redeliver(d.ID, h.now()); err != nil {
+		h.fail(w, err, "Redelivering webhook")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RegisterHandlers serves the subscriptions on `/webhooks/`
+func (h *HTTPService) RegisterHandlers(r *mux.Router) {
+	r.HandleFunc("/webhooks/", h.All).Methods("GET")
+	r.HandleFunc("/webhooks/", h.Create).Methods("POST")
+	r.HandleFunc("/webhooks/{id}/", h.Get).Methods("GET")
+	r.HandleFunc("/webhooks/{id}/", h.Delete).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/deliveries/", h.Deliveries).Methods("GET")
+	r.HandleFunc("/webhooks/{id}/deliveries/{delivery}/", h.Delivery).Methods("GET")
+	r.HandleFunc("/webhooks/{id}/deliveries/{delivery}/redeliver", h.Redeliver).Methods("POST")
+}
+
+func NewHTTPService(store Store, conf *Config, log *logrus.Logger) *HTTPService {
+	return &HTTPService{store: store, conf: conf, log: log, now: func() time.Time { return time.Now().UTC() }}
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store keeps the subscriptions, their deliveries and the attempts
+type Store interface {
+	CreateSubscription(s *Subscription) error
+	Subscriptions() ([]Subscription, error)
+	// Subscription returns ErrNotFound when there is no subscription id
+	Subscription(id string) (*Subscription, error)
+	// DeleteSubscription removes the subscription id with its deliveries
+	DeleteSubscription(id string) error
+
+	Enqueue(d *Delivery) error
+	// Claim returns up to limit pending deliveries due at now, postponing
+	// them by lease so no other worker sends them meanwhile
+	Claim(now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	// Record stores an attempt of d and the resulting state of d
+	Record(d *Delivery, a *Attempt) error
+	// Deliveries returns the deliveries of a subscription, of any status when empty
+	Deliveries(subscriptionID, status string) ([]Delivery, error)
+	// Delivery returns ErrNotFound when there is no delivery id
+	Delivery(id int64) (*Delivery, error)
+	Attempts(deliveryID int64) ([]Attempt, error)
+	// Redeliver puts the delivery id back to pending at now, with its
+	// attempts reset (keeping the recorded ones)
+	Redeliver(id int64, now time.Time) error
+}
+
+type subscriptionRow struct {
+	ID        string `gorm:"primaryKey"`
+	URL       string
+	Events    string
+	District  string
+	Region5   string
+	Secret    string
+	CreatedAt time.Time
+}
+
+func (subscriptionRow) TableName() string {
+	return "webhook_subscriptions"
+}
+
+func (r *subscriptionRow) subscription() Subscription {
+	s := Subscription{
+		ID:        r.ID,
+		URL:       r.URL,
+		Events:    []string{},
+		District:  r.District,
+		Region5:   r.Region5,
+		Secret:    r.Secret,
+		CreatedAt: r.CreatedAt.UTC(),
+	}
+	if r.Events != "" {
+		s.Events = strings.Split(r.Events, ",")
+	}
+	return s
+}
+
+type deliveryRow struct {
+	Delivery
+}
+
+func (deliveryRow) TableName() string {
+	return "webhook_deliveries"
+}
+
+type attemptRow struct {
+	Attempt
+}
+
+func (attemptRow) TableName() string {
+	return "webhook_attempts"
+}
+
+type dbStore struct {
+	db *gorm.DB
+}
+
+func (s *dbStore) CreateSubscription(sub *Subscription) error {
+	return s.db.Create(&subscriptionRow{
+		ID:        sub.ID,
+		URL:       sub.URL,
+		Events:    strings.Join(sub.Events, ","),
+		District:  sub.District,
+		Region5:   sub.Region5,
+		Secret:    sub.Secret,
+		CreatedAt: sub.CreatedAt,
+	}).Error
+}
+
+func (s *dbStore) Subscriptions() ([]Subscription, error) {
+	var rows []subscriptionRow
+	if err := s.db.Order("created_at, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	subs := make([]Subscription, len(rows))
+	for i := range rows {
+		subs[i] = rows[i].subscription()
+	}
+	return subs, nil
+}
+
+func (s *dbStore) Subscription(id string) (*Subscription, error) {
+	var row subscriptionRow
+	if err := s.db.Where("id = ?", id).First(&row).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	sub := row.subscription()
+	return &sub, nil
+}
+
+func (s *dbStore) DeleteSubscription(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		deliveries := tx.Model(&deliveryRow{}).Select("id").Where("subscription_id = ?", id)
+		if err := tx.Where("delivery_id IN (?)", deliveries).Delete(&attemptRow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&deliveryRow{}).Error; err != nil {
+			return err
+		}
+		r := tx.Where("id = ?", id).Delete(&subscriptionRow{})
+		if r.Error != nil {
+			return r.Error
+		} else if r.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *dbStore) Enqueue(d *Delivery) error {
+	row := deliveryRow{Delivery: *d}
+	if err := s.db.Create(&row).Error; err != nil {
+		return err
+	}
+	d.ID = row.ID
+	return nil
+}
+
+func (s *dbStore) Claim(now time.Time, lease time.Duration, limit int) ([]Delivery, error) {
+	var rows []deliveryRow
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("next_attempt_at, id").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := make([]Delivery, 0, len(rows))
+	for _, row := range rows {
+		// another worker may have claimed it since the lookup
+		r := s.db.Model(&deliveryRow{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", row.ID, StatusPending, now).
+			Update("next_attempt_at", now.Add(lease))
+		if r.Error != nil {
+			return nil, r.Error
+		} else if r.RowsAffected == 1 {
+			claimed = append(claimed, row.Delivery)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *dbStore) Record(d *Delivery, a *Attempt) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		row := attemptRow{Attempt: *a}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+		a.ID = row.ID
+		return tx.Model(&deliveryRow{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"next_attempt_at": d.NextAttemptAt,
+			"last_error":      d.LastError,
+			"updated_at":      d.UpdatedAt,
+		}).Error
+	})
+}
+
+func (s *dbStore) Deliveries(subscriptionID, status string) ([]Delivery, error) {
+	q := s.db.Where("subscription_id = ?", subscriptionID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var rows []deliveryRow
+	if err := q.Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	deliveries := make([]Delivery, len(rows))
+	for i := range rows {
+		deliveries[i] = rows[i].Delivery
+	}
+	return deliveries, nil
+}
+
+func (s *dbStore) Delivery(id int64) (*Delivery, error) {
+	var row deliveryRow
+	if err := s.db.Where("id = ?", id).First(&row).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &row.Delivery, nil
+}
+
+func (s *dbStore) Attempts(deliveryID int64) ([]Attempt, error) {
+	var rows []attemptRow
+	if err := s.db.Where("delivery_id = ?", deliveryID).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	attempts := make([]Attempt, len(rows))
+	for i := range rows {
+		attempts[i] = rows[i].Attempt
+	}
+	return attempts, nil
+}
+
+func (s *dbStore) Redeliver(id int64, now time.Time) error {
+	r := s.db.Model(&deliveryRow{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          StatusPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	})
+	if r.Error != nil {
+		return r.Error
+	} else if r.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// NewStore returns a Store on the `webhook_*` tables of db
+func NewStore(db *gorm.DB) Store {
+	return &dbStore{db: db}
+}
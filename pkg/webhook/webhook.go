@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const (
+	SignatureHeader = "X-Fair-Signature"
+	EventHeader     = "X-Fair-Event"
+	DeliveryHeader  = "X-Fair-Delivery"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	// StatusDead is the dead-letter status of the deliveries out of attempts
+	StatusDead = "dead"
+)
+
+var (
+	ErrNotFound            = errors.New("Webhook not found")
+	ErrInvalidSubscription = errors.New("Invalid webhook subscription")
+)
+
+type Config struct {
+	// Timeout is the maximum time of a delivery attempt
+	Timeout time.Duration `default:"10s"`
+	// MaxAttempts is the number of attempts before a delivery is dead
+	MaxAttempts int           `default:"8" split_words:"true"`
+	MinBackoff  time.Duration `default:"10s" split_words:"true"`
+	MaxBackoff  time.Duration `default:"1h" split_words:"true"`
+	// PollInterval is how often the pending deliveries are looked up
+	PollInterval time.Duration `default:"5s" split_words:"true"`
+	// AllowPrivateTargets allows the urls on private networks, only for
+	// internal deployments
+	AllowPrivateTargets bool `default:"false" split_words:"true"`
+}
+
+// NewConfig returns the settings from the `FAIR_WEBHOOK_*` env vars
+func NewConfig() (*Config, error) {
+	conf := new(Config)
+	if err := envconfig.Process("fair_webhook", conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// Subscription is a partner URL notified of the street fair events of
+// the types of Events (every type when empty) matching the filters
+type Subscription struct {
+	ID       string   `json:"id"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	District string   `json:"district,omitempty"`
+	Region5  string   `json:"region5,omitempty"`
+	// Secret signs the payloads, it's only shown on the creation
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var eventTypes = map[string]bool{fair.EventCreated: true, fair.EventUpdated: true, fair.EventDeleted: true}
+
+// validate checks s, its url must not be a private address unless
+// allowPrivate
+func (s *Subscription) validate(allowPrivate bool) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: the url must be an absolute http(s) url", ErrInvalidSubscription)
+	}
+	if !allowPrivate {
+		if err := checkHost(u.Hostname()); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSubscription, err)
+		}
+	}
+	for _, e := range s.Events {
+		if !eventTypes[e] {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidSubscription, e)
+		}
+	}
+	return nil
+}
+
+// matches reports whether e is notified to s, the deletes carry no
+// street fair so they match any filter
+func (s *Subscription) matches(e *fair.Event) bool {
+	if len(s.Events) > 0 {
+		found := false
+		for _, t := range s.Events {
+			found = found || t == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if e.Model == nil {
+		return true
+	}
+	return (s.District == "" || s.District == e.Model.District) &&
+		(s.Region5 == "" || s.Region5 == e.Model.Region5)
+}
+
+// Delivery is the notification of an event to a subscription
+type Delivery struct {
+	ID             int64     `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	EventID        int64     `json:"event_id,omitempty"`
+	EventType      string    `json:"event_type"`
+	Registry       string    `json:"registry"`
+	Payload        string    `json:"-"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	NextAttemptAt  time.Time `json:"next_attempt_at"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Attempt is a try to send a Delivery, StatusCode is zero when
+// the request failed
+type Attempt struct {
+	ID         int64     `json:"id"`
+	DeliveryID int64     `json:"-"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header of body sent at timestamp,
+// `t=<timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">`
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
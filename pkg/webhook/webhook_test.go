@@ -0,0 +1,350 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drgarcia1986/street-fair/pkg/fair"
+	"github.com/drgarcia1986/street-fair/pkg/migrations"
+	"github.com/drgarcia1986/street-fair/pkg/tests"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestStore(t *testing.T) Store {
+	db, err := tests.NewDB(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migrations.New(db, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []interface{}{&attemptRow{}, &deliveryRow{}, &subscriptionRow{}} {
+		if err := db.Where("1 = 1").Delete(table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewStore(db)
+}
+
+// receiver is a partner endpoint answering the status of its responses
+type receiver struct {
+	mu        sync.Mutex
+	responses []int
+	received  []*http.Request
+	bodies    [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.received = append(rc.received, r)
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusOK
+	if len(rc.responses) > 0 {
+		status, rc.responses = rc.responses[0], rc.responses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestDispatcher(store Store, now *time.Time) *Dispatcher {
+	d := NewDispatcher(store, &Config{
+		Timeout:      time.Second,
+		MaxAttempts:  2,
+		MinBackoff:   time.Minute,
+		MaxBackoff:   time.Hour,
+		PollInterval: time.Hour,
+		// the receivers are on httptest servers
+		AllowPrivateTargets: true,
+	}, logrus.New())
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func subscribe(t *testing.T, store Store, url, district string) *Subscription {
+	sub := &Subscription{ID: "sub-" + district, URL: url, District: district, Secret: "s3cr3t", CreatedAt: time.Now().UTC()}
+	if err := store.CreateSubscription(sub); err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func event(id int64, eventType, district string) *fair.Event {
+	e := &fair.Event{ID: id, Type: eventType, Registry: "4041-0", Time: time.Now().UTC()}
+	if eventType != fair.EventDeleted {
+		e.Model = &fair.Model{Registry: "4041-0", District: district}
+	}
+	return e
+}
+
+func TestSign(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte(`1622548800.{"type":"created"}`))
+	expected := "t=1622548800,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if actual := Sign("s3cr3t", 1622548800, []byte(`{"type":"created"}`)); actual != expected {
+		t.Errorf("got %s; want %s", actual, expected)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	now := time.Now()
+	d := newTestDispatcher(nil, &now)
+
+	var testCases = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{100, time.Hour},
+	}
+	for _, tt := range testCases {
+		if actual := d.backoff(tt.attempts); actual != tt.expected {
+			t.Errorf("got %s; want %s", actual, tt.expected)
+		}
+	}
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	store := newTestStore(t)
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+	subscribe(t, store, ts.URL, "VILA FORMOSA")
+
+	now := time.Now().UTC()
+	d := newTestDispatcher(store, &now)
+	for _, e := range []*fair.Event{
+		event(1, fair.EventCreated, "VILA FORMOSA"),
+		event(2, fair.EventCreated, "VILA PRUDENTE"),
+		event(3, fair.EventDeleted, ""),
+	} {
+		if err := d.enqueue(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := d.deliver(context.Background()); err != nil || n != 2 {
+		t.Fatalf("got %d, %+v; want 2, <nil>", n, err)
+	}
+	if actual := len(rc.received); actual != 2 {
+		t.Fatalf("got %d requests; want 2", actual)
+	}
+	for i, r := range rc.received {
+		expected := Sign("s3cr3t", now.Unix(), rc.bodies[i])
+		if actual := r.Header.Get(SignatureHeader); actual != expected {
+			t.Errorf("got %s; want %s", actual, expected)
+		}
+	}
+	// the deliveries are sent in parallel
+	ids := make(map[int64]bool)
+	for _, body := range rc.bodies {
+		var e fair.Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Fatal(err)
+		}
+		ids[e.ID] = true
+	}
+	if !ids[1] || !ids[3] {
+		t.Errorf("got events %v; want 1 and 3", ids)
+	}
+
+	deliveries, err := store.Deliveries("sub-VILA FORMOSA", StatusSucceeded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := len(deliveries); actual != 2 {
+		t.Errorf("got %d; want 2 succeeded", actual)
+	}
+	if n, _ := d.deliver(context.Background()); n != 0 {
+		t.Errorf("got %d; want nothing left to deliver", n)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	store := newTestStore(t)
+	rc := &receiver{responses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+	subscribe(t, store, ts.URL, "")
+
+	now := time.Now().UTC()
+	d := newTestDispatcher(store, &now)
+	if err := d.enqueue(event(1, fair.EventUpdated, "VILA FORMOSA")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := d.deliver(context.Background()); n != 1 {
+		t.Fatalf("got %d; want 1", n)
+	}
+	pending, _ := store.Deliveries("sub-", StatusPending)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("got %+v; want a pending delivery with a failed attempt", pending)
+	}
+	if n, _ := d.deliver(context.Background()); n != 0 {
+		t.Errorf("got %d; want no delivery before the backoff", n)
+	}
+
+	now = now.Add(time.Minute)
+	if n, _ := d.deliver(context.Background()); n != 1 {
+		t.Fatalf("got %d; want 1", n)
+	}
+	dead, _ := store.Deliveries("sub-", StatusDead)
+	if len(dead) != 1 {
+		t.Fatalf("got %d; want 1 dead", len(dead))
+	}
+	attempts, err := store.Attempts(dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[1].StatusCode != http.StatusBadGateway {
+		t.Errorf("got %+v; want 2 attempts ending with 502", attempts)
+	}
+
+	if err := store.Redeliver(dead[0].ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := d.deliver(context.Background()); n != 1 {
+		t.Errorf("got %d; want the redelivery", n)
+	}
+	if succeeded, _ := store.Deliveries("sub-", StatusSucceeded); len(succeeded) != 1 {
+		t.Errorf("got %d; want 1 succeeded", len(succeeded))
+	}
+}
+
+func TestDispatcherSend(t *testing.T) {
+	store := newTestStore(t)
+	subscribe(t, store, "http://localhost/hook", "")
+	now := time.Now().UTC()
+	d := newTestDispatcher(store, &now)
+
+	if err := d.Send(event(1, fair.EventCreated, "VILA FORMOSA")); err != nil {
+		t.Fatalf("got %+v; want <nil>", err)
+	}
+	select {
+	case <-d.wake:
+	default:
+		t.Error("got no wake; want the delivery loop woken")
+	}
+	if deliveries, _ := store.Deliveries("sub-", StatusPending); len(deliveries) != 1 {
+		t.Errorf("got %d; want 1 pending delivery", len(deliveries))
+	}
+}
+
+func TestDispatcherPrivateTarget(t *testing.T) {
+	store := newTestStore(t)
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+	// a stored url resolving to a private address, f.ex. by DNS rebinding
+	subscribe(t, store, ts.URL, "VILA FORMOSA")
+
+	now := time.Now().UTC()
+	d := newTestDispatcher(store, &now)
+	d.client = newClient(false)
+	if err := d.enqueue(event(1, fair.EventCreated, "VILA FORMOSA")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.deliver(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := len(rc.received); actual != 0 {
+		t.Errorf("got %d requests; want 0", actual)
+	}
+	deliveries, err := store.Deliveries("sub-VILA FORMOSA", StatusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].LastError, ErrForbiddenTarget.Error()) {
+		t.Errorf("got %+v; want a pending delivery failed by %s", deliveries, ErrForbiddenTarget)
+	}
+}
+
+func TestHTTPService(t *testing.T) {
+	store := newTestStore(t)
+	r := mux.NewRouter()
+	NewHTTPService(store, &Config{}, logrus.New()).RegisterHandlers(r)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	var testCases = []struct {
+		body     string
+		expected int
+	}{
+		{`{"url": "ftp://example.com"}`, http.StatusBadRequest},
+		{`{"url": "http://169.254.169.254/latest/meta-data/"}`, http.StatusBadRequest},
+		{`{"url": "http://127.0.0.1:8080/hook"}`, http.StatusBadRequest},
+		{`{"url": "http://localhost/hook"}`, http.StatusBadRequest},
+		{`{"url": "http://10.0.0.5/hook"}`, http.StatusBadRequest},
+		{`{"url": "http://[::1]/hook"}`, http.StatusBadRequest},
+		{`{"url": "http://[::ffff:192.168.0.1]/hook"}`, http.StatusBadRequest},
+		{`{"url": "https://example.com/hook", "events": ["moved"]}`, http.StatusBadRequest},
+		{`{"url": "https://example.com/hook", "events": ["created", "deleted"], "district": "VILA FORMOSA"}`, http.StatusCreated},
+	}
+	var created Subscription
+	for _, tt := range testCases {
+		w := do("POST", "/webhooks/", tt.body)
+		if w.Code != tt.expected {
+			t.Errorf("got %d; want %d", w.Code, tt.expected)
+		}
+		if w.Code == http.StatusCreated {
+			_ = json.NewDecoder(w.Body).Decode(&created)
+		}
+	}
+	if created.ID == "" || len(created.Secret) != 64 {
+		t.Fatalf("got %+v; want a subscription with a generated secret", created)
+	}
+
+	w := do("GET", "/webhooks/", "")
+	if strings.Contains(w.Body.String(), created.Secret) {
+		t.Error("got the secret on the listing; want it hidden")
+	}
+
+	store.Enqueue(&Delivery{SubscriptionID: created.ID, EventType: "created", Status: StatusDead, NextAttemptAt: time.Now(), CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	w = do("GET", "/webhooks/"+created.ID+"/deliveries/?status=dead", "")
+	var dead []Delivery
+	if err := json.NewDecoder(w.Body).Decode(&dead); err != nil || len(dead) != 1 {
+		t.Fatalf("got %+v, %+v; want 1 dead delivery", dead, err)
+	}
+	delivery := "/webhooks/" + created.ID + "/deliveries/" + strconv.FormatInt(dead[0].ID, 10) + "/"
+	if w = do("POST", delivery+"redeliver", ""); w.Code != http.StatusAccepted {
+		t.Errorf("got %d; want %d", w.Code, http.StatusAccepted)
+	}
+	if w = do("GET", delivery, ""); !strings.Contains(w.Body.String(), `"status":"pending"`) {
+		t.Errorf("got %s; want the delivery pending", w.Body.String())
+	}
+	if w = do("GET", "/webhooks/other/deliveries/"+strconv.FormatInt(dead[0].ID, 10)+"/", ""); w.Code != http.StatusNotFound {
+		t.Errorf("got %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	if w = do("DELETE", "/webhooks/"+created.ID+"/", ""); w.Code != http.StatusNoContent {
+		t.Errorf("got %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if w = do("GET", "/webhooks/"+created.ID+"/", ""); w.Code != http.StatusNotFound {
+		t.Errorf("got %d; want %d", w.Code, http.StatusNotFound)
+	}
+}